@@ -0,0 +1,151 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/creachadair/keyring/internal/packet"
+)
+
+// An accessSlot is a copy of the data storage key encrypted with one access
+// key, together with the salt for that access key (nil if none).
+type accessSlot struct {
+	salt  []byte
+	encDK []byte
+}
+
+// slotParser collects the access slots from the top-level packets of a
+// stored keyring. Each data key packet begins a new slot, and an access key
+// salt packet that immediately follows a data key belongs to that slot.
+//
+// For compatibility with older writers, a keyring with only one data key may
+// have its salt anywhere among the top-level packets.
+type slotParser struct {
+	slots  []accessSlot
+	salted []bool // whether each slot has a salt packet
+	loose  []byte // salt packet not directly after a data key
+	lastDK bool   // whether the previous packet was a data key
+
+	hasLoose bool // whether loose is set
+}
+
+// add processes p, which must be a data key or access key salt packet.
+func (s *slotParser) add(p packet.Packet) error {
+	wasDK := s.lastDK
+	s.lastDK = p.Type == packet.DataKeyType
+	if p.Type == packet.DataKeyType {
+		s.slots = append(s.slots, accessSlot{encDK: p.Data})
+		s.salted = append(s.salted, false)
+		return nil
+	}
+	if wasDK {
+		s.slots[len(s.slots)-1].salt = p.Data
+		s.salted[len(s.salted)-1] = true
+		return nil
+	} else if s.hasLoose {
+		return errors.New("multiple access key salts")
+	}
+	s.loose, s.hasLoose = p.Data, true
+	return nil
+}
+
+// note records that a packet other than a data key or salt was seen.
+func (s *slotParser) note() { s.lastDK = false }
+
+// finish reports the complete slots, or an error if they are not valid.
+func (s *slotParser) finish() ([]accessSlot, error) {
+	if len(s.slots) == 0 {
+		return nil, errors.New("no data key found")
+	} else if s.hasLoose {
+		if len(s.slots) != 1 || s.salted[0] {
+			return nil, errors.New("access key salt does not follow a data key")
+		}
+		s.slots[0].salt = s.loose
+	}
+	return s.slots, nil
+}
+
+// AddAccessKey adds another access key that unlocks r, in addition to the
+// ones it already has. It calls accessKey with a new random salt to obtain
+// the access key, and stores the salt with a copy of the data storage key
+// encrypted with that key. The access key must be exactly [AccessKeyLen]
+// bytes.
+//
+// When reading a keyring with several access keys, [Read] calls its access
+// key function with the salt of each in turn, until one unlocks the data
+// storage key. Any Argon2id or scrypt parameters stored with r apply to all
+// of them, so the caller should derive the new key the same way.
+//
+// The other methods that change the access key, such as
+// [Ring.ChangeAccessKey], affect only the first access key (index 0).
+// [Ring.Rekey] generates a new data storage key, and so removes all the
+// access keys other than the new one.
+func (r *Ring) AddAccessKey(accessKey AccessKeyFunc) error {
+	salt := GenerateSalt(16)
+
+	// Call accessKey without holding the lock, since it may be slow.
+	akey, err := accessKey(salt)
+	if err != nil {
+		return fmt.Errorf("keyring: access key: %w", err)
+	} else if len(akey) != AccessKeyLen {
+		return fmt.Errorf("keyring: access key is %d bytes, want %d", len(akey), AccessKeyLen)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	_, ekey, err := r.suite().EncryptWithKey(akey, r.dkPlaintext, r.dkContext)
+	if err != nil {
+		return fmt.Errorf("keyring: encrypt key: %w", err)
+	}
+	r.moreSlots = append(r.moreSlots, accessSlot{salt: salt, encDK: ekey})
+	return nil
+}
+
+// RemoveAccessKey removes the access key at the given index from r, where
+// index 0 is the first access key and the others are numbered in the order
+// they were added. It reports an error if index is out of range, or if it
+// would remove the only access key. Removing index 0 makes the next access
+// key the first.
+//
+// Note that a copy of r written before the change can still be opened with
+// the removed key. Use [Ring.Rekey] to revoke access to the data key itself.
+func (r *Ring) RemoveAccessKey(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if n := 1 + len(r.moreSlots); index < 0 || index >= n {
+		return fmt.Errorf("keyring: access key index %d out of range (0..%d)", index, n-1)
+	} else if n == 1 {
+		return errors.New("keyring: cannot remove the only access key")
+	}
+	if index == 0 {
+		next := r.moreSlots[0]
+		r.accessKeySalt, r.dkEncrypted = next.salt, next.encDK
+		index = 1
+	}
+	r.moreSlots = append(r.moreSlots[:index-1], r.moreSlots[index:]...)
+	return nil
+}
+
+// AccessKeyIndex reports the index of the access key that unlocked r when it
+// was read, numbered as for [Ring.RemoveAccessKey]. It reports -1 if r was not
+// unlocked by an access key function, for example if it was created by [New].
+// Changes to the access keys of r after reading do not affect the result.
+func (r *Ring) AccessKeyIndex() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	return r.openSlot - 1
+}
+
+// NumAccessKeys reports the number of access keys that unlock r.
+// See [Ring.AddAccessKey].
+func (r *Ring) NumAccessKeys() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	return 1 + len(r.moreSlots)
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// armorType is the PEM block type for an armored keyring.
+const armorType = "KEYRING"
+
+// WriteArmored encrypts and encodes r in binary format as [Ring.WriteTo]
+// does, and writes the result to w as a PEM block of type "KEYRING". This is
+// suitable for storage in systems that handle only text. Use [ReadArmored]
+// to read the result.
+func (r *Ring) WriteArmored(w io.Writer) error {
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		return err
+	}
+	defer clear(buf.Bytes())
+	return pem.Encode(w, &pem.Block{Type: armorType, Bytes: buf.Bytes()})
+}
+
+// ReadArmored reads a keyring written by [Ring.WriteArmored] from r, and
+// decodes it as [Read] does. Any text before or after the PEM block is
+// ignored. It reports an error if r does not contain a PEM block, or if the
+// first PEM block in r is not of type "KEYRING".
+func ReadArmored(r io.Reader, accessKey AccessKeySource) (*Ring, error) {
+	// Allow for the expansion of the binary encoding by base64.
+	data, err := readAllContext(context.Background(), r, 2*DefaultMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("keyring: no PEM block found")
+	} else if block.Type != armorType {
+		return nil, fmt.Errorf("keyring: PEM block has type %q, want %q", block.Type, armorType)
+	}
+	return Read(bytes.NewReader(block.Bytes), accessKey)
+}
@@ -4,10 +4,11 @@
 package main
 
 import (
+	"bytes"
 	crand "crypto/rand"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -17,6 +18,8 @@ import (
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/creachadair/atomicfile"
@@ -28,8 +31,13 @@ import (
 	"github.com/creachadair/keyring/internal/packet"
 )
 
+// keyringFileMode is the permission mode for keyring files written by the tool.
+// Keyring files are data, and should be readable and writable only by their owner.
+const keyringFileMode = 0600
+
 var flags struct {
-	EmptyOK bool `flag:"empty-ok,PRIVATE:Allow an empty passphrase"`
+	EmptyOK     bool `flag:"empty-ok,PRIVATE:Allow an empty passphrase"`
+	YubiKeySlot int  `flag:"yubikey-slot,Use this YubiKey challenge-response slot instead of a passphrase"`
 }
 
 func main() {
@@ -55,6 +63,49 @@ See "help key-format" for supported key formats.`,
 				SetFlags: command.Flags(flax.MustBind, &listFlags),
 				Run:      command.Adapt(runList),
 			},
+			{
+				Name:  "verify",
+				Usage: "<keyring>",
+				Help: `Check that a keyring file is intact and can be opened.
+
+On success, verify prints the number of keys, the active key ID, and the
+index of the access key that opened the keyring (0 for the first). On
+failure, it exits with a non-zero status and reports the reason, such as an
+incorrect passphrase, a corrupt or truncated file, or a header that has been
+tampered with. No key material is printed.`,
+				Run: command.Adapt(runVerify),
+			},
+			{
+				Name:  "export",
+				Usage: "<keyring>",
+				Help: `Write the plaintext contents of a keyring to stdout.
+
+With --format=json (the default), the output is a JSON object listing each
+key and the active key ID, in the format accepted by keyring.ImportJSON.
+With --format=env, each key is written as a line KEY_<id>=<base64>.
+
+The output contains every key in plaintext, and may end up in logs or shell
+history; it requires --yes-i-want-plaintext to confirm.`,
+				SetFlags: command.Flags(flax.MustBind, &exportFlags),
+				Run:      command.Adapt(runExport),
+			},
+			{
+				Name:  "import",
+				Usage: "<keyring>",
+				Help: `Read keys from stdin and store them in a keyring.
+
+The input is the output of the export command, in either format. By default,
+import creates a new keyring with a new passphrase, in which each key keeps
+its ID from the input. For --format=json input the active key is preserved;
+for --format=env input, which does not record it, the key with the highest ID
+is made active.
+
+With --into, the keys are instead added to the existing keyring, with new IDs.
+Keys already present in the keyring are skipped, and the active key of the
+keyring is not changed.`,
+				SetFlags: command.Flags(flax.MustBind, &importFlags),
+				Run:      command.Adapt(runImport),
+			},
 			{
 				Name:  "add",
 				Usage: "<keyring> --random n\n<keyring> <new-key>",
@@ -66,15 +117,83 @@ See "help key-format" for supported key formats.`,
 			},
 			{
 				Name:  "activate",
-				Usage: "<keyring> <id>",
+				Usage: "<keyring> <id>|label:<name>",
 				Help:  `Set the current active version in the keyring.`,
 				Run:   command.Adapt(runActivate),
 			},
+			{
+				Name:  "rotate",
+				Usage: "<keyring> --random n\n<keyring> <new-key>",
+				Help: `Add a new key to the keyring and make it active.
+
+The ID of the previously-active key is printed, so that data encrypted
+with it can be identified and re-encrypted.
+
+With --retire n, after rotation only the n most recently created keys are
+kept, and older keys are removed. The new key is always kept.
+
+See "help key-format" for supported key formats.`,
+				SetFlags: command.Flags(flax.MustBind, &rotateFlags),
+				Run:      command.Adapt(runRotate),
+			},
+			{
+				Name:  "remove",
+				Usage: "<keyring> <id>|label:<name>",
+				Help: `Remove a key from the keyring.
+
+The active key cannot be removed; activate another key first.`,
+				Run: command.Adapt(runRemove),
+			},
+			{
+				Name:  "relabel",
+				Usage: "<keyring> <id>|label:<name> <label>",
+				Help: `Set the label of a key in the keyring.
+
+An empty label removes the label from the key. Labels must be valid UTF-8
+without control characters, and at most 255 bytes long.`,
+				Run: command.Adapt(runRelabel),
+			},
+			{
+				Name:  "share",
+				Usage: "<keyring> <id>|label:<name> <recipient-key>",
+				Help: `Export a single key encrypted for a recipient.
+
+The specified key is encrypted with the recipient key, which must be exactly
+32 bytes, and printed to stdout as a base64 share. The recipient can use the
+import-share command with the same recipient key to add it to their keyring.
+
+See "help key-format" for supported key formats.`,
+				Run: command.Adapt(runShare),
+			},
+			{
+				Name:  "import-share",
+				Usage: "<keyring> <share> <recipient-key>",
+				Help: `Add a key from a share to the keyring.
+
+The share must have been created by the share command with the same
+recipient key. The imported key is added with a new ID in the keyring.
+
+See "help key-format" for supported key formats.`,
+				SetFlags: command.Flags(flax.MustBind, &importShareFlags),
+				Run:      command.Adapt(runImportShare),
+			},
 			{
 				Name:  "rekey",
 				Usage: "<keyring>",
-				Help:  `Change the data encryption key for the keyring.`,
-				Run:   command.Adapt(runRekey),
+				Help: `Change the passphrase and data encryption key for the keyring.
+
+Prompts for the current passphrase, then for a new one (with confirmation),
+and atomically replaces the keyring file.`,
+				Run: command.Adapt(runRekey),
+			},
+			{
+				Name:  "migrate",
+				Usage: "<keyring>",
+				Help: `Rewrite the keyring in the current storage format.
+
+If the keyring uses an older storage layout, it is rewritten in place in the
+current layout. A keyring that is already current is not modified.`,
+				Run: command.Adapt(runMigrate),
 			},
 			{
 				Name:     "debug",
@@ -110,12 +229,13 @@ Keys can be specified in various formats:
 }
 
 var createFlags struct {
-	Random int  `flag:"random,Generate a random initial key of this length"`
-	IsFile bool `flag:"file,Read the contents of the named file as the key"`
+	Random  int    `flag:"random,Generate a random initial key of this length"`
+	Charset string `flag:"charset,Draw random key characters from this set (base62, hex, url)"`
+	IsFile  bool   `flag:"file,Read the contents of the named file as the key"`
 }
 
 func runCreate(env *command.Env, name string, args ...string) error {
-	initialKey, err := getKeyFromArgs(env, args, createFlags.Random, createFlags.IsFile)
+	initialKey, err := getKeyFromArgs(env, args, createFlags.Random, createFlags.Charset, createFlags.IsFile)
 	if err != nil {
 		return err
 	}
@@ -127,12 +247,10 @@ func runCreate(env *command.Env, name string, args ...string) error {
 		return fmt.Errorf("file %q already exists, remove or rename it first", name)
 	}
 
-	pp, err := getPassphrase("New ", true)
+	accessKey, accessKeySalt, err := newAccessKey()
 	if err != nil {
 		return err
 	}
-
-	accessKey, accessKeySalt := keyring.AccessKeyFromPassphrase(pp)
 	r, err := keyring.New(keyring.Config{
 		InitialKey:    initialKey,
 		AccessKey:     accessKey,
@@ -142,7 +260,7 @@ func runCreate(env *command.Env, name string, args ...string) error {
 		return err
 	}
 
-	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0700)
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, keyringFileMode)
 	if err != nil {
 		return err
 	}
@@ -154,11 +272,24 @@ func runCreate(env *command.Env, name string, args ...string) error {
 }
 
 var listFlags struct {
-	Fingerprint bool `flag:"fingerprint,Show fingerprints of key contents"`
-	ShowKeys    bool `flag:"unsafe-show-keys,Show the full contents of each stored key (caution)"`
+	Fingerprint   bool   `flag:"fingerprint,Show fingerprints of key contents"`
+	ShowKeys      bool   `flag:"unsafe-show-keys,Show the full contents of each stored key (caution)"`
+	CreatedAfter  string `flag:"created-after,List only keys created at or after this date"`
+	CreatedBefore string `flag:"created-before,List only keys created before this date"`
+	Times         bool   `flag:"times,Show the creation time of each key"`
 }
 
 func runList(env *command.Env, name string) error {
+	after, err := parseDate(listFlags.CreatedAfter)
+	if err != nil {
+		return env.Usagef("invalid --created-after: %v", err)
+	}
+	before, err := parseDate(listFlags.CreatedBefore)
+	if err != nil {
+		return env.Usagef("invalid --created-before: %v", err)
+	}
+	filter := !after.IsZero() || !before.IsZero()
+
 	r, err := openAndReadKeyring(name)
 	if err != nil {
 		return err
@@ -168,12 +299,25 @@ func runList(env *command.Env, name string) error {
 	active := r.Active()
 	tw := tabwriter.NewWriter(os.Stdout, 4, 2, 1, ' ', 0)
 	fmt.Fprintf(tw, "# %d total\n", n)
-	for id := 1; id <= n; id++ {
-		if !r.Has(id) {
-			continue
+	var noTime int
+	for id, key := range r.Keys() {
+		if filter {
+			created := r.CreatedAt(id)
+			if created.IsZero() {
+				noTime++
+				continue
+			} else if created.Before(after) || (!before.IsZero() && !created.Before(before)) {
+				continue
+			}
 		}
-		key := r.Get(id, nil)
 		fmt.Fprintf(tw, "%d:\t%d bytes", id, len(key))
+		if listFlags.Times {
+			if created := r.CreatedAt(id); created.IsZero() {
+				fmt.Fprint(tw, "\t-")
+			} else {
+				fmt.Fprint(tw, "\t", created.Format(time.RFC3339))
+			}
+		}
 		if listFlags.Fingerprint {
 			fmt.Fprint(tw, "\t", cipher.KeyFingerprintString(key))
 		}
@@ -183,11 +327,220 @@ func runList(env *command.Env, name string) error {
 		if id == active {
 			fmt.Fprint(tw, "\t[active]")
 		}
+		if label := r.Label(id); label != "" {
+			fmt.Fprintf(tw, "\t%q", label)
+		}
 		fmt.Fprintln(tw)
 	}
+	if noTime > 0 {
+		fmt.Fprintf(tw, "# %d keys without creation times omitted\n", noTime)
+	}
 	return tw.Flush()
 }
 
+func runVerify(env *command.Env, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	keyFunc, err := accessKeyFunc(name)
+	if err != nil {
+		return err
+	}
+
+	// This does the same as keyring.Validate, but keeps the ring open long
+	// enough to report its summary.
+	r, err := keyring.Read(f, keyFunc)
+	if err == nil {
+		defer r.Close()
+		err = r.Check()
+	}
+	base := filepath.Base(name)
+	switch {
+	case err == nil:
+		fmt.Println(verifySummary(r))
+		return nil
+	case errors.Is(err, keyring.ErrBadAccessKey):
+		return fmt.Errorf("verify %q: incorrect passphrase or key", base)
+	case errors.Is(err, keyring.ErrTampered):
+		return fmt.Errorf("verify %q: header authentication failed, the file has been modified: %w", base, err)
+	case errors.Is(err, keyring.ErrLegacyFormat):
+		return fmt.Errorf("verify %q: legacy format, update it with \"migrate\": %w", base, err)
+	case errors.Is(err, keyring.ErrUnsupportedVersion):
+		return fmt.Errorf("verify %q: unsupported format: %w", base, err)
+	case errors.Is(err, keyring.ErrCorruptKeyring):
+		return fmt.Errorf("verify %q: corrupt or truncated file: %w", base, err)
+	default:
+		return fmt.Errorf("verify %q: %w", base, err)
+	}
+}
+
+// verifySummary returns a one-line summary of r for the verify command,
+// including which of its access keys unlocked it.
+func verifySummary(r *keyring.Ring) string {
+	active := "none"
+	if id := r.Active(); id != 0 {
+		active = strconv.Itoa(id)
+	}
+	return fmt.Sprintf("OK: %d keys, active %s, access key %d (of %d)",
+		r.Len(), active, r.AccessKeyIndex(), r.NumAccessKeys())
+}
+
+var exportFlags struct {
+	Format    string `flag:"format,default=json,Output format (json or env)"`
+	Plaintext bool   `flag:"yes-i-want-plaintext,Confirm writing plaintext keys to stdout"`
+}
+
+func runExport(env *command.Env, name string) error {
+	if exportFlags.Format != "json" && exportFlags.Format != "env" {
+		return env.Usagef("invalid --format %q (want json or env)", exportFlags.Format)
+	} else if !exportFlags.Plaintext {
+		return env.Usagef("export writes plaintext keys; confirm with --yes-i-want-plaintext")
+	}
+	r, err := openAndReadKeyring(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var out []byte
+	if exportFlags.Format == "json" {
+		out, err = r.View().MarshalJSON()
+		if err != nil {
+			return err
+		}
+		out = append(out, '\n')
+	} else {
+		for id, key := range r.Keys() {
+			out = fmt.Appendf(out, "KEY_%d=%s\n", id, base64.StdEncoding.EncodeToString(key))
+			clear(key)
+		}
+	}
+	defer clear(out)
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+var importFlags struct {
+	Into bool `flag:"into,Add the keys to an existing keyring"`
+}
+
+func runImport(env *command.Env, name string) error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer clear(data)
+	v, err := parseExport(data)
+	if err != nil {
+		return err
+	}
+
+	if importFlags.Into {
+		keyFunc, err := accessKeyFunc(name)
+		if err != nil {
+			return err
+		}
+		var added int
+		if err := keyring.UpdateFile(name, keyFunc, func(r *keyring.Ring) error {
+			added, err = r.Merge(v)
+			return err
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d of %d keys\n", added, v.Len())
+		fmt.Fprintf(env, "Updated %q\n", filepath.Base(name))
+		return nil
+	}
+
+	// As in create, check early whether the file exists.
+	if _, err := os.Stat(name); err == nil {
+		return fmt.Errorf("file %q already exists, remove or rename it first, or use --into", name)
+	}
+	accessKey, accessKeySalt, err := newAccessKey()
+	if err != nil {
+		return err
+	}
+	r, err := keyring.NewFromView(keyring.Config{
+		AccessKey:     accessKey,
+		AccessKeySalt: accessKeySalt,
+	}, v)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, keyringFileMode)
+	if err != nil {
+		return err
+	}
+	nw, werr := r.WriteTo(f)
+	if werr == nil {
+		fmt.Printf("Imported %d keys\n", r.Len())
+		fmt.Fprintf(env, "Wrote %d bytes to %q\n", nw, filepath.Base(name))
+	}
+	return errors.Join(werr, f.Close())
+}
+
+// parseExport parses the output of the export command in either format. Keys
+// in the env format are converted to JSON so that both formats are checked by
+// keyring.ImportJSON, which rejects empty keys and invalid or repeated IDs.
+func parseExport(data []byte) (*keyring.View, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("no keys found in input")
+	} else if trimmed[0] == '{' {
+		return keyring.ImportJSON(trimmed)
+	}
+
+	type entry struct {
+		ID  int    `json:"id"`
+		Key string `json:"key_base64"`
+	}
+	var in struct {
+		Active int     `json:"active"`
+		Keys   []entry `json:"keys"`
+	}
+	for i, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		tag, key, ok := strings.Cut(line, "=")
+		idStr, isKey := strings.CutPrefix(tag, "KEY_")
+		if !ok || !isKey {
+			return nil, fmt.Errorf("line %d: want KEY_<id>=<base64>", i+1)
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid id %q", i+1, idStr)
+		} else if key == "" {
+			return nil, fmt.Errorf("line %d: key %d is empty", i+1, id)
+		}
+		in.Keys = append(in.Keys, entry{ID: id, Key: key})
+		in.Active = max(in.Active, id)
+	}
+	js, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(js)
+	return keyring.ImportJSON(js)
+}
+
+// parseDate parses s as an RFC 3339 timestamp or a date in the form
+// YYYY-MM-DD, interpreted in the local time zone. If s is empty, it returns
+// the zero time without error.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, time.Local)
+}
+
 func prettyKey(key []byte) string {
 	if utf8.Valid(key) {
 		return fmt.Sprintf("%q", key)
@@ -196,66 +549,310 @@ func prettyKey(key []byte) string {
 }
 
 var addFlags struct {
-	Random   int  `flag:"random,Generate a random key of this length"`
-	IsFile   bool `flag:"file,Read the contents of the named file as the key"`
-	Activate bool `flag:"activate,Mark the new key as active immediately"`
+	Random   int    `flag:"random,Generate a random key of this length"`
+	Charset  string `flag:"charset,Draw random key characters from this set (base62, hex, url)"`
+	IsFile   bool   `flag:"file,Read the contents of the named file as the key"`
+	Activate bool   `flag:"activate,Mark the new key as active immediately"`
+	Label    string `flag:"label,Attach this label to the new key"`
 }
 
 func runAdd(env *command.Env, name string, args ...string) error {
-	r, err := openAndReadKeyring(name)
+	keyFunc, err := accessKeyFunc(name)
 	if err != nil {
 		return err
 	}
 
-	newKey, err := getKeyFromArgs(env, args, addFlags.Random, addFlags.IsFile)
+	if err := checkLabel(addFlags.Label); err != nil {
+		return env.Usagef("invalid --label: %v", err)
+	}
+	newKey, err := getKeyFromArgs(env, args, addFlags.Random, addFlags.Charset, addFlags.IsFile)
 	if err != nil {
 		return err
 	}
 
-	id := r.Add(newKey)
+	var id keyring.ID
+	if err := keyring.UpdateFile(name, keyFunc, func(r *keyring.Ring) error {
+		id = r.AddLabeled(addFlags.Label, newKey)
+		if addFlags.Activate {
+			r.Activate(id)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
 	fmt.Printf("Added key id %d (%d bytes)\n", id, len(newKey))
 	if addFlags.Activate {
-		r.Activate(id)
 		fmt.Printf("Activated new key id %d\n", id)
 	}
-	return atomicfile.Tx(name, 0700, func(w io.Writer) error {
-		nw, err := r.WriteTo(w)
-		if err == nil {
-			fmt.Fprintf(env, "Wrote %d bytes to %q\n", nw, filepath.Base(name))
+	fmt.Fprintf(env, "Updated %q\n", filepath.Base(name))
+	return nil
+}
+
+var rotateFlags struct {
+	Random  int    `flag:"random,Generate a random key of this length"`
+	Charset string `flag:"charset,Draw random key characters from this set (base62, hex, url)"`
+	IsFile  bool   `flag:"file,Read the contents of the named file as the key"`
+	Label   string `flag:"label,Attach this label to the new key"`
+	Retire  int    `flag:"retire,Keep only this many of the most recent keys"`
+}
+
+func runRotate(env *command.Env, name string, args ...string) error {
+	if rotateFlags.Retire < 0 {
+		return env.Usagef("invalid --retire %d", rotateFlags.Retire)
+	} else if err := checkLabel(rotateFlags.Label); err != nil {
+		return env.Usagef("invalid --label: %v", err)
+	}
+	keyFunc, err := accessKeyFunc(name)
+	if err != nil {
+		return err
+	}
+
+	newKey, err := getKeyFromArgs(env, args, rotateFlags.Random, rotateFlags.Charset, rotateFlags.IsFile)
+	if err != nil {
+		return err
+	}
+
+	var id, old keyring.ID
+	var retired []keyring.ID
+	if err := keyring.UpdateFile(name, keyFunc, func(r *keyring.Ring) error {
+		old = r.Active()
+		id = r.AddLabeled(rotateFlags.Label, newKey)
+		r.Activate(id)
+		if rotateFlags.Retire > 0 {
+			retired = retireKeys(r, rotateFlags.Retire)
 		}
+		return nil
+	}); err != nil {
 		return err
+	}
+	fmt.Printf("Added key id %d (%d bytes)\n", id, len(newKey))
+	if old != 0 {
+		fmt.Printf("Activated new key id %d, previously active key id %d\n", id, old)
+	} else {
+		fmt.Printf("Activated new key id %d, no key was previously active\n", id)
+	}
+	for _, rid := range retired {
+		fmt.Printf("Retired key id %d\n", rid)
+	}
+	fmt.Fprintf(env, "Updated %q\n", filepath.Base(name))
+	return nil
+}
+
+// retireKeys removes all but the keep most recently created keys from r,
+// other than the active key, and returns the IDs of the removed keys in
+// increasing order. Keys created at the same time are ordered by ID.
+func retireKeys(r *keyring.Ring, keep int) []keyring.ID {
+	ids := slices.Collect(r.IDs())
+	slices.SortFunc(ids, func(a, b keyring.ID) int {
+		if c := r.CreatedAt(a).Compare(r.CreatedAt(b)); c != 0 {
+			return -c
+		}
+		return b - a
 	})
+	var retired []keyring.ID
+	for _, id := range ids[min(keep, len(ids)):] {
+		if id != r.Active() && r.Remove(id) {
+			retired = append(retired, id)
+		}
+	}
+	slices.Sort(retired)
+	return retired
 }
 
-func runActivate(env *command.Env, name, idStr string) error {
-	id, err := strconv.Atoi(idStr)
+func runShare(env *command.Env, name, ref, recipient string) error {
+	rkey, err := decodeKey(recipient)
 	if err != nil {
-		return err
-	} else if id <= 0 {
-		return fmt.Errorf("invalid id %d", id)
+		return fmt.Errorf("recipient key: %w", err)
 	}
 
 	r, err := openAndReadKeyring(name)
 	if err != nil {
 		return err
 	}
+	id, err := parseRef(r, ref)
+	if err != nil {
+		return err
+	}
+	share, err := r.ExportKeyShare(id, rkey)
+	if err != nil {
+		return err
+	}
+	fmt.Println(share)
+	return nil
+}
 
-	if !r.Has(id) {
-		return fmt.Errorf("no key with id %d in keyring", id)
-	} else if r.Active() == id {
-		fmt.Fprintf(env, "Key id %d is already active\n", id)
+var importShareFlags struct {
+	Activate bool `flag:"activate,Mark the imported key as active immediately"`
+}
+
+func runImportShare(env *command.Env, name, share, recipient string) error {
+	rkey, err := decodeKey(recipient)
+	if err != nil {
+		return fmt.Errorf("recipient key: %w", err)
+	}
+	newKey, err := keyring.ImportKeyShare(strings.TrimSpace(share), rkey)
+	if err != nil {
+		return err
+	}
+
+	keyFunc, err := accessKeyFunc(name)
+	if err != nil {
+		return err
+	}
+	var id keyring.ID
+	if err := keyring.UpdateFile(name, keyFunc, func(r *keyring.Ring) error {
+		id = r.Add(newKey)
+		if importShareFlags.Activate {
+			r.Activate(id)
+		}
 		return nil
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("Imported key id %d (%d bytes)\n", id, len(newKey))
+	if importShareFlags.Activate {
+		fmt.Printf("Activated new key id %d\n", id)
 	}
+	fmt.Fprintf(env, "Updated %q\n", filepath.Base(name))
+	return nil
+}
+
+// errNoChange is returned by an update function to indicate that the keyring
+// does not need to be written.
+var errNoChange = errors.New("no change")
 
-	r.Activate(id)
+func runActivate(env *command.Env, name, ref string) error {
+	keyFunc, err := accessKeyFunc(name)
+	if err != nil {
+		return err
+	}
+	var id keyring.ID
+	err = keyring.UpdateFile(name, keyFunc, func(r *keyring.Ring) error {
+		var err error
+		if id, err = parseRef(r, ref); err != nil {
+			return err
+		} else if r.Active() == id {
+			return errNoChange
+		}
+		r.Activate(id)
+		return nil
+	})
+	if errors.Is(err, errNoChange) {
+		fmt.Fprintf(env, "Key id %d is already active\n", id)
+		return nil
+	} else if err != nil {
+		return err
+	}
 	fmt.Printf("Activated key id %d\n", id)
-	return atomicfile.Tx(name, 0700, func(w io.Writer) error {
-		nw, err := r.WriteTo(w)
-		if err == nil {
-			fmt.Fprintf(env, "Wrote %d bytes to %q\n", nw, filepath.Base(name))
+	fmt.Fprintf(env, "Updated %q\n", filepath.Base(name))
+	return nil
+}
+
+func runRemove(env *command.Env, name, ref string) error {
+	keyFunc, err := accessKeyFunc(name)
+	if err != nil {
+		return err
+	}
+	var id keyring.ID
+	var left int
+	err = keyring.UpdateFile(name, keyFunc, func(r *keyring.Ring) error {
+		var err error
+		if id, err = parseRef(r, ref); err != nil {
+			return err
+		} else if r.Active() == id {
+			return fmt.Errorf("key id %d is active; activate another key before removing it", id)
 		}
+		r.Remove(id)
+		left = r.Len()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed key id %d (%d remaining)\n", id, left)
+	fmt.Fprintf(env, "Updated %q\n", filepath.Base(name))
+	return nil
+}
+
+func runRelabel(env *command.Env, name, ref, label string) error {
+	if err := checkLabel(label); err != nil {
 		return err
+	}
+
+	keyFunc, err := accessKeyFunc(name)
+	if err != nil {
+		return err
+	}
+	var id keyring.ID
+	var old string
+	err = keyring.UpdateFile(name, keyFunc, func(r *keyring.Ring) error {
+		var err error
+		if id, err = parseRef(r, ref); err != nil {
+			return err
+		}
+		old = r.Label(id)
+		if old == label {
+			return errNoChange
+		}
+		r.SetLabel(id, label)
+		return nil
 	})
+	if errors.Is(err, errNoChange) {
+		fmt.Fprintf(env, "Key id %d already has label %q\n", id, label)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fmt.Printf("Relabeled key id %d from %q to %q\n", id, old, label)
+	fmt.Fprintf(env, "Updated %q\n", filepath.Base(name))
+	return nil
+}
+
+// parseRef resolves ref to the ID of a key in r. A ref is either a key ID, or
+// "label:name" to select the key whose label is name. It reports an error if
+// no key matches ref, or if more than one key has the label.
+func parseRef(r *keyring.Ring, ref string) (keyring.ID, error) {
+	label, ok := strings.CutPrefix(ref, "label:")
+	if !ok {
+		id, err := strconv.Atoi(ref)
+		if err != nil {
+			return 0, fmt.Errorf("invalid key reference %q: want an id or label:name", ref)
+		} else if id <= 0 {
+			return 0, fmt.Errorf("invalid id %d", id)
+		} else if !r.Has(id) {
+			return 0, fmt.Errorf("no key with id %d in keyring", id)
+		}
+		return id, nil
+	}
+	var ids []string
+	var found keyring.ID
+	for id := range r.IDs() {
+		if r.Label(id) == label {
+			found = id
+			ids = append(ids, strconv.Itoa(id))
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return 0, fmt.Errorf("no key with label %q in keyring", label)
+	case 1:
+		return found, nil
+	default:
+		return 0, fmt.Errorf("label %q is ambiguous; matching ids: %s", label, strings.Join(ids, ", "))
+	}
+}
+
+// checkLabel reports an error if label is not suitable as a key label.
+func checkLabel(label string) error {
+	const maxLabelLen = 255 // the limit of the storage format
+	if len(label) > maxLabelLen {
+		return fmt.Errorf("label is %d bytes, maximum is %d", len(label), maxLabelLen)
+	} else if !utf8.ValidString(label) {
+		return errors.New("label is not valid UTF-8")
+	} else if strings.ContainsFunc(label, unicode.IsControl) {
+		return errors.New("label contains control characters")
+	}
+	return nil
 }
 
 func runRekey(env *command.Env, name string) error {
@@ -264,15 +861,14 @@ func runRekey(env *command.Env, name string) error {
 		return err
 	}
 
-	pp, err := getPassphrase("New ", true)
+	accessKey, accessKeySalt, err := newAccessKey()
 	if err != nil {
 		return err
 	}
-
-	if err := r.Rekey(keyring.AccessKeyFromPassphrase(pp)); err != nil {
+	if err := r.Rekey(accessKey, accessKeySalt); err != nil {
 		return err
 	}
-	return atomicfile.Tx(name, 0700, func(w io.Writer) error {
+	return atomicfile.Tx(name, keyringFileMode, func(w io.Writer) error {
 		nw, err := r.WriteTo(w)
 		if err == nil {
 			fmt.Fprintf(env, "Wrote %d bytes to %q\n", nw, filepath.Base(name))
@@ -281,9 +877,34 @@ func runRekey(env *command.Env, name string) error {
 	})
 }
 
+func runMigrate(env *command.Env, name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	keyFunc, err := accessKeyFunc(name)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	migrated, err := keyring.Migrate(bytes.NewReader(data), &buf, keyFunc)
+	if err != nil {
+		return err
+	} else if !migrated {
+		fmt.Fprintf(env, "Keyring %q is already current\n", filepath.Base(name))
+		return nil
+	}
+	if err := atomicfile.WriteData(name, buf.Bytes(), keyringFileMode); err != nil {
+		return err
+	}
+	fmt.Fprintf(env, "Wrote %d bytes to %q\n", buf.Len(), filepath.Base(name))
+	return nil
+}
+
 var parseFlags struct {
 	Decrypt  bool `flag:"decrypt,Decrypt encrypted bundles (requires passphrase)"`
 	ShowKeys bool `flag:"unsafe-show-keys,Show plaintext key contents (implies --decrypt)"`
+	JSON     bool `flag:"json,Write the parsed structure as JSON"`
 }
 
 func runDebugParse(env *command.Env, name string) error {
@@ -297,12 +918,12 @@ func runDebugParse(env *command.Env, name string) error {
 		return err
 	}
 
-	// If we're supposed to decrypt and there are any bundles, grobble through
-	// for a data key and decrypt it. We're not being too picky here, if there
-	// are multiple key or salt packets we'll just try the first one.
+	// If we're supposed to decrypt and there are any bundles or stream frames,
+	// grobble through for a data key and decrypt it. We're not being too picky
+	// here, if there are multiple key or salt packets we'll just try the first one.
 	var dataKey []byte
 	if parseFlags.ShowKeys || (parseFlags.Decrypt && slices.ContainsFunc(kr.Packets, func(p packet.Packet) bool {
-		return p.Type == packet.BundleType
+		return p.Type == packet.BundleType || p.Type == packet.StreamFrameType
 	})) {
 		saltp := slices.IndexFunc(kr.Packets, func(p packet.Packet) bool { return p.Type == packet.AccessKeySaltType })
 		datap := slices.IndexFunc(kr.Packets, func(p packet.Packet) bool { return p.Type == packet.DataKeyType })
@@ -310,22 +931,32 @@ func runDebugParse(env *command.Env, name string) error {
 			return errors.New("no data key found for encrypted bundles")
 		}
 
-		fmt.Fprintln(env, "Found encrypted bundles, passphrase required to decrypt")
-		pp, err := getPassphrase("", false)
+		fmt.Fprintln(env, "Found encrypted bundles, access key required to decrypt")
+		keyFunc, err := accessKeyFunc(name)
 		if err != nil {
 			return err
 		}
-		accessKey, err := keyring.PassphraseKey(pp)(kr.Packets[saltp].Data)
+		accessKey, err := keyFunc(kr.Packets[saltp].Data)
 		if err != nil {
 			return err
 		}
-		dk, err := kr.Packets[datap].Decrypt(accessKey)
+		dk, err := kr.Packets[datap].Decrypt(kr.Suite(), accessKey)
 		if err != nil {
 			return fmt.Errorf("invalid access key: %w", err)
 		}
 		dataKey = dk
 		fmt.Fprintln(env, "Unlocked data storage key")
 	}
+	inner, err := openContents(kr, dataKey)
+	if err != nil {
+		return err
+	}
+	if parseFlags.JSON {
+		if parseFlags.ShowKeys {
+			fmt.Fprintln(env, "WARNING: Output includes plaintext key material")
+		}
+		return writeParseJSON(kr, dataKey, inner)
+	}
 	fmt.Printf("Keyring version %02x, reserved %04x, %d packets\n", kr.Version, kr.Reserved[:], len(kr.Packets))
 
 	for i, pkt := range kr.Packets {
@@ -333,7 +964,8 @@ func runDebugParse(env *command.Env, name string) error {
 			fmt.Println()
 		}
 		fmt.Printf("-- Packet %d: [%d] %v (%d bytes)\n", i+1, byte(pkt.Type), pkt.Type, len(pkt.Data))
-		if pkt.Type != packet.BundleType || dataKey == nil {
+		b, ok := inner[i]
+		if !ok {
 			hexDump(os.Stdout, pkt.Data, "")
 			if pkt.Type == packet.DataKeyType && dataKey != nil {
 				if parseFlags.ShowKeys {
@@ -345,16 +977,10 @@ func runDebugParse(env *command.Env, name string) error {
 			continue
 		}
 
-		// Reaching here, we have an encrypted bundle and are supposed to decrypt it.
-		dec, err := pkt.Decrypt(dataKey)
-		if err != nil {
-			return fmt.Errorf("decrypt packet %d: %w", i+1, err)
-		}
-		b, err := packet.ParsePackets(dec, 0)
-		if err != nil {
-			return fmt.Errorf("parse bundle %d: %w", i+1, err)
+		// Reaching here, we have a decrypted bundle or stream to render.
+		if pkt.Type == packet.StreamFrameType {
+			fmt.Println(" (last frame; the contents of the stream follow)")
 		}
-
 		for j, pkt := range b {
 			if j > 0 {
 				fmt.Println()
@@ -362,7 +988,13 @@ func runDebugParse(env *command.Env, name string) error {
 			fmt.Printf(" + inner packet %d.%d: [%d] %v (%d bytes)\n", i+1, j+1, byte(pkt.Type), pkt.Type, len(pkt.Data))
 			switch pkt.Type {
 			case packet.ActiveKeyType:
-				fmt.Printf("   active key id: %d\n", binary.BigEndian.Uint32(pkt.Data))
+				if id, err := packet.ParseActiveKey(pkt.Data); err != nil {
+					fmt.Printf("   <invalid active key> %v\n", err)
+				} else if id == 0 {
+					fmt.Println("   no active key")
+				} else {
+					fmt.Printf("   active key id: %d\n", id)
+				}
 			case packet.KeyringEntryType:
 				ki, err := packet.ParseKeyInfo(pkt.Data)
 				if err != nil {
@@ -383,6 +1015,123 @@ func runDebugParse(env *command.Env, name string) error {
 	return nil
 }
 
+// parsedPacket is the JSON encoding of a packet for debug parse --json.
+// Plaintext key material is populated only if --unsafe-show-keys is set.
+type parsedPacket struct {
+	Type      string         `json:"type"`
+	Code      byte           `json:"code"`
+	Len       int            `json:"len"`
+	Data      string         `json:"data,omitempty"`      // hex, if not decoded
+	Plaintext []byte         `json:"plaintext,omitempty"` // decrypted data key
+	ActiveKey int            `json:"activeKey,omitempty"`
+	KeyID     int            `json:"keyID,omitempty"`
+	KeyLen    int            `json:"keyLen,omitempty"`
+	Created   *time.Time     `json:"created,omitempty"`
+	NotBefore *time.Time     `json:"notBefore,omitempty"`
+	Label     string         `json:"label,omitempty"`
+	Key       []byte         `json:"key,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Packets   []parsedPacket `json:"packets,omitempty"` // decrypted bundle contents
+}
+
+// openContents decrypts the bundles and the stream frames of kr with dataKey,
+// if it is non-nil, and parses their contents. The inner packets of each
+// bundle are keyed by its index in kr.Packets, and those of the stream by the
+// index of its last frame.
+func openContents(kr packet.Keyring, dataKey []byte) (map[int][]packet.Packet, error) {
+	out := make(map[int][]packet.Packet)
+	if dataKey == nil {
+		return out, nil
+	}
+	var frames []packet.Packet
+	last := -1
+	for i, pkt := range kr.Packets {
+		switch pkt.Type {
+		case packet.BundleType:
+			dec, err := kr.OpenBundle(pkt, dataKey)
+			if err != nil {
+				return nil, fmt.Errorf("decrypt packet %d: %w", i+1, err)
+			}
+			b, err := packet.ParsePackets(dec, 0)
+			if err != nil {
+				return nil, fmt.Errorf("parse bundle %d: %w", i+1, err)
+			}
+			out[i] = b
+		case packet.StreamFrameType:
+			frames = append(frames, pkt)
+			last = i
+		}
+	}
+	if len(frames) != 0 {
+		dec, err := kr.OpenStream(frames, dataKey)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt stream: %w", err)
+		}
+		b, err := packet.ParsePackets(dec, 0)
+		if err != nil {
+			return nil, fmt.Errorf("parse stream: %w", err)
+		}
+		out[last] = b
+	}
+	return out, nil
+}
+
+func writeParseJSON(kr packet.Keyring, dataKey []byte, inner map[int][]packet.Packet) error {
+	out := struct {
+		Version  byte           `json:"version"`
+		Reserved string         `json:"reserved"`
+		Packets  []parsedPacket `json:"packets"`
+	}{Version: kr.Version, Reserved: hex.EncodeToString(kr.Reserved[:])}
+
+	for i, pkt := range kr.Packets {
+		pp := parsedPacket{Type: pkt.Type.String(), Code: byte(pkt.Type), Len: len(pkt.Data)}
+		b, ok := inner[i]
+		if !ok {
+			pp.Data = hex.EncodeToString(pkt.Data)
+			if pkt.Type == packet.DataKeyType && parseFlags.ShowKeys {
+				pp.Plaintext = dataKey
+			}
+			out.Packets = append(out.Packets, pp)
+			continue
+		}
+		for _, pkt := range b {
+			ip := parsedPacket{Type: pkt.Type.String(), Code: byte(pkt.Type), Len: len(pkt.Data)}
+			switch pkt.Type {
+			case packet.ActiveKeyType:
+				id, err := packet.ParseActiveKey(pkt.Data)
+				if err != nil {
+					ip.Error = err.Error()
+				}
+				ip.ActiveKey = id
+			case packet.KeyringEntryType:
+				ki, err := packet.ParseKeyInfo(pkt.Data)
+				if err != nil {
+					ip.Error = err.Error()
+					break
+				}
+				ip.KeyID, ip.KeyLen = ki.ID, len(ki.Key)
+				if !ki.Created.IsZero() {
+					ip.Created = &ki.Created
+				}
+				if !ki.NotBefore.IsZero() {
+					ip.NotBefore = &ki.NotBefore
+				}
+				ip.Label = ki.Label
+				if parseFlags.ShowKeys {
+					ip.Key = ki.Key
+				}
+			default:
+				ip.Data = hex.EncodeToString(pkt.Data)
+			}
+			pp.Packets = append(pp.Packets, ip)
+		}
+		out.Packets = append(out.Packets, pp)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
 func hexDump(w io.Writer, data []byte, indent string) {
 	const numCols = 16
 
@@ -411,22 +1160,92 @@ func openAndReadKeyring(name string) (*keyring.Ring, error) {
 		return nil, err
 	}
 	defer f.Close()
+	keyFunc, err := accessKeyFunc(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := keyring.Read(f, keyFunc)
+	switch {
+	case errors.Is(err, keyring.ErrBadAccessKey):
+		return nil, fmt.Errorf("incorrect passphrase or key for %q", filepath.Base(name))
+	case errors.Is(err, keyring.ErrLegacyFormat):
+		return nil, fmt.Errorf("%q uses a legacy format; update it with \"migrate\": %w", filepath.Base(name), err)
+	}
+	return r, err
+}
+
+// accessKeyFunc returns an access key function to open the keyring stored in
+// the named file, either from the YubiKey selected by --yubikey-slot or from a
+// passphrase. A passphrase is stretched with the key derivation parameters
+// stored in the file, if it has any.
+func accessKeyFunc(name string) (keyring.AccessKeyFunc, error) {
+	if flags.YubiKeySlot != 0 {
+		return keyring.YubiKeyHMACKey(flags.YubiKeySlot)
+	}
 	pp, err := getPassphrase("", false)
 	if err != nil {
 		return nil, err
 	}
-	return keyring.Read(f, keyring.PassphraseKey(pp))
+	return passphraseKey(name, pp), nil
 }
 
+// passphraseKey returns an access key function that derives a key from
+// passphrase using the Argon2id or scrypt parameters stored in the named
+// keyring file, or with keyring.PassphraseKey if it stores none.
+func passphraseKey(name, passphrase string) keyring.AccessKeyFunc {
+	f, err := os.Open(name)
+	if err != nil {
+		return keyring.PassphraseKey(passphrase) // reading the keyring will report the error
+	}
+	defer f.Close()
+	info, err := keyring.Inspect(f)
+	switch {
+	case err != nil:
+		return keyring.PassphraseKey(passphrase) // as above
+	case info.Argon2Params != nil:
+		return keyring.Argon2idKey(passphrase, *info.Argon2Params)
+	case info.ScryptParams != nil:
+		sp := info.ScryptParams
+		return keyring.ScryptKey(passphrase, sp.N, sp.R, sp.P)
+	}
+	return keyring.PassphraseKey(passphrase)
+}
+
+// newAccessKey returns a new access key and salt, either from the YubiKey
+// selected by --yubikey-slot or from a passphrase.
+func newAccessKey() (key, salt []byte, _ error) {
+	if flags.YubiKeySlot != 0 {
+		keyFunc, err := keyring.YubiKeyHMACKey(flags.YubiKeySlot)
+		if err != nil {
+			return nil, nil, err
+		}
+		salt := keyring.GenerateSalt(16)
+		key, err := keyFunc(salt)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, salt, nil
+	}
+	pp, err := getPassphrase("New ", true)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, salt = keyring.AccessKeyFromPassphrase(pp)
+	return key, salt, nil
+}
+
+// promptPassphrase reads a passphrase from the terminal. Tests replace it.
+var promptPassphrase = getpass.Prompt
+
 func getPassphrase(tag string, confirm bool) (string, error) {
-	pp, err := getpass.Prompt(tag + "Passphrase: ")
+	pp, err := promptPassphrase(tag + "Passphrase: ")
 	if err != nil {
 		return "", fmt.Errorf("read passphrase: %w", err)
 	} else if pp == "" && confirm && !flags.EmptyOK {
 		return "", errors.New("empty passphrase")
 	}
 	if confirm {
-		cf, err := getpass.Prompt("Confirm " + tag + "passphrase: ")
+		cf, err := promptPassphrase("Confirm " + tag + "passphrase: ")
 		if err != nil {
 			return "", fmt.Errorf("read confirmation: %w", err)
 		} else if cf != pp {
@@ -436,7 +1255,7 @@ func getPassphrase(tag string, confirm bool) (string, error) {
 	return pp, nil
 }
 
-func getKeyFromArgs(env *command.Env, args []string, random int, isFile bool) ([]byte, error) {
+func getKeyFromArgs(env *command.Env, args []string, random int, charset string, isFile bool) ([]byte, error) {
 	if len(args) > 1 {
 		return nil, env.Usagef("extra arguments after key: %v", args[1:])
 	} else if len(args) == 1 {
@@ -464,12 +1283,28 @@ func getKeyFromArgs(env *command.Env, args []string, random int, isFile bool) ([
 	}
 
 	// Generate a random key.
+	if charset != "" {
+		alphabet, ok := charsets[charset]
+		if !ok {
+			return nil, env.Usagef("unknown --charset %q (want base62, hex, or url)", charset)
+		}
+		key := keyring.RandomKeyString(random, alphabet)
+		fmt.Fprintf(env, "Generated %d-character random %s key\n", len(key), charset)
+		return key, nil
+	}
 	key := make([]byte, random)
 	crand.Read(key) // panics on error
 	fmt.Fprintf(env, "Generated %d-byte random key\n", len(key))
 	return key, nil
 }
 
+// charsets maps the names accepted by --charset to their alphabets.
+var charsets = map[string]string{
+	"base62": keyring.AlphabetBase62,
+	"hex":    keyring.AlphabetHex,
+	"url":    keyring.AlphabetURLSafe,
+}
+
 func decodeKey(s string) ([]byte, error) {
 	if s == "-" {
 		return io.ReadAll(os.Stdin)
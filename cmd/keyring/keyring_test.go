@@ -0,0 +1,218 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/getpass"
+	"github.com/creachadair/keyring"
+)
+
+func TestParseRef(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("apple"),
+		AccessKey:  bytes.Repeat([]byte{7}, keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.AddLabeled("fruit", []byte("pear"))  // 2
+	r.AddLabeled("dup", []byte("plum"))    // 3
+	r.AddLabeled("dup", []byte("cherry"))  // 4
+	r.AddLabeled("label:x", []byte("fig")) // 5
+
+	tests := []struct {
+		ref  string
+		want keyring.ID
+		err  string
+	}{
+		{"1", 1, ""},
+		{"4", 4, ""},
+		{"label:fruit", 2, ""},
+		{"label:label:x", 5, ""},
+
+		{"0", 0, "invalid id"},
+		{"-3", 0, "invalid id"},
+		{"9", 0, "no key with id 9"},
+		{"fruit", 0, "invalid key reference"},
+		{"label:nonesuch", 0, `no key with label "nonesuch"`},
+		{"label:dup", 0, "matching ids: 3, 4"},
+	}
+	for _, tc := range tests {
+		got, err := parseRef(r, tc.ref)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("parseRef(%q): got (%v, %v), want error containing %q", tc.ref, got, err, tc.err)
+			}
+		} else if err != nil || got != tc.want {
+			t.Errorf("parseRef(%q): got (%v, %v), want (%v, nil)", tc.ref, got, err, tc.want)
+		}
+	}
+}
+
+func TestOpenRecipients(t *testing.T) {
+	const pass1, pass2 = "first recipient", "second recipient"
+
+	// Write a keyring file that either recipient's passphrase opens.
+	akey, salt := keyring.AccessKeyFromPassphrase(pass1)
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("apple"),
+		AccessKey:     akey,
+		AccessKeySalt: salt,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := r.AddAccessKey(keyring.PassphraseKey(pass2)); err != nil {
+		t.Fatalf("AddAccessKey failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "shared.ring")
+	if err := r.Save(path, 0); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	setPassphrase := func(pass string) {
+		promptPassphrase = func(string) (string, error) { return pass, nil }
+	}
+	t.Cleanup(func() { promptPassphrase = getpass.Prompt })
+
+	for i, pass := range []string{pass1, pass2} {
+		setPassphrase(pass)
+		r, err := openAndReadKeyring(path)
+		if err != nil {
+			t.Fatalf("Open with passphrase %d failed: %v", i, err)
+		}
+		if got := r.AccessKeyIndex(); got != i {
+			t.Errorf("Open with passphrase %d: access key index %d, want %d", i, got, i)
+		}
+		r.Close()
+
+		want := fmt.Sprintf("OK: 1 keys, active 1, access key %d (of 2)\n", i)
+		if got := captureStdout(t, func() error { return runVerify(nil, path) }); got != want {
+			t.Errorf("Verify with passphrase %d: got %q, want %q", i, got, want)
+		}
+	}
+
+	setPassphrase("neither recipient")
+	if _, err := openAndReadKeyring(path); err == nil || !strings.Contains(err.Error(), "incorrect passphrase") {
+		t.Errorf("Open with a wrong passphrase: got %v, want incorrect passphrase", err)
+	}
+}
+
+func TestOpenStoredKDF(t *testing.T) {
+	const pass = "stretch me"
+	argon2 := keyring.Argon2Params{Time: 1, Memory: 64, Threads: 1}
+	scrypt := keyring.ScryptParams{N: 16, R: 1, P: 1}
+	tests := []struct {
+		name    string
+		keyFunc keyring.AccessKeyFunc
+		config  keyring.Config
+	}{
+		{"Argon2id", keyring.Argon2idKey(pass, argon2), keyring.Config{Argon2Params: &argon2}},
+		{"scrypt", keyring.ScryptKey(pass, scrypt.N, scrypt.R, scrypt.P), keyring.Config{ScryptParams: &scrypt}},
+	}
+	promptPassphrase = func(string) (string, error) { return pass, nil }
+	t.Cleanup(func() { promptPassphrase = getpass.Prompt })
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			salt := keyring.GenerateSalt(16)
+			akey, err := tc.keyFunc(salt)
+			if err != nil {
+				t.Fatalf("Derive access key: %v", err)
+			}
+			cfg := tc.config
+			cfg.InitialKey = []byte("apple")
+			cfg.AccessKey = akey
+			cfg.AccessKeySalt = salt
+			r, err := keyring.New(cfg)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "kdf.ring")
+			if err := r.Save(path, 0); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+
+			got, err := openAndReadKeyring(path)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			got.Close()
+		})
+	}
+}
+
+func TestOpenLegacy(t *testing.T) {
+	// A keyring in format version 1, without a header MAC, as written by an
+	// older version of the package with the passphrase below.
+	const legacyHex = "ec01000002000048cd57cd4ebcf9c979ebb365a5e1f07895416e03eff1fc25d5" +
+		"69260c06dd90cd9681f423d037055b78f5c92c90e009f7ea935f8ce68951aa93" +
+		"a094b83fb2b98b024b77280e89934b0603000010c7b408130697e9ea3c05d9b2" +
+		"2426f99d0600003d20725152ef8252d202520721ccb3948fed37fc47f76e06bc" +
+		"dd6ba282f956c4e896c8e3a0cddea75ebfeb4c67e9b0ac0dd1f6d6a97d745a8e" +
+		"a2957a3142"
+	data, err := hex.DecodeString(legacyHex)
+	if err != nil {
+		t.Fatalf("Decode legacy keyring: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "legacy.ring")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Write legacy keyring: %v", err)
+	}
+	promptPassphrase = func(string) (string, error) { return "legacy passphrase", nil }
+	t.Cleanup(func() { promptPassphrase = getpass.Prompt })
+
+	// Opening and verifying the keyring suggest migrating it.
+	if _, err := openAndReadKeyring(path); !errors.Is(err, keyring.ErrLegacyFormat) || !strings.Contains(err.Error(), "migrate") {
+		t.Errorf("Open legacy: got %v, want %v with a migrate hint", err, keyring.ErrLegacyFormat)
+	}
+	if err := runVerify(nil, path); !errors.Is(err, keyring.ErrLegacyFormat) || !strings.Contains(err.Error(), "migrate") {
+		t.Errorf("Verify legacy: got %v, want %v with a migrate hint", err, keyring.ErrLegacyFormat)
+	}
+
+	// After migration, the keyring opens normally.
+	if err := runMigrate(&command.Env{Log: io.Discard}, path); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	r, err := openAndReadKeyring(path)
+	if err != nil {
+		t.Fatalf("Open migrated: %v", err)
+	}
+	defer r.Close()
+	if got := r.Active(); got != 1 {
+		t.Errorf("Active: got %v, want 1", got)
+	}
+}
+
+// captureStdout calls f and returns what it writes to stdout.
+func captureStdout(t *testing.T, f func() error) string {
+	t.Helper()
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe: %v", err)
+	}
+	saved := os.Stdout
+	os.Stdout = pw
+	ferr := f()
+	os.Stdout = saved
+	pw.Close()
+	out, err := io.ReadAll(pr)
+	if err != nil {
+		t.Fatalf("Read stdout: %v", err)
+	}
+	if ferr != nil {
+		t.Fatalf("Command failed: %v", ferr)
+	}
+	return string(out)
+}
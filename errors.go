@@ -0,0 +1,79 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCorruptKeyring is reported by [Read] and [Ring.Check] when the stored
+	// keyring is structurally invalid, or its contents do not decrypt with a
+	// valid data storage key.
+	ErrCorruptKeyring = errors.New("keyring: corrupt keyring")
+
+	// ErrBadAccessKey is reported by [Read], [VerifyAccessKey], and
+	// [Ring.RekeyVerified] when the access key does not unlock the data storage
+	// key.
+	ErrBadAccessKey = errors.New("keyring: invalid access key")
+
+	// ErrTampered is reported by [Read] and [VerifyAccessKey] when the header
+	// MAC of the stored keyring is missing or does not match its unencrypted
+	// contents.
+	ErrTampered = errors.New("keyring: stored keyring has been tampered with")
+
+	// ErrLegacyFormat is reported by [Read] and [VerifyAccessKey] when the
+	// stored keyring uses format version 1 without a header MAC. Use [Migrate]
+	// to rewrite it in the current format.
+	ErrLegacyFormat = errors.New("keyring: stored keyring uses a legacy format")
+
+	// ErrWrongPassphrase is reported by [Ring.ChangePassphrase] when the old
+	// passphrase does not unlock the data storage key.
+	ErrWrongPassphrase = errors.New("keyring: wrong passphrase")
+
+	// ErrEmptyKey is reported when an empty key is given where a key is
+	// required, as by [New] for an empty initial key.
+	ErrEmptyKey = errors.New("keyring: empty key")
+
+	// ErrUnknownKey is reported when a key ID does not match any key in a
+	// keyring, as by [Ring.Replace] and [Ring.ExportKeyShare].
+	ErrUnknownKey = errors.New("keyring: no such key")
+
+	// ErrDecryptFailed is reported by [Ring.OpenWithActive] and
+	// [View.OpenWithActive] when a ciphertext does not authenticate.
+	ErrDecryptFailed = errors.New("keyring: decryption failed")
+
+	// ErrTooLarge is reported by [Read] and [ReadWith] when the stored keyring
+	// exceeds the maximum size allowed.
+	ErrTooLarge = errors.New("keyring: stored keyring is too large")
+
+	// ErrTooManyKeys is reported when adding a key to a ring that holds its
+	// maximum number of keys, or by [ReadWith] when the stored keyring has
+	// more keys than allowed. See [Config.MaxKeys].
+	ErrTooManyKeys = errors.New("keyring: too many keys")
+
+	// ErrIDCollision is reported when a key cannot be added to a ring with
+	// [Config.DeterministicIDs] set, because the ID derived from its contents
+	// belongs to a different key.
+	ErrIDCollision = errors.New("keyring: key ID collision")
+
+	// ErrWeakKDF is reported by [ReadWith] when the stored keyring derives its
+	// access key with parameters weaker than the caller allows. See
+	// [ReadOptions.MinArgon2Params] and [ReadOptions.MinScryptParams].
+	ErrWeakKDF = errors.New("keyring: key derivation parameters are too weak")
+
+	// ErrUnsupportedVersion is reported by [Read] when the stored keyring uses
+	// a format version or features this package does not support.
+	ErrUnsupportedVersion = errors.New("keyring: unsupported format version")
+
+	// ErrUnknownFlag is reported by [Read] when the header of the stored
+	// keyring sets flags this package does not recognize. It wraps
+	// [ErrUnsupportedVersion].
+	ErrUnknownFlag = fmt.Errorf("%w: unknown header flags", ErrUnsupportedVersion)
+
+	// ErrUnknownSuite is reported by [Read] when the header of the stored
+	// keyring names a cipher suite this package does not support. It wraps
+	// [ErrUnsupportedVersion].
+	ErrUnknownSuite = fmt.Errorf("%w: unknown cipher suite", ErrUnsupportedVersion)
+)
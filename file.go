@@ -0,0 +1,136 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/creachadair/atomicfile"
+	"github.com/creachadair/keyring/internal/packet"
+)
+
+// maxUpdateAttempts is the number of times UpdateFile will try to apply its
+// mutation before giving up due to concurrent changes.
+const maxUpdateAttempts = 10
+
+// errFileChanged is reported by updateFile if the target file was modified
+// after it was read.
+var errFileChanged = errors.New("file changed during update")
+
+// defaultFileMode is the permission mode used by [Ring.Save] when none is
+// given. Keyring files should be readable and writable only by their owner.
+const defaultFileMode = 0600
+
+// Save atomically writes the binary representation of r to the file at path,
+// as [Ring.WriteTo] does, creating it with the given permissions if it does
+// not exist. If perm is 0, Save uses mode 0600. The new contents are written
+// to a temporary file that replaces path only if the write succeeds, so a
+// failed Save does not truncate or corrupt an existing keyring.
+func (r *Ring) Save(path string, perm os.FileMode) error {
+	if perm == 0 {
+		perm = defaultFileMode
+	}
+	return atomicfile.Tx(path, perm, func(w io.Writer) error {
+		_, err := r.WriteTo(w)
+		return err
+	})
+}
+
+// Open opens the named file from fsys and reads a [Ring] from it as [Read]
+// does. If the file cannot be opened, Open returns the error from fsys
+// unchanged, so that (for example) errors.Is(err, fs.ErrNotExist) works.
+func Open(fsys fs.FS, name string, accessKey AccessKeySource) (*Ring, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f, accessKey)
+}
+
+// UpdateFile reads the keyring stored in the file at path, calls mutate to
+// modify it, and atomically replaces the contents of the file with the result.
+// If mutate reports an error, UpdateFile returns that error without modifying
+// the file.
+//
+// To detect concurrent updates, UpdateFile compares the generation counter
+// stored in the file before replacing it. If another writer has replaced the
+// file since it was read, UpdateFile discards its result, re-reads the file,
+// and calls mutate again on the fresh contents. Thus mutate may be called more
+// than once, and must not depend on the ring from a previous call. The ring
+// passed to mutate is closed when UpdateFile returns, so mutate must not
+// retain it.
+//
+// UpdateFile narrows the window for lost updates, but does not provide mutual
+// exclusion: A write that lands between the final check and the replacement
+// of the file can still be lost. Use file locking if that matters.
+func UpdateFile(path string, accessKey AccessKeySource, mutate func(*Ring) error) error {
+	for range maxUpdateAttempts {
+		err := updateFile(path, accessKey, mutate)
+		if !errors.Is(err, errFileChanged) {
+			return err
+		}
+	}
+	return fmt.Errorf("keyring: update %q: %w (%d attempts)", path, errFileChanged, maxUpdateAttempts)
+}
+
+func updateFile(path string, accessKey AccessKeySource, mutate func(*Ring) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	r, err := Read(f, accessKey)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := mutate(r); err != nil {
+		return err
+	}
+	return atomicfile.Tx(path, fi.Mode().Perm(), func(w io.Writer) error {
+		gen, err := fileGeneration(path)
+		if err != nil {
+			return err
+		} else if gen != r.generation {
+			return errFileChanged
+		}
+		_, err = r.WriteTo(w)
+		return err
+	})
+}
+
+// fileGeneration reports the generation counter of the keyring stored in the
+// file at path, or 0 if the keyring does not have a generation counter.
+func fileGeneration(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var gen uint64
+	errFound := errors.New("found generation")
+	_, err = packet.ParseReader(f, func(p packet.Packet) error {
+		if p.Type != packet.GenerationType {
+			return nil
+		}
+		gen, err = packet.ParseGeneration(p.Data)
+		if err != nil {
+			return err
+		}
+		return errFound
+	})
+	if err != nil && err != errFound {
+		return 0, err
+	}
+	return gen, nil
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/creachadair/keyring"
+	"github.com/creachadair/mds/mtest"
+)
+
+// writeTestFile writes a new keyring to a file in a temporary directory, and
+// returns the path of the file along with its access key.
+func writeTestFile(t *testing.T, initialKey string) (string, []byte) {
+	t.Helper()
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{InitialKey: []byte(initialKey), AccessKey: accessKey})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "test.ring")
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("Write keyring: %v", err)
+	}
+	return path, accessKey
+}
+
+func readTestFile(t *testing.T, path string, accessKey []byte) *keyring.Ring {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open keyring: %v", err)
+	}
+	defer f.Close()
+	r, err := keyring.Read(f, keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	return r
+}
+
+func TestUpdateFile(t *testing.T) {
+	t.Run("Basic", func(t *testing.T) {
+		path, accessKey := writeTestFile(t, "apple")
+		var saved *keyring.Ring
+		if err := keyring.UpdateFile(path, keyring.StaticKey(accessKey), func(r *keyring.Ring) error {
+			r.Activate(r.Add([]byte("banana")))
+			saved = r
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateFile failed: %v", err)
+		}
+		mtest.MustPanic(t, func() { saved.Len() }) // closed by UpdateFile
+
+		r := readTestFile(t, path, accessKey)
+		checkHasKeys(t, r, 1, 2)
+		if id, got := r.GetActive(nil); id != 2 || string(got) != "banana" {
+			t.Errorf("Active: got %v, %q, want 2, banana", id, got)
+		}
+	})
+
+	t.Run("MutateError", func(t *testing.T) {
+		path, accessKey := writeTestFile(t, "apple")
+		before, _ := os.ReadFile(path)
+
+		bad := errors.New("bad mutation")
+		err := keyring.UpdateFile(path, keyring.StaticKey(accessKey), func(r *keyring.Ring) error {
+			r.Add([]byte("banana"))
+			return bad
+		})
+		if err != bad {
+			t.Errorf("UpdateFile: got error %v, want %v", err, bad)
+		}
+		if after, _ := os.ReadFile(path); !bytes.Equal(after, before) {
+			t.Error("UpdateFile modified the file after an error")
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		path, accessKey := writeTestFile(t, "apple")
+		akf := keyring.StaticKey(accessKey)
+
+		// The first time the outer mutation runs, another writer adds a key to
+		// the file before the outer update is written. The outer update must
+		// notice and retry, so that neither addition is lost.
+		var calls int
+		if err := keyring.UpdateFile(path, akf, func(r *keyring.Ring) error {
+			calls++
+			if calls == 1 {
+				if err := keyring.UpdateFile(path, akf, func(r *keyring.Ring) error {
+					r.Add([]byte("banana"))
+					return nil
+				}); err != nil {
+					t.Fatalf("Inner UpdateFile failed: %v", err)
+				}
+			}
+			r.Add([]byte("cherry"))
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateFile failed: %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("Mutate called %d times, want 2", calls)
+		}
+
+		r := readTestFile(t, path, accessKey)
+		checkHasKeys(t, r, 1, 2, 3)
+		if got := string(r.Get(2, nil)); got != "banana" {
+			t.Errorf("Key 2: got %q, want banana", got)
+		}
+		if got := string(r.Get(3, nil)); got != "cherry" {
+			t.Errorf("Key 3: got %q, want cherry", got)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "nonesuch.ring")
+		err := keyring.UpdateFile(path, keyring.StaticKey(nil), func(*keyring.Ring) error { return nil })
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("UpdateFile: got error %v, want %v", err, os.ErrNotExist)
+		}
+	})
+}
+
+func TestOpen(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{InitialKey: []byte("apple"), AccessKey: accessKey})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	fsys := fstest.MapFS{"keys/test.ring": {Data: data}}
+
+	r2, err := keyring.Open(fsys, "keys/test.ring", keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if got := string(r2.Get(1, nil)); got != "apple" {
+		t.Errorf("Get(1): got %q, want %q", got, "apple")
+	}
+
+	if _, err := keyring.Open(fsys, "nonesuch.ring", keyring.StaticKey(accessKey)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open missing file: got %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestSave(t *testing.T) {
+	path, accessKey := writeTestFile(t, "apple")
+	r := readTestFile(t, path, accessKey)
+	id := r.Add([]byte("pear"))
+
+	if err := r.Save(path, 0); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	r2 := readTestFile(t, path, accessKey)
+	if got := string(r2.Get(id, nil)); got != "pear" {
+		t.Errorf("Get(%v): got %q, want %q", id, got, "pear")
+	}
+
+	// A new file gets the default permissions.
+	newPath := filepath.Join(t.TempDir(), "new.ring")
+	if err := r.Save(newPath, 0); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if fi, err := os.Stat(newPath); err != nil {
+		t.Fatalf("Stat: %v", err)
+	} else if got := fi.Mode().Perm(); got != 0600 {
+		t.Errorf("Save: got mode %v, want %v", got, os.FileMode(0600))
+	}
+}
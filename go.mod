@@ -10,9 +10,7 @@ require (
 	github.com/creachadair/mds v0.30.4
 	github.com/google/go-cmp v0.7.0
 	golang.org/x/crypto v0.54.0
+	golang.org/x/sys v0.47.0
 )
 
-require (
-	golang.org/x/sys v0.47.0 // indirect
-	golang.org/x/term v0.45.0 // indirect
-)
+require golang.org/x/term v0.45.0 // indirect
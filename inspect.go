@@ -0,0 +1,288 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/creachadair/keyring/internal/packet"
+)
+
+// Info describes the unencrypted metadata of a stored keyring.
+// It does not contain any secret material.
+type Info struct {
+	// The format version byte from the header of the keyring.
+	FormatVersion byte
+
+	// The reserved bytes from the header of the keyring.
+	Reserved [2]byte
+
+	// The cipher used to encrypt the keyring, as recorded in its header. This
+	// may not be a cipher supported by this package.
+	Cipher Cipher
+
+	// The generation counter of the keyring, or 0 if it has none.
+	Generation uint64
+
+	// The access key generation salt, or nil if the keyring has none. If the
+	// keyring has several access keys, this is the salt of the first.
+	AccessKeySalt []byte
+
+	// The Argon2id parameters for the access key, or nil if the keyring has
+	// none. See [Argon2idKey].
+	Argon2Params *Argon2Params
+
+	// The scrypt parameters for the access key, or nil if the keyring has
+	// none. See [ScryptKey].
+	ScryptParams *ScryptParams
+
+	// The threshold sharing parameters for the access key, or nil if the
+	// keyring has none. See [NewShared].
+	Threshold *ThresholdParams
+
+	// The labels of the wrapping keys of the keyring, in storage order, or nil
+	// if it has none. See [Ring.AddWrappedKey].
+	WrappedKeyLabels []string
+
+	// The top-level packets of the keyring, in storage order.
+	Packets []PacketInfo
+}
+
+// PacketInfo describes a top-level packet in the encoding of a keyring.
+type PacketInfo struct {
+	Type string // the name of the packet type
+	Len  int    // the length of the packet contents in bytes
+}
+
+// Inspect parses the binary representation of a keyring from r, and reports
+// its unencrypted metadata. It does not require an access key, and does not
+// decrypt anything. It consumes r to EOF but does not buffer the whole input.
+//
+// Inspect reports an error if the input is not structurally valid, but does
+// not check the format version or reserved bytes, so that a caller can use
+// the result to decide how to handle versions this package does not support.
+func Inspect(r io.Reader) (*Info, error) {
+	var info Info
+	hdr, err := packet.ParseReader(r, func(p packet.Packet) error {
+		info.Packets = append(info.Packets, PacketInfo{Type: p.Type.String(), Len: len(p.Data)})
+		switch p.Type {
+		case packet.AccessKeySaltType:
+			if info.AccessKeySalt == nil {
+				info.AccessKeySalt = bytes.Clone(p.Data)
+			}
+		case packet.Argon2ParamsType:
+			params, err := parseArgon2Params(p.Data)
+			if err != nil {
+				return err
+			}
+			info.Argon2Params = params
+		case packet.ScryptParamsType:
+			params, err := parseScryptParams(p.Data)
+			if err != nil {
+				return err
+			}
+			info.ScryptParams = params
+		case packet.ThresholdType:
+			params, err := parseThreshold(p.Data)
+			if err != nil {
+				return err
+			}
+			info.Threshold = params
+		case packet.WrappedKeyType:
+			label, _, err := packet.ParseWrappedKey(p.Data)
+			if err != nil {
+				return fmt.Errorf("wrapped data key: %w", err)
+			}
+			info.WrappedKeyLabels = append(info.WrappedKeyLabels, label)
+		case packet.GenerationType:
+			gen, err := packet.ParseGeneration(p.Data)
+			if err != nil {
+				return fmt.Errorf("generation: %w", err)
+			}
+			info.Generation = gen
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("inspect keyring: %w", err)
+	}
+	info.FormatVersion = hdr.Version
+	info.Reserved = hdr.Reserved
+	info.Cipher = Cipher(hdr.Suite())
+	return &info, nil
+}
+
+// PacketTypes parses the binary representation of a keyring from data, and
+// returns the names of its top-level packet types in storage order. Unknown
+// packet types are named UNKNOWN_TYPE_n, where n is the type code. It does
+// not decrypt anything, nor check the format version or reserved bytes.
+//
+// PacketTypes is a lightweight alternative to [Inspect] for diagnostics.
+// If data are not structurally valid, PacketTypes reports an error along with
+// the names of the packets parsed before the error occurred.
+func PacketTypes(data []byte) ([]string, error) {
+	rk, err := packet.ParseKeyring(data)
+	var types []string
+	for _, p := range rk.Packets {
+		types = append(types, p.Type.String())
+	}
+	if err != nil {
+		return types, fmt.Errorf("parse keyring: %w", err)
+	}
+	return types, nil
+}
+
+// RecipientSalts parses the binary representation of a keyring from r, and
+// returns the access key generation salt for each data key packet in storage
+// order. The salt for a data key is nil if it has none. It does not decrypt
+// anything, and it consumes r to EOF.
+//
+// Each data key packet is paired with the access key salt packet that follows
+// it, before the next data key packet. A salt that precedes all the data keys
+// is paired with the first data key. A keyring written by this package has a
+// single data key, so the result has one element; keyrings with several data
+// keys (one per recipient) report each recipient's salt separately. Salts are
+// not secret, so this is safe to use for diagnostics.
+func RecipientSalts(r io.Reader) ([][]byte, error) {
+	var salts [][]byte
+	var pending []byte // salt seen before any data key
+	_, err := packet.ParseReader(r, func(p packet.Packet) error {
+		switch p.Type {
+		case packet.DataKeyType:
+			salts = append(salts, nil)
+			if pending != nil {
+				salts[0], pending = pending, nil
+			}
+		case packet.AccessKeySaltType:
+			if len(salts) == 0 {
+				pending = bytes.Clone(p.Data)
+			} else {
+				salts[len(salts)-1] = bytes.Clone(p.Data)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("inspect keyring: %w", err)
+	}
+	return salts, nil
+}
+
+// A Decoder parses the top-level packets of stored keyrings without
+// decrypting anything. A Decoder reuses its storage from one call to the
+// next, which reduces allocation when parsing many keyrings, for example in
+// a bulk audit. The zero value is ready for use, and has no limits. A
+// Decoder is not safe for concurrent use by multiple goroutines.
+type Decoder struct {
+	// If positive, the maximum number of top-level packets. An input with
+	// more packets is rejected with an error wrapping [ErrTooLarge].
+	MaxPackets int
+
+	// If positive, the maximum size of the input in bytes. A larger input is
+	// rejected with an error wrapping [ErrTooLarge].
+	MaxSize int
+
+	pkts    []packet.Packet
+	decoded []RawPacket
+}
+
+// Decoded is the result of a successful call to [Decoder.Decode].
+type Decoded struct {
+	FormatVersion byte        // the format version byte from the header
+	Reserved      [2]byte     // the reserved bytes from the header
+	Packets       []RawPacket // the top-level packets in storage order
+}
+
+// A RawPacket is a top-level packet in the encoding of a keyring.
+type RawPacket struct {
+	Type   string // the name of the packet type (see [PacketTypes])
+	Code   byte   // the packet type code
+	Offset int    // the byte offset of the packet in the input
+	Data   []byte // the packet contents, aliasing the input (see also [ScanPackets])
+}
+
+// ScanPackets parses the binary representation of a keyring from r, and
+// calls visit for each top-level packet in storage order. Like [Inspect], it
+// does not decrypt anything, does not buffer the whole input, and does not
+// check the format version, reserved bytes, or packet types. If visit reports
+// an error, scanning stops and ScanPackets returns that error unchanged.
+// Otherwise ScanPackets consumes r to EOF, and reports an error if the input
+// is not structurally valid.
+//
+// The Data field of each packet passed to visit aliases a buffer that is
+// reused for subsequent packets. The visit function must copy the data if it
+// needs them after it returns.
+func ScanPackets(r io.Reader, visit func(RawPacket) error) error {
+	var visitErr error
+	pos := 4 // the header
+	_, err := packet.ParseReader(r, func(p packet.Packet) error {
+		rp := RawPacket{Type: p.Type.String(), Code: byte(p.Type), Offset: pos, Data: p.Data}
+		pos += 4 + len(p.Data)
+		visitErr = visit(rp)
+		return visitErr
+	})
+	if visitErr != nil {
+		return visitErr
+	} else if err != nil {
+		return fmt.Errorf("keyring: scan packets: %w", err)
+	}
+	return nil
+}
+
+// A ParseError reports a structural error in the encoding of a keyring,
+// at a byte offset of the input.
+type ParseError struct {
+	Offset int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("keyring: parse error at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Decode parses the binary representation of a keyring from data, and reports
+// its header and top-level packets. Like [Inspect], it does not check the
+// format version, reserved bytes, or packet types. If data are not
+// structurally valid, Decode reports an error of concrete type [*ParseError].
+//
+// The Data fields of the packets alias data, and the Packets slice of the
+// result is reused by the next call to Decode.
+func (d *Decoder) Decode(data []byte) (Decoded, error) {
+	if d.MaxSize > 0 && len(data) > d.MaxSize {
+		return Decoded{}, &ParseError{
+			Offset: d.MaxSize,
+			Err:    fmt.Errorf("%w: input is %d bytes, maximum is %d", ErrTooLarge, len(data), d.MaxSize),
+		}
+	} else if len(data) < 4 {
+		return Decoded{}, &ParseError{Offset: len(data), Err: errors.New("header truncated")}
+	} else if data[0] != packet.MagicByte {
+		return Decoded{}, &ParseError{Offset: 0, Err: errors.New("invalid header")}
+	}
+	pkts, err := packet.AppendPackets(d.pkts[:0], data[4:], 4, d.MaxPackets)
+	d.pkts = pkts
+	if oe, ok := err.(*packet.OffsetError); ok {
+		if errors.Is(oe.Err, packet.ErrTooManyPackets) {
+			return Decoded{}, &ParseError{Offset: oe.Offset, Err: fmt.Errorf("%w: %w", ErrTooLarge, oe.Err)}
+		}
+		return Decoded{}, &ParseError{Offset: oe.Offset, Err: oe.Err}
+	}
+
+	out := Decoded{FormatVersion: data[1], Reserved: [2]byte{data[2], data[3]}, Packets: d.decoded[:0]}
+	pos := 4
+	for _, p := range pkts {
+		out.Packets = append(out.Packets, RawPacket{
+			Type:   p.Type.String(),
+			Code:   byte(p.Type),
+			Offset: pos,
+			Data:   p.Data,
+		})
+		pos += 4 + len(p.Data)
+	}
+	d.decoded = out.Packets
+	return out, nil
+}
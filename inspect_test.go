@@ -0,0 +1,325 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/creachadair/keyring"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestInspect(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("wharrgarbl"),
+		AccessKey:     randomBytes(keyring.AccessKeyLen),
+		AccessKeySalt: []byte("kosher"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		info, err := keyring.Inspect(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Inspect failed: %v", err)
+		}
+		want := &keyring.Info{
+			FormatVersion: keyring.CurrentFormat,
+			Generation:    1,
+			AccessKeySalt: []byte("kosher"),
+			Packets: []keyring.PacketInfo{
+				{Type: "DATA_KEY"},
+				{Type: "ACCESS_KEY_SALT", Len: 6},
+				{Type: "GENERATION", Len: 8},
+				{Type: "HEADER_MAC", Len: 32},
+				{Type: "BUNDLE"},
+			},
+		}
+		opt := cmpopts.IgnoreFields(keyring.PacketInfo{}, "Len")
+		if diff := cmp.Diff(info, want, opt); diff != "" {
+			t.Errorf("Inspect (-got, +want):\n%s", diff)
+		}
+	})
+
+	t.Run("Version", func(t *testing.T) {
+		// Inspect reports the header bytes without validating them.
+		data := bytes.Clone(buf.Bytes())
+		data[1], data[2], data[3] = 99, 1, 2
+		info, err := keyring.Inspect(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Inspect failed: %v", err)
+		}
+		if info.FormatVersion != 99 || info.Reserved != [2]byte{1, 2} {
+			t.Errorf("Inspect: got version %d, reserved %v; want 99, [1 2]", info.FormatVersion, info.Reserved)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := keyring.Inspect(bytes.NewReader([]byte("not a keyring")))
+		checkError(t, "Inspect", err, "invalid header")
+	})
+}
+
+func TestPacketTypes(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("bits and bobs"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	want := []string{"DATA_KEY", "GENERATION", "HEADER_MAC", "BUNDLE"}
+
+	t.Run("OK", func(t *testing.T) {
+		got, err := keyring.PacketTypes(buf.Bytes())
+		if err != nil {
+			t.Fatalf("PacketTypes failed: %v", err)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("PacketTypes (-got, +want):\n%s", diff)
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		data := append(bytes.Clone(buf.Bytes()), 99, 0, 0, 0)
+		got, err := keyring.PacketTypes(data)
+		if err != nil {
+			t.Fatalf("PacketTypes failed: %v", err)
+		}
+		if diff := cmp.Diff(got, append(want, "UNKNOWN_TYPE_99")); diff != "" {
+			t.Errorf("PacketTypes (-got, +want):\n%s", diff)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		data := append(bytes.Clone(buf.Bytes()), 2, 0, 0, 5)
+		got, err := keyring.PacketTypes(data)
+		if err == nil {
+			t.Fatalf("PacketTypes: got %q, want error", got)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("PacketTypes partial (-got, +want):\n%s", diff)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := keyring.PacketTypes([]byte("not a keyring"))
+		checkError(t, "PacketTypes", err, "invalid header")
+	})
+}
+
+func TestRecipientSalts(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("pass the salt"),
+		AccessKey:     randomBytes(keyring.AccessKeyLen),
+		AccessKeySalt: []byte("NaCl"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+
+	got, err := keyring.RecipientSalts(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("RecipientSalts failed: %v", err)
+	}
+	if diff := cmp.Diff(got, [][]byte{[]byte("NaCl")}); diff != "" {
+		t.Errorf("RecipientSalts (-got, +want):\n%s", diff)
+	}
+
+	// Construct a keyring header with several data keys, some with salts.
+	// The contents of the data key packets do not matter here.
+	data := []byte{0xec, 1, 0, 0,
+		3, 0, 0, 1, 'A', // salt before the first data key
+		2, 0, 0, 1, '1',
+		2, 0, 0, 1, '2', // no salt
+		2, 0, 0, 1, '3',
+		7, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 1, // generation
+		3, 0, 0, 2, 'C', 'C',
+	}
+	got, err = keyring.RecipientSalts(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("RecipientSalts failed: %v", err)
+	}
+	if diff := cmp.Diff(got, [][]byte{[]byte("A"), nil, []byte("CC")}); diff != "" {
+		t.Errorf("RecipientSalts (-got, +want):\n%s", diff)
+	}
+
+	if _, err := keyring.RecipientSalts(bytes.NewReader([]byte("not a keyring"))); err == nil {
+		t.Error("RecipientSalts: got nil, want error")
+	}
+}
+
+func TestNoSalt(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("saltless"),
+		AccessKey:  accessKey,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+
+	// No salt packet is stored.
+	info, err := keyring.Inspect(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	for _, p := range info.Packets {
+		if p.Type == "ACCESS_KEY_SALT" {
+			t.Errorf("Found unexpected salt packet (%d bytes)", p.Len)
+		}
+	}
+
+	// The access key function receives a nil salt.
+	if _, err := keyring.Read(&buf, keyring.AccessKeyFunc(func(salt []byte) ([]byte, error) {
+		if salt != nil {
+			t.Errorf("Got salt %q, want nil", salt)
+		}
+		return accessKey, nil
+	})); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("wharrgarbl"),
+		AccessKey:     randomBytes(keyring.AccessKeyLen),
+		AccessKeySalt: []byte("kosher"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	wantTypes, err := keyring.PacketTypes(data)
+	if err != nil {
+		t.Fatalf("PacketTypes failed: %v", err)
+	}
+
+	var d keyring.Decoder
+	for range 2 { // the second call reuses storage
+		got, err := d.Decode(data)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if got.FormatVersion != keyring.CurrentFormat {
+			t.Errorf("FormatVersion: got %d, want %d", got.FormatVersion, keyring.CurrentFormat)
+		}
+		var types []string
+		for _, p := range got.Packets {
+			types = append(types, p.Type)
+
+			// Each packet's offset locates its header in the input.
+			if int(data[p.Offset]) != int(p.Code) || !bytes.Equal(data[p.Offset+4:p.Offset+4+len(p.Data)], p.Data) {
+				t.Errorf("Packet %s at offset %d does not match the input", p.Type, p.Offset)
+			}
+		}
+		if diff := cmp.Diff(wantTypes, types); diff != "" {
+			t.Errorf("Packet types (-want, +got):\n%s", diff)
+		}
+	}
+
+	checkParseError := func(t *testing.T, d *keyring.Decoder, data []byte, offset int, target error) {
+		t.Helper()
+		_, err := d.Decode(data)
+		var perr *keyring.ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("Decode: got %v, want *ParseError", err)
+		}
+		if perr.Offset != offset {
+			t.Errorf("Decode: got offset %d, want %d (%v)", perr.Offset, offset, err)
+		}
+		if target != nil && !errors.Is(err, target) {
+			t.Errorf("Decode: got %v, want %v", err, target)
+		}
+	}
+	t.Run("Truncated", func(t *testing.T) {
+		good, _ := d.Decode(data)
+		last := good.Packets[len(good.Packets)-1].Offset
+		checkParseError(t, &d, data[:len(data)-1], last+4, nil)
+		checkParseError(t, &d, append(bytes.Clone(data), 1), len(data), nil)
+	})
+	t.Run("BadHeader", func(t *testing.T) {
+		checkParseError(t, &d, []byte("\x00\x01\x00\x00"), 0, nil)
+	})
+	t.Run("MaxSize", func(t *testing.T) {
+		checkParseError(t, &keyring.Decoder{MaxSize: 10}, data, 10, keyring.ErrTooLarge)
+	})
+	t.Run("MaxPackets", func(t *testing.T) {
+		first, _ := d.Decode(data)
+		checkParseError(t, &keyring.Decoder{MaxPackets: 1}, data, first.Packets[1].Offset, keyring.ErrTooLarge)
+	})
+}
+
+func TestScanPackets(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("wharrgarbl"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	want, err := new(keyring.Decoder).Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// The scanned packets match the decoded ones, if copied.
+	var got []keyring.RawPacket
+	if err := keyring.ScanPackets(bytes.NewReader(data), func(p keyring.RawPacket) error {
+		p.Data = bytes.Clone(p.Data)
+		got = append(got, p)
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanPackets failed: %v", err)
+	}
+	if diff := cmp.Diff(want.Packets, got); diff != "" {
+		t.Errorf("Packets (-want, +got):\n%s", diff)
+	}
+
+	// An error from visit stops the scan and is returned unchanged.
+	stop := errors.New("stop")
+	var n int
+	if err := keyring.ScanPackets(bytes.NewReader(data), func(keyring.RawPacket) error {
+		n++
+		return stop
+	}); err != stop {
+		t.Errorf("ScanPackets: got %v, want %v", err, stop)
+	}
+	if n != 1 {
+		t.Errorf("ScanPackets visited %d packets after an error, want 1", n)
+	}
+
+	if err := keyring.ScanPackets(bytes.NewReader(data[:len(data)-1]), func(keyring.RawPacket) error {
+		return nil
+	}); err == nil {
+		t.Error("ScanPackets of truncated input: got nil error")
+	}
+}
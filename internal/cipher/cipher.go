@@ -1,17 +1,25 @@
 // Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
 
 // Package cipher implements symmetric encryption helpers for keyrings.
-// The underlying cryptography is implemented by [chacha20poly1305].
+// By default the underlying cryptography is implemented by [chacha20poly1305];
+// AES-256-GCM is also supported (see [Suite]).
 package cipher
 
 import (
+	"crypto/aes"
+	stdcipher "crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
 	crand "crypto/rand"
+	"crypto/sha256"
 	"crypto/sha3"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
 )
 
 // KeyLen defines the key length in bytes of an encryption key.
@@ -25,24 +33,64 @@ func GenerateKey(keyBytes int) []byte {
 	return pkey
 }
 
+// Suite identifies an AEAD construction used to encrypt keyring contents.
+type Suite byte
+
+const (
+	XChaCha20Poly1305 Suite = 0 // the default
+	AES256GCM         Suite = 1
+)
+
+// IsValid reports whether s is a known cipher suite.
+func (s Suite) IsValid() bool { return s == XChaCha20Poly1305 || s == AES256GCM }
+
+func (s Suite) String() string {
+	switch s {
+	case XChaCha20Poly1305:
+		return "XChaCha20-Poly1305"
+	case AES256GCM:
+		return "AES-256-GCM"
+	default:
+		return fmt.Sprintf("Suite(%d)", byte(s))
+	}
+}
+
+// newAEAD constructs an AEAD for suite s with the given key.
+func (s Suite) newAEAD(key []byte) (stdcipher.AEAD, error) {
+	switch s {
+	case XChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	case AES256GCM:
+		if len(key) != KeyLen {
+			return nil, fmt.Errorf("aes256gcm: bad key length %d", len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return stdcipher.NewGCM(block)
+	default:
+		return nil, fmt.Errorf("unknown cipher suite %v", s)
+	}
+}
+
 // GenerateAndEncryptKey generates a cryptographically-random key of the
 // specified length and encrypts it with the specified access key.
 // The plaintext and ciphertext of the key are both returned.
-func GenerateAndEncryptKey(accessKey []byte, n int) (plain, encrypted []byte, _ error) {
+func (s Suite) GenerateAndEncryptKey(accessKey []byte, n int) (plain, encrypted []byte, _ error) {
 	pkey := GenerateKey(n)
-	_, ekey, err := EncryptWithKey(accessKey, pkey, nil)
+	_, ekey, err := s.EncryptWithKey(accessKey, pkey, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("encrypt key: %w", err)
 	}
 	return pkey, ekey, nil
 }
 
-// EncryptWithKey encrypts data using a [cipher.AEAD] over [chacha20poly1305]
-// with the specified key and extra data. It returns the length of the AEAD
-// nonce along with the encrypted result. The nonce occupies a prefix of the
-// encrypted result.
-func EncryptWithKey(key, data, extra []byte) (int, []byte, error) {
-	aead, err := chacha20poly1305.NewX(key)
+// EncryptWithKey encrypts data using the AEAD for s with the specified key and
+// extra data. It returns the length of the AEAD nonce along with the encrypted
+// result. The nonce occupies a prefix of the encrypted result.
+func (s Suite) EncryptWithKey(key, data, extra []byte) (int, []byte, error) {
+	aead, err := s.newAEAD(key)
 	if err != nil {
 		return 0, nil, fmt.Errorf("initialize cipher: %w", err)
 	}
@@ -57,10 +105,41 @@ func EncryptWithKey(key, data, extra []byte) (int, []byte, error) {
 	return aead.NonceSize(), aead.Seal(buf, buf, data, extra), nil
 }
 
-// DecryptWithKey decrypts data using a [cipher.AEAD] over [chacha20poly1305]
-// with the specified key and extra data.
-func DecryptWithKey(key, data, extra []byte) ([]byte, error) {
-	aead, err := chacha20poly1305.NewX(key)
+// EncryptDeterministic encrypts data using the AEAD for s with the specified
+// key and extra data, as [Suite.EncryptWithKey] does, except that the nonce is
+// derived from the key, data, and extra data rather than chosen at random.
+// Encrypting the same inputs always yields the same output, and the result
+// can be decrypted by [Suite.DecryptWithKey].
+//
+// The nonce is an HMAC-SHA256 of the extra data and data, keyed with a subkey
+// derived from key by HKDF, and truncated to the nonce size of the AEAD. Thus
+// distinct inputs get distinct nonces unless the truncated HMACs collide.
+func (s Suite) EncryptDeterministic(key, data, extra []byte) (int, []byte, error) {
+	aead, err := s.newAEAD(key)
+	if err != nil {
+		return 0, nil, fmt.Errorf("initialize cipher: %w", err)
+	}
+	nkey, err := hkdf.Key(sha256.New, key, nil, "keyring deterministic nonce", sha256.Size)
+	if err != nil {
+		return 0, nil, fmt.Errorf("derive nonce key: %w", err)
+	}
+	defer clear(nkey)
+	h := hmac.New(sha256.New, nkey)
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(extra)))
+	h.Write(n[:]) // so that extra and data cannot be shifted between
+	h.Write(extra)
+	h.Write(data)
+
+	buf := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	copy(buf, h.Sum(nil))
+	return aead.NonceSize(), aead.Seal(buf, buf, data, extra), nil
+}
+
+// DecryptWithKey decrypts data using the AEAD for s with the specified key and
+// extra data.
+func (s Suite) DecryptWithKey(key, data, extra []byte) ([]byte, error) {
+	aead, err := s.newAEAD(key)
 	if err != nil {
 		return nil, fmt.Errorf("initialize cipher: %w", err)
 	}
@@ -71,6 +150,33 @@ func DecryptWithKey(key, data, extra []byte) ([]byte, error) {
 	return aead.Open(nil, nonce, ctext, extra)
 }
 
+// GenerateAndEncryptKey calls [Suite.GenerateAndEncryptKey] for
+// [XChaCha20Poly1305].
+func GenerateAndEncryptKey(accessKey []byte, n int) (plain, encrypted []byte, _ error) {
+	return XChaCha20Poly1305.GenerateAndEncryptKey(accessKey, n)
+}
+
+// EncryptWithKey encrypts data using a [cipher.AEAD] over [chacha20poly1305]
+// with the specified key and extra data, as [Suite.EncryptWithKey].
+func EncryptWithKey(key, data, extra []byte) (int, []byte, error) {
+	return XChaCha20Poly1305.EncryptWithKey(key, data, extra)
+}
+
+// DecryptWithKey decrypts data using a [cipher.AEAD] over [chacha20poly1305]
+// with the specified key and extra data.
+func DecryptWithKey(key, data, extra []byte) ([]byte, error) {
+	return XChaCha20Poly1305.DecryptWithKey(key, data, extra)
+}
+
+// Parameters for the argon2id key derivation used by [KeyFromPassphrase].
+// Adapted from:
+// https://cheatsheetseries.owasp.org/cheatsheets/Password_Storage_Cheat_Sheet.html#argon2id
+const (
+	PassphraseTime    = 3
+	PassphraseMemory  = 16 * 1024 // KiB
+	PassphraseThreads = 1
+)
+
 // KeyFromPassphrase returns a cryptographic key of n bytes, derived via
 // [argon2.IDKey] from the specified passphrase and a random salt.
 // If salt == nil, a new random salt is generated and returned; otherwise the
@@ -80,12 +186,44 @@ func KeyFromPassphrase(passphrase string, n int, salt []byte) (_key, _salt []byt
 		salt = make([]byte, 16)
 		crand.Read(salt)
 	}
-	// Parameters adapted from:
-	// https://cheatsheetseries.owasp.org/cheatsheets/Password_Storage_Cheat_Sheet.html#argon2id
-	key := argon2.IDKey([]byte(passphrase), salt, 3, 16*1024, 1, uint32(n))
+	key := argon2.IDKey([]byte(passphrase), salt, PassphraseTime, PassphraseMemory, PassphraseThreads, uint32(n))
 	return key, salt
 }
 
+// KeyFromArgon2id returns a cryptographic key of n bytes, derived via
+// [argon2.IDKey] from the specified passphrase and salt with the given time,
+// memory (in KiB), and thread parameters.
+func KeyFromArgon2id(passphrase string, n int, salt []byte, time, memory uint32, threads uint8) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, time, memory, threads, uint32(n))
+}
+
+// KeyFromScrypt returns a cryptographic key of n bytes, derived via
+// [scrypt.Key] from the specified passphrase and salt with the given cost
+// parameters.
+func KeyFromScrypt(passphrase string, n int, salt []byte, costN, r, p int) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, costN, r, p, n)
+}
+
+// MACKeyLen is the length in bytes of a MAC key and of a MAC.
+const MACKeyLen = sha256.Size
+
+// MACKey derives a key for [MAC] from dataKey using HKDF, so that the data
+// key itself is not used for more than one purpose.
+func MACKey(dataKey []byte) []byte {
+	key, err := hkdf.Key(sha256.New, dataKey, nil, "keyring header MAC", MACKeyLen)
+	if err != nil {
+		panic("cipher: derive MAC key: " + err.Error()) // cannot happen for this length
+	}
+	return key
+}
+
+// MAC returns the HMAC-SHA256 of data with the given key.
+func MAC(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
 // KeyFingerprintString reports a human-readable cryptographic fingerprint for a key.
 func KeyFingerprintString(key []byte) string {
 	fp := sha3.Sum256(key)
@@ -0,0 +1,205 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package cipher
+
+import (
+	stdcipher "crypto/cipher"
+	"crypto/hkdf"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Framed encryption
+//
+// A framed stream splits its plaintext into frames of a fixed size (the last
+// frame may be shorter, or empty), and seals each frame separately with the
+// AEAD for a [Suite]. Each stream has its own key, derived by HKDF-SHA256
+// from the caller's key and a random 32-byte salt, so that the nonces of
+// different streams sealed with the same caller's key cannot collide. This
+// matters for AES-256-GCM, whose nonces are too short to choose at random for
+// every frame of a long-lived key.
+//
+// The nonce for each frame is zero, followed by a 4-byte big-endian frame
+// counter starting from 0, followed by a byte that is 1 for the last frame and
+// 0 otherwise:
+//
+//	[ 0... | <counter> | <last> ]
+//
+// The counter and last byte ensure that frames cannot be reordered, dropped,
+// or truncated without detection. A stream has at most 2^32 frames. The salt
+// is stored before the ciphertext of the first frame:
+//
+//	frame 0:   [ <salt> | <sealed frame 0> ]
+//	frame i>0: [ <sealed frame i> ]
+
+// nonceTail is the length of the nonce suffix holding the counter and flag.
+const nonceTail = 5
+
+// streamSaltLen is the length in bytes of the salt for a stream key.
+const streamSaltLen = 32
+
+// streamAEAD returns the AEAD for suite s with the stream key derived from
+// key and salt.
+func (s Suite) streamAEAD(key, salt []byte) (stdcipher.AEAD, error) {
+	skey, err := hkdf.Key(sha256.New, key, salt, "keyring stream frame key", KeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("derive stream key: %w", err)
+	}
+	defer clear(skey)
+	return s.newAEAD(skey)
+}
+
+// A FrameWriter encrypts a stream of plaintext in fixed-size frames. Each
+// sealed frame is passed to an emit function as soon as it is complete, so
+// that the stream need not be buffered in memory.
+type FrameWriter struct {
+	aead   stdcipher.AEAD
+	salt   []byte // stored before the first frame
+	nonce  []byte // 0... | counter | last
+	ctr    uint64
+	buf    []byte // pending plaintext, up to frameSize bytes
+	size   int    // plaintext frame size
+	out    []byte // scratch buffer for sealed frames
+	emit   func([]byte) error
+	closed bool
+}
+
+// NewFrameWriter constructs a [FrameWriter] that seals frames of frameSize
+// bytes with key, and passes each sealed frame to emit. The slice passed to
+// emit is only valid until emit returns. It will panic if frameSize ≤ 0.
+func (s Suite) NewFrameWriter(key []byte, frameSize int, emit func(frame []byte) error) (*FrameWriter, error) {
+	if frameSize <= 0 {
+		panic("cipher: frame size must be positive")
+	}
+	salt := make([]byte, streamSaltLen)
+	if _, err := crand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	aead, err := s.streamAEAD(key, salt)
+	if err != nil {
+		return nil, fmt.Errorf("initialize cipher: %w", err)
+	}
+	return &FrameWriter{
+		aead:  aead,
+		salt:  salt,
+		nonce: make([]byte, aead.NonceSize()),
+		buf:   make([]byte, 0, frameSize),
+		size:  frameSize,
+		emit:  emit,
+	}, nil
+}
+
+// Write adds data to the stream, sealing and emitting each frame as it fills.
+// It reports an error if w is closed, or if emit reports an error.
+func (w *FrameWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed frame writer")
+	}
+	var nw int
+	for len(data) != 0 {
+		// Seal a full frame only once more data arrive, since the last frame
+		// must be marked as such.
+		if len(w.buf) == w.size {
+			if err := w.seal(false); err != nil {
+				return nw, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):w.size], data)
+		w.buf = w.buf[:len(w.buf)+n]
+		data = data[n:]
+		nw += n
+	}
+	return nw, nil
+}
+
+// Close seals and emits the last frame of the stream, and zeroes the
+// plaintext buffered by w. Calling Close more than once has no effect.
+func (w *FrameWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer clear(w.buf[:cap(w.buf)])
+	return w.seal(true)
+}
+
+func (w *FrameWriter) seal(last bool) error {
+	if w.ctr > math.MaxUint32 {
+		return errors.New("stream has too many frames")
+	}
+	binary.BigEndian.PutUint32(w.nonce[len(w.nonce)-nonceTail:], uint32(w.ctr))
+	w.nonce[len(w.nonce)-1] = boolByte(last)
+	out := w.out[:0]
+	if w.ctr == 0 {
+		out = append(out, w.salt...)
+	}
+	out = w.aead.Seal(out, w.nonce, w.buf, nil)
+	w.out = out
+	w.ctr++
+	clear(w.buf)
+	w.buf = w.buf[:0]
+	return w.emit(out)
+}
+
+// A FrameReader decrypts the frames of a stream written by a [FrameWriter].
+type FrameReader struct {
+	suite Suite
+	key   []byte         // until the first frame is opened
+	aead  stdcipher.AEAD // after the first frame is opened
+	nonce []byte         // 0... | counter | last
+	ctr   uint64
+	done  bool
+}
+
+// NewFrameReader constructs a [FrameReader] that opens frames sealed with key.
+// The reader retains key until it opens the first frame.
+func (s Suite) NewFrameReader(key []byte) (*FrameReader, error) {
+	if _, err := s.newAEAD(key); err != nil {
+		return nil, fmt.Errorf("initialize cipher: %w", err)
+	}
+	return &FrameReader{suite: s, key: key}, nil
+}
+
+// Open decrypts the next frame of the stream, and appends its plaintext to
+// buf, returning the updated slice. The caller must set last to true for the
+// final frame of the stream, and only for that frame. Open reports an error
+// if frame is not the next authentic frame of the stream.
+func (r *FrameReader) Open(buf, frame []byte, last bool) ([]byte, error) {
+	if r.done {
+		return nil, errors.New("frame after the end of the stream")
+	}
+	if r.aead == nil {
+		if len(frame) < streamSaltLen {
+			return nil, fmt.Errorf("short stream salt (%d < %d)", len(frame), streamSaltLen)
+		}
+		aead, err := r.suite.streamAEAD(r.key, frame[:streamSaltLen])
+		if err != nil {
+			return nil, err
+		}
+		r.aead, r.key = aead, nil
+		r.nonce = make([]byte, aead.NonceSize())
+		frame = frame[streamSaltLen:]
+	} else if r.ctr > math.MaxUint32 {
+		return nil, errors.New("stream has too many frames")
+	}
+	binary.BigEndian.PutUint32(r.nonce[len(r.nonce)-nonceTail:], uint32(r.ctr))
+	r.nonce[len(r.nonce)-1] = boolByte(last)
+	out, err := r.aead.Open(buf, r.nonce, frame, nil)
+	if err != nil {
+		return nil, fmt.Errorf("frame %d: %w", r.ctr, err)
+	}
+	r.ctr++
+	r.done = last
+	return out, nil
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -9,11 +9,40 @@
 //	------|---------|--------------------------------------------------
 //	0     | 1       | Magic number [0xec]
 //	1     | 1       | Format version [0x01]
-//	2     | 2       | Reserved [0x00 0x00]; must be zero in format 1
+//	2     | 1       | Cipher suite (see below)
+//	3     | 1       | Flags (see below)
 //	4     | (rest)  | * packet (see below)
 //
 // The only understood format version is 0x01.
 //
+// The cipher suite byte identifies the AEAD used to encrypt cipher packets:
+//
+//	 Code | Suite
+//	------|-----------------------------------------------------------
+//	 0    | XChaCha20-Poly1305 (24-byte nonce)
+//	 1    | AES-256-GCM (12-byte nonce)
+//
+// In format 1 this byte was originally reserved and zero, so keyrings written
+// before it was defined use XChaCha20-Poly1305. A reader must reject a keyring
+// whose cipher suite it does not recognize.
+//
+// The flags byte is a bit set of optional format features. A reader must
+// reject a keyring that sets any flag it does not recognize, rather than
+// misinterpret the contents. The following flags are defined:
+//
+//	 Bit  | Meaning
+//	------|-----------------------------------------------------------
+//	 0x01 | bundle contents are compressed with DEFLATE (RFC 1951)
+//	 0x02 | key IDs are derived from key contents (see below)
+//
+// When the compression flag is set, the plaintext of each bundle, and of the
+// stream held by the stream frames, is compressed before it is encrypted, and
+// must be decompressed after decryption to obtain the packets it contains.
+//
+// When the content ID flag is set, the ID of each key added to the keyring is
+// derived from a hash of its contents rather than a counter. This does not
+// change the encoding, but tells a writer how to assign new IDs.
+//
 // Packet format
 //
 //	Pos   | Size    | Description
@@ -29,22 +58,130 @@
 //	 0, 1 | (reserved)        | (not used)
 //	 2    | data storage key  | cipher packet
 //	 3    | access key salt   | bytes
-//	 4    | keyring entry     | bytes
+//	 4    | keyring entry     | keyring entry (see below)
 //	 5    | active key ID     | [4]byte (BE uint32)
 //	 6    | encrypted bundle  | cipher packet
+//	 7    | generation        | [8]byte (BE uint64)
+//	 8    | maximum key ID    | [4]byte (BE uint32)
+//	 9    | argon2id params   | argon2id parameters (see below)
+//	10    | scrypt params     | [12]byte (BE uint32 N, r, p)
+//	11    | stream frame      | framed cipher packet (see below)
+//	12    | header MAC        | [32]byte (HMAC-SHA256, see below)
+//	13    | threshold params  | [2]byte (k, n; see below)
+//	14    | wrapped data key  | wrapped key (see below)
 //
 // All types not listed here are reserved.
 //
+// A header MAC packet may occur at the top level, after all the other
+// unencrypted packets and before any bundles or stream frames. It holds an
+// HMAC-SHA256 of the encoded header and every packet that precedes it, keyed
+// with a subkey of the data storage key, so that a reader holding any access
+// key can detect changes to the unencrypted packets, such as the salt.
+//
+// A writer that emits a header MAC also puts an empty header MAC packet at the
+// start of the bundle (or stream). Since the bundle is authenticated by the
+// data storage key, this records that the header has a MAC, so a reader can
+// detect that the MAC was removed even if it accepts legacy keyrings without
+// one.
+//
+// A keyring may have several data storage key packets, each holding the same
+// data key encrypted with a different access key. An access key salt packet
+// that immediately follows a data key packet belongs to that key. A keyring
+// with only one data key packet may have its salt anywhere at the top level.
+//
+// A threshold params packet records that the access key was split into n
+// shares, any k of which reconstruct it. It is informational: the shares are
+// not stored, and the reader must combine them to obtain the access key. At
+// most one of the argon2id, scrypt, and threshold params may be present.
+//
+// A wrapped data key packet holds the data storage key encrypted by a key
+// kept outside the keyring, such as in a hardware security module, rather
+// than by an access key. It may occur at the top level any number of times,
+// in addition to the data key packets.
+//
+//	Pos   | Size    | Description
+//	------|---------|--------------------------------------------------
+//	0     | 1       | Label length = n (1 ≤ n ≤ 255)
+//	1     | n       | Label identifying the wrapping key (UTF-8)
+//	1+n   | (rest)  | Wrapped data key (opaque, non-empty)
+//
+// Keyring entries and the active key ID belong inside an encrypted bundle.
+// Some legacy keyrings store them unencrypted at the top level instead; a
+// reader should reject these unless the caller has asked to migrate them.
+//
+// A writer emits packets in a canonical order, so that the same keyring
+// contents always produce the same layout. At the top level: each data key
+// (followed by its salt, if any), then any wrapped data keys, the key
+// derivation or threshold params, the generation, any unrecognized packets
+// preserved from the input, the header MAC, and finally the bundle or stream
+// frames. Within a bundle: the empty header MAC marker, the active key ID (if
+// present), the maximum key ID (if present), then the keyring entries in
+// increasing order of ID. A reader
+// accepts other orders, except as noted for salts and the header MAC.
+//
+// A maximum key ID packet may occur in a bundle to record the largest key ID
+// ever assigned, when that is greater than the IDs of the stored keys (for
+// example, because keys were removed). It is omitted otherwise.
+//
+// An argon2id parameters packet may occur at the top level to record the
+// settings used to derive the access key from a passphrase and the access key
+// salt. Like the salt, it is stored in plaintext.
+//
+//	Pos   | Size    | Description
+//	------|---------|--------------------------------------------------
+//	0     | 4       | Time (number of passes, BE uint32)
+//	4     | 4       | Memory (KiB, BE uint32)
+//	8     | 1       | Threads (degree of parallelism)
+//
+// A scrypt parameters packet may likewise occur at the top level to record
+// the cost parameters N, r, and p used to derive the access key. A keyring has
+// at most one of the argon2id and scrypt parameters.
+//
+// Keyring entry format
+//
+//	Pos   | Size    | Description
+//	------|---------|--------------------------------------------------
+//	0     | 4       | Key ID (BE uint32); high bit set if attributes follow
+//	4     | 2       | Attribute length (BE uint16) = n, if present
+//	6     | n       | * attribute (see below), if present
+//	6+n   | (rest)  | Key content
+//
+// The high bit of the key ID is a flag, and is not part of the ID. An entry
+// without the flag has no attributes, and the key content starts at offset 4.
+//
+// Attribute format
+//
+//	Pos   | Size    | Description
+//	------|---------|--------------------------------------------------
+//	0     | 1       | Attribute tag (see below)
+//	1     | 1       | Attribute value length = n
+//	2     | n       | Attribute value
+//
+// Attribute tags
+//
+//	 Tag  | Meaning           | Format
+//	------|-------------------|-----------------------------------
+//	 1    | creation time     | [8]byte (BE int64 Unix seconds)
+//	 2    | not valid before  | [8]byte (BE int64 Unix seconds)
+//	 3    | label             | UTF-8 string
+//
+// Readers ignore attributes with tags not listed here.
+//
 // Cipher packet format
 //
 //	Pos   | Size    | Description
 //	------|---------|--------------------------------------------------
-//	0     | 24      | encryption nonce
-//	24    | (rest)  | AEAD sealed content
+//	0     | n       | encryption nonce (n = 24, or 12 for AES-256-GCM)
+//	n     | (rest)  | AEAD sealed content
+//
+// The sealed content of a data storage key packet is the plaintext data key.
+// Its length is not stored explicitly, but is implied by the cipher: Readers
+// must verify that the unsealed key has the length required by the cipher.
 //
 // A bundle packet is a cipher packet whose AEAD sealed content is itself a
 // sequence of packets, encrypted with the data encryption key.  This package
-// encrypts using an AEAD over chacha20poly1305 with a 24-byte nonce.
+// encrypts using an AEAD over chacha20poly1305 with a 24-byte nonce, unless
+// the header selects AES-256-GCM.
 //
 // It is structurally valid for keyring entry (4) and active key id (5) packets
 // to occur at the top level of the encoding. However, the keyring API will
@@ -54,27 +191,54 @@
 // bundle packets), but the API expects only keyring entry and active key ID
 // packets inside a bundle. This package does not enforce those rules.
 //
+// The active key ID packet may be omitted when the keyring has exactly one
+// entry, in which case that entry is the active key. An empty active key ID
+// packet indicates that the keyring has no active key.
+//
+// Stream frame (11) packets are an alternative to a bundle for large keyrings.
+// Taken in order, the stream frames of a keyring hold the frames of a single
+// stream encrypted with the data encryption key as described in the cipher
+// package, whose plaintext is a sequence of packets with the same contents
+// as a bundle. The first frame is prefixed by the salt from which the key of
+// the stream is derived.
+//
+// The generation (7) packet records a counter that is incremented each time
+// the keyring is written, so that concurrent writers can detect changes. It
+// is not authenticated, and must not be used for anything security-relevant.
+//
 // Since the intended use of this format is to store cryptographic keys, there
 // is no compression, as random keys will be incompressible anyway.
 package packet
 
 import (
 	"bytes"
+	"compress/flate"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
 
 	"github.com/creachadair/keyring/internal/cipher"
 )
 
 // KeyInfo is the parsed representation of a stored key.
 type KeyInfo struct {
-	ID  int
-	Key []byte
+	ID        int
+	Key       []byte
+	Created   time.Time // zero if unknown
+	NotBefore time.Time // zero if valid immediately
+	Label     string    // empty if none
 }
 
 // Clone returns a deep clone of ki.
-func (ki KeyInfo) Clone() KeyInfo { return KeyInfo{ID: ki.ID, Key: bytes.Clone(ki.Key)} }
+func (ki KeyInfo) Clone() KeyInfo { ki.Key = bytes.Clone(ki.Key); return ki }
+
+// hasAttrs reports whether ki has any attributes to encode.
+func (ki KeyInfo) hasAttrs() bool {
+	return !ki.Created.IsZero() || !ki.NotBefore.IsZero() || ki.Label != ""
+}
 
 // ParseKeyInfo parses the binary encoding of a [KeyInfo] from data.
 // The parsed key contents alias a slice of data.
@@ -82,13 +246,68 @@ func ParseKeyInfo(data []byte) (KeyInfo, error) {
 	if len(data) < 4 {
 		return KeyInfo{}, fmt.Errorf("key truncated (%d < 4)", len(data))
 	}
-	id := int(binary.BigEndian.Uint32(data))
+	tag := binary.BigEndian.Uint32(data)
+	id := int(tag &^ attrFlag)
 	if id == 0 {
 		return KeyInfo{}, errors.New("invalid key ID")
 	}
-	return KeyInfo{ID: id, Key: data[4:]}, nil
+	ki := KeyInfo{ID: id, Key: data[4:]}
+	if tag&attrFlag == 0 {
+		return ki, nil // no attributes
+	}
+
+	if len(ki.Key) < 2 {
+		return KeyInfo{}, fmt.Errorf("attributes truncated (%d < 2)", len(ki.Key))
+	}
+	alen := int(binary.BigEndian.Uint16(ki.Key))
+	attrs := ki.Key[2:]
+	if len(attrs) < alen {
+		return KeyInfo{}, fmt.Errorf("attributes truncated (%d < %d)", len(attrs), alen)
+	}
+	ki.Key = attrs[alen:]
+	attrs = attrs[:alen]
+	for len(attrs) != 0 {
+		if len(attrs) < 2 || len(attrs)-2 < int(attrs[1]) {
+			return KeyInfo{}, errors.New("attribute truncated")
+		}
+		atag, aval := attrs[0], attrs[2:2+int(attrs[1])]
+		attrs = attrs[2+len(aval):]
+
+		switch atag {
+		case attrCreated:
+			if len(aval) != 8 {
+				return KeyInfo{}, fmt.Errorf("invalid creation time (%d ≠ 8 bytes)", len(aval))
+			}
+			ki.Created = time.Unix(int64(binary.BigEndian.Uint64(aval)), 0)
+		case attrNotBefore:
+			if len(aval) != 8 {
+				return KeyInfo{}, fmt.Errorf("invalid not-before time (%d ≠ 8 bytes)", len(aval))
+			}
+			ki.NotBefore = time.Unix(int64(binary.BigEndian.Uint64(aval)), 0)
+		case attrLabel:
+			if !utf8.Valid(aval) {
+				return KeyInfo{}, errors.New("invalid label (not UTF-8)")
+			}
+			ki.Label = string(aval)
+		}
+	}
+	return ki, nil
 }
 
+// MaxLabelLen is the maximum length in bytes of a key label.
+const MaxLabelLen = 255
+
+// attrFlag is the flag bit in the ID field of a keyring entry that indicates
+// that attributes are present.
+const attrFlag = 1 << 31
+
+// Attribute tags for keyring entries.
+const (
+	attrCreated   = 1 // creation time
+	attrNotBefore = 2 // not valid before
+	attrLabel     = 3 // label
+)
+
 // ParseActiveKey parses the binary encoding of an active key ID from data.
 func ParseActiveKey(data []byte) (int, error) {
 	if len(data) == 0 {
@@ -99,11 +318,159 @@ func ParseActiveKey(data []byte) (int, error) {
 	return int(binary.BigEndian.Uint32(data)), nil
 }
 
+// ParseMaxID parses the binary encoding of a maximum key ID from data.
+func ParseMaxID(data []byte) (int, error) {
+	if len(data) != 4 {
+		return 0, fmt.Errorf("wrong data length (%d ≠ 4)", len(data))
+	}
+	return int(binary.BigEndian.Uint32(data)), nil
+}
+
+// ParseArgon2Params parses the binary encoding of argon2id parameters from data.
+func ParseArgon2Params(data []byte) (time, memory uint32, threads uint8, _ error) {
+	if len(data) != 9 {
+		return 0, 0, 0, fmt.Errorf("wrong data length (%d ≠ 9)", len(data))
+	}
+	return binary.BigEndian.Uint32(data), binary.BigEndian.Uint32(data[4:]), data[8], nil
+}
+
+// ParseScryptParams parses the binary encoding of scrypt parameters from data.
+func ParseScryptParams(data []byte) (n, r, p uint32, _ error) {
+	if len(data) != 12 {
+		return 0, 0, 0, fmt.Errorf("wrong data length (%d ≠ 12)", len(data))
+	}
+	return binary.BigEndian.Uint32(data), binary.BigEndian.Uint32(data[4:]), binary.BigEndian.Uint32(data[8:]), nil
+}
+
+// ParseThreshold parses the binary encoding of threshold parameters from data.
+func ParseThreshold(data []byte) (k, n uint8, _ error) {
+	if len(data) != 2 {
+		return 0, 0, fmt.Errorf("wrong data length (%d ≠ 2)", len(data))
+	}
+	return data[0], data[1], nil
+}
+
+// ParseWrappedKey parses the contents of a wrapped data key packet. The
+// wrapped key aliases data.
+func ParseWrappedKey(data []byte) (label string, wrapped []byte, _ error) {
+	if len(data) == 0 || data[0] == 0 {
+		return "", nil, errors.New("missing wrapping key label")
+	} else if n := int(data[0]); len(data) <= 1+n {
+		return "", nil, fmt.Errorf("wrapped key truncated (%d ≤ %d)", len(data), 1+n)
+	}
+	n := int(data[0])
+	return string(data[1 : 1+n]), data[1+n:], nil
+}
+
+// Header is the parsed representation of a keyring format header.
+type Header struct {
+	Version  byte    // currently 1 or 2
+	Reserved [2]byte // cipher suite and flags
+}
+
+// Header flag bits.
+const (
+	FlagCompressed byte = 0x01 // bundle contents are compressed
+	FlagContentIDs byte = 0x02 // key IDs are derived from key contents
+
+	// KnownFlags is the set of header flag bits understood by this package.
+	KnownFlags = FlagCompressed | FlagContentIDs
+)
+
+// MaxInflatedSize is the maximum size in bytes of the decompressed contents
+// of a bundle or stream, to bound the memory used by a malicious input.
+const MaxInflatedSize = 64 << 20
+
+// Flags returns the flags byte of the header.
+func (h Header) Flags() byte { return h.Reserved[1] }
+
+// Suite returns the cipher suite byte of the header.
+func (h Header) Suite() cipher.Suite { return cipher.Suite(h.Reserved[0]) }
+
+// Compressed reports whether the header flags bundle contents as compressed.
+func (h Header) Compressed() bool { return h.Flags()&FlagCompressed != 0 }
+
+// ContentIDs reports whether h sets the content ID flag.
+func (h Header) ContentIDs() bool { return h.Flags()&FlagContentIDs != 0 }
+
+// OpenBundle decrypts the contents of a bundle packet p with key, using the
+// cipher suite of h, and decompresses the result if h says it is compressed.
+func (h Header) OpenBundle(p Packet, key []byte) ([]byte, error) {
+	dec, err := p.Decrypt(h.Suite(), key)
+	if err != nil || !h.Compressed() {
+		return dec, err
+	}
+	defer clear(dec)
+	return Inflate(dec)
+}
+
+// OpenStream decrypts the contents of the stream frames in frames with key,
+// using the cipher suite of h, and decompresses the result if h says it is
+// compressed. The frames must be the complete stream, in order.
+func (h Header) OpenStream(frames []Packet, key []byte) ([]byte, error) {
+	fr, err := h.Suite().NewFrameReader(key)
+	if err != nil {
+		return nil, err
+	}
+	var dec []byte
+	for i, f := range frames {
+		dec, err = fr.Open(dec, f.Data, i == len(frames)-1)
+		if err != nil {
+			clear(dec)
+			return nil, err
+		}
+	}
+	if !h.Compressed() {
+		return dec, nil
+	}
+	defer clear(dec)
+	return Inflate(dec)
+}
+
+// Deflate returns a writer that compresses data written to it with DEFLATE,
+// writing the result to w. The caller must close the writer to flush the
+// compressed data.
+func Deflate(w io.Writer) io.WriteCloser {
+	fw, err := flate.NewWriter(w, flate.BestCompression)
+	if err != nil {
+		panic(err) // the level is valid, so this should not happen
+	}
+	return fw
+}
+
+// Inflate decompresses data compressed with DEFLATE. It reports an error if
+// the result would exceed [MaxInflatedSize] bytes, or if data has any bytes
+// after the end of the compressed stream.
+func Inflate(data []byte) ([]byte, error) {
+	br := bytes.NewReader(data)
+	fr := flate.NewReader(br) // br is an io.ByteReader, so fr does not read ahead
+	defer fr.Close()
+	out, err := io.ReadAll(io.LimitReader(fr, MaxInflatedSize+1))
+	if err != nil {
+		clear(out)
+		return nil, fmt.Errorf("decompress: %w", err)
+	} else if len(out) > MaxInflatedSize {
+		clear(out)
+		return nil, fmt.Errorf("decompress: more than %d bytes", MaxInflatedSize)
+	} else if br.Len() != 0 {
+		clear(out)
+		return nil, fmt.Errorf("decompress: %d bytes of trailing data", br.Len())
+	}
+	return out, nil
+}
+
+// ParseGeneration parses the binary encoding of a generation counter from data.
+func ParseGeneration(data []byte) (uint64, error) {
+	if len(data) != 8 {
+		return 0, fmt.Errorf("wrong data length (%d ≠ 8)", len(data))
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
 // Keyring is the parsed representation of a stored keyring.
 type Keyring struct {
-	Version  byte    // currently 1 is the only legal value
-	Reserved [2]byte // must be zero in version 1
-	Packets  []Packet
+	Header
+	Packets []Packet
 }
 
 // Packet is the parsed representation of a stored packet.
@@ -112,9 +479,9 @@ type Packet struct {
 	Data []byte // format depends on type
 }
 
-// Decrypt decryptes the contents of r using the specified key.
-func (r Packet) Decrypt(key []byte) ([]byte, error) {
-	return cipher.DecryptWithKey(key, r.Data, nil)
+// Decrypt decrypts the contents of r using the specified suite and key.
+func (r Packet) Decrypt(suite cipher.Suite, key []byte) ([]byte, error) {
+	return suite.DecryptWithKey(key, r.Data, nil)
 }
 
 // IsValid reports whether r has a valid type.
@@ -140,31 +507,105 @@ func ParseKeyring(data []byte) (Keyring, error) {
 	} else if data[0] != MagicByte {
 		return Keyring{}, errors.New("invalid keyring: invalid header")
 	}
-	rk := Keyring{
-		Version:  data[1],
-		Reserved: [2]byte{data[2], data[3]},
-	}
+	rk := Keyring{Header: parseHeader(data)}
 	pkt, err := ParsePackets(data[4:], 4)
 	rk.Packets = pkt
 	return rk, err
 }
 
+// ParseReader parses the binary contents of a keyring from r, calling visit
+// for each top-level packet in order. Unlike [ParseKeyring], it does not read
+// the entire input into memory. If visit reports an error, parsing stops and
+// ParseReader returns that error. Otherwise, ParseReader consumes r to EOF.
+//
+// The Data field of each packet passed to visit aliases a buffer that is
+// reused for subsequent packets. The visit function must copy the data if it
+// needs them to persist after it returns.
+//
+// The caller is responsible for validating the Version and Reserved fields of
+// the header, as well as packet types.
+func ParseReader(r io.Reader, visit func(Packet) error) (Header, error) {
+	return ParseReaderUntil(r, nil, visit)
+}
+
+// ParseReaderUntil behaves as [ParseReader], except that before reading the
+// contents of each packet it calls stop (if non-nil) with the packet type. If
+// stop reports true, parsing ends without reading the rest of r, and
+// ParseReaderUntil returns the header and a nil error.
+func ParseReaderUntil(r io.Reader, stop func(PacketType) bool, visit func(Packet) error) (Header, error) {
+	var hbuf [4]byte
+	if _, err := io.ReadFull(r, hbuf[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return Header{}, errors.New("invalid keyring: header truncated")
+	} else if err != nil {
+		return Header{}, err
+	} else if hbuf[0] != MagicByte {
+		return Header{}, errors.New("invalid keyring: invalid header")
+	}
+	hdr := parseHeader(hbuf[:])
+
+	var buf []byte
+	pos := len(hbuf)
+	for {
+		if _, err := io.ReadFull(r, hbuf[:]); err == io.EOF {
+			return hdr, nil // OK, no more packets
+		} else if err == io.ErrUnexpectedEOF {
+			return hdr, fmt.Errorf("offset %d: truncated packet header", pos)
+		} else if err != nil {
+			return hdr, err
+		}
+		pt := PacketType(hbuf[0])
+		if stop != nil && stop(pt) {
+			return hdr, nil
+		}
+		plen := int(uint24(hbuf[1:]))
+		pos += len(hbuf)
+
+		if cap(buf) < plen {
+			buf = make([]byte, plen)
+		}
+		nr, err := io.ReadFull(r, buf[:plen])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return hdr, fmt.Errorf("offset %d: truncated packet (%d < %d)", pos, nr, plen)
+		} else if err != nil {
+			return hdr, err
+		}
+		pos += plen
+		if err := visit(Packet{Type: pt, Data: buf[:plen]}); err != nil {
+			return hdr, err
+		}
+	}
+}
+
+func parseHeader(data []byte) Header {
+	return Header{Version: data[1], Reserved: [2]byte{data[2], data[3]}}
+}
+
 // ParsePackets parses the contents of data into raw packets.
 // The base offset is added to position information in errors.
 // In case of error, all complete packets so far are reported.
 // The contents of the parsed packets alias slices of data.
 func ParsePackets(data []byte, base int) ([]Packet, error) {
-	var out []Packet
+	return AppendPackets(nil, data, base, 0)
+}
+
+// AppendPackets parses the contents of data into raw packets, as
+// [ParsePackets] does, and appends them to out. If limit > 0, it reports an
+// error wrapping [ErrTooManyPackets] if data contain more than limit packets.
+// Errors have concrete type [*OffsetError].
+func AppendPackets(out []Packet, data []byte, base, limit int) ([]Packet, error) {
 	cur := data
-	for len(cur) != 0 {
-		if len(cur) < 4 {
-			return out, fmt.Errorf("offset %d: truncated packet header", base+len(data)-len(cur))
+	for n := 0; len(cur) != 0; n++ {
+		pos := base + len(data) - len(cur)
+		if limit > 0 && n == limit {
+			return out, &OffsetError{Offset: pos, Err: fmt.Errorf("%w: more than %d", ErrTooManyPackets, limit)}
+		} else if len(cur) < 4 {
+			return out, &OffsetError{Offset: pos, Err: errors.New("truncated packet header")}
 		}
 		pt := PacketType(cur[0])
 		plen := uint24(cur[1:])
 		cur = cur[4:]
 		if len(cur) < int(plen) {
-			return out, fmt.Errorf("offset %d: truncated packet (%d < %d)", base+len(data)-len(cur), len(cur), plen)
+			return out, &OffsetError{Offset: pos + 4, Err: fmt.Errorf("truncated packet (%d < %d)", len(cur), plen)}
 		}
 
 		out = append(out, Packet{
@@ -176,15 +617,37 @@ func ParsePackets(data []byte, base int) ([]Packet, error) {
 	return out, nil
 }
 
+// ErrTooManyPackets is reported by [AppendPackets] when the input has more
+// packets than the limit.
+var ErrTooManyPackets = errors.New("too many packets")
+
+// An OffsetError reports a structural error at a byte offset of the input.
+type OffsetError struct {
+	Offset int   // the byte offset of the error
+	Err    error // the error at that offset
+}
+
+func (e *OffsetError) Error() string { return fmt.Sprintf("offset %d: %v", e.Offset, e.Err) }
+
+func (e *OffsetError) Unwrap() error { return e.Err }
+
 // PacketType identifies the type of a packet in the binary storage format.
 type PacketType byte
 
 const (
-	DataKeyType       PacketType = 2 // encrypted data key
-	AccessKeySaltType PacketType = 3 // access key generation salt
-	KeyringEntryType  PacketType = 4 // stored keyring key
-	ActiveKeyType     PacketType = 5 // active key ID
-	BundleType        PacketType = 6 // encrypted bundle
+	DataKeyType       PacketType = 2  // encrypted data key
+	AccessKeySaltType PacketType = 3  // access key generation salt
+	KeyringEntryType  PacketType = 4  // stored keyring key
+	ActiveKeyType     PacketType = 5  // active key ID
+	BundleType        PacketType = 6  // encrypted bundle
+	GenerationType    PacketType = 7  // generation counter
+	MaxIDType         PacketType = 8  // maximum key ID
+	Argon2ParamsType  PacketType = 9  // argon2id parameters
+	ScryptParamsType  PacketType = 10 // scrypt parameters
+	StreamFrameType   PacketType = 11 // frame of an encrypted stream
+	HeaderMACType     PacketType = 12 // MAC of the header and unencrypted packets
+	ThresholdType     PacketType = 13 // threshold sharing parameters
+	WrappedKeyType    PacketType = 14 // data key wrapped by an external key
 )
 
 func (p PacketType) String() string {
@@ -199,6 +662,22 @@ func (p PacketType) String() string {
 		return "ACTIVE_KEY_ID"
 	case BundleType:
 		return "BUNDLE"
+	case GenerationType:
+		return "GENERATION"
+	case MaxIDType:
+		return "MAX_KEY_ID"
+	case Argon2ParamsType:
+		return "ARGON2_PARAMS"
+	case ScryptParamsType:
+		return "SCRYPT_PARAMS"
+	case StreamFrameType:
+		return "STREAM_FRAME"
+	case HeaderMACType:
+		return "HEADER_MAC"
+	case ThresholdType:
+		return "THRESHOLD_PARAMS"
+	case WrappedKeyType:
+		return "WRAPPED_DATA_KEY"
 	default:
 		return fmt.Sprintf("UNKNOWN_TYPE_%d", p)
 	}
@@ -229,15 +708,78 @@ func (p *Buffer) AddPacket(pt PacketType, data []byte) {
 	p.Write(data)
 }
 
-// AddActiveKey adds an [ActiveKeyType] packet to p.
+// AddActiveKey adds an [ActiveKeyType] packet to p. If id == 0, the packet
+// is empty, indicating there is no active key.
 func (p *Buffer) AddActiveKey(id int) {
+	if id == 0 {
+		p.AddPacket(ActiveKeyType, nil)
+		return
+	}
 	p.AddPacket(ActiveKeyType, binary.BigEndian.AppendUint32(nil, uint32(id)))
 }
 
+// AddMaxID adds a [MaxIDType] packet to p.
+func (p *Buffer) AddMaxID(id int) {
+	p.AddPacket(MaxIDType, binary.BigEndian.AppendUint32(nil, uint32(id)))
+}
+
+// AddGeneration adds a [GenerationType] packet to p.
+func (p *Buffer) AddGeneration(gen uint64) {
+	p.AddPacket(GenerationType, binary.BigEndian.AppendUint64(nil, gen))
+}
+
+// AddArgon2Params adds an [Argon2ParamsType] packet to p.
+func (p *Buffer) AddArgon2Params(time, memory uint32, threads uint8) {
+	buf := binary.BigEndian.AppendUint32(nil, time)
+	buf = binary.BigEndian.AppendUint32(buf, memory)
+	p.AddPacket(Argon2ParamsType, append(buf, threads))
+}
+
+// AddScryptParams adds a [ScryptParamsType] packet to p.
+func (p *Buffer) AddScryptParams(n, r, par uint32) {
+	buf := binary.BigEndian.AppendUint32(nil, n)
+	buf = binary.BigEndian.AppendUint32(buf, r)
+	p.AddPacket(ScryptParamsType, binary.BigEndian.AppendUint32(buf, par))
+}
+
+// AddThreshold adds a [ThresholdType] packet to p.
+func (p *Buffer) AddThreshold(k, n uint8) {
+	p.AddPacket(ThresholdType, []byte{k, n})
+}
+
+// AddWrappedKey adds a [WrappedKeyType] packet to p. The label must be 1 to
+// 255 bytes long.
+func (p *Buffer) AddWrappedKey(label string, wrapped []byte) {
+	if len(label) == 0 || len(label) > MaxLabelLen {
+		panic(fmt.Sprintf("packet: wrapping key label is %d bytes", len(label)))
+	}
+	buf := append([]byte{byte(len(label))}, label...)
+	p.AddPacket(WrappedKeyType, append(buf, wrapped...))
+}
+
 // AddKeyringEntry adds a [KeyringEntryType] packet to p.
 func (p *Buffer) AddKeyringEntry(ki KeyInfo) {
 	var buf []byte
-	buf = binary.BigEndian.AppendUint32(buf, uint32(ki.ID))
+	if !ki.hasAttrs() {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(ki.ID))
+	} else {
+		var attrs []byte
+		if !ki.Created.IsZero() {
+			attrs = append(attrs, attrCreated, 8)
+			attrs = binary.BigEndian.AppendUint64(attrs, uint64(ki.Created.Unix()))
+		}
+		if !ki.NotBefore.IsZero() {
+			attrs = append(attrs, attrNotBefore, 8)
+			attrs = binary.BigEndian.AppendUint64(attrs, uint64(ki.NotBefore.Unix()))
+		}
+		if ki.Label != "" {
+			attrs = append(attrs, attrLabel, byte(len(ki.Label)))
+			attrs = append(attrs, ki.Label...)
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(ki.ID)|attrFlag)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(attrs)))
+		buf = append(buf, attrs...)
+	}
 	buf = append(buf, ki.Key...)
 	p.AddPacket(KeyringEntryType, buf)
 }
@@ -0,0 +1,121 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+// Package shamir implements Shamir's secret sharing over GF(2^8).
+//
+// Each byte of the secret is shared independently, using a random polynomial
+// of degree k-1 whose constant term is the secret byte. A share is encoded as
+// a single nonzero byte x, followed by the values of the polynomials at x:
+//
+//	Pos   | Size    | Description
+//	------|---------|--------------------------------------------------
+//	0     | 1       | Evaluation point x (1..255)
+//	1     | n       | Share values, one per byte of the secret
+//
+// The field arithmetic uses the AES reduction polynomial x^8+x^4+x^3+x+1, and
+// does not use lookup tables, so its timing does not depend on the secret.
+package shamir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Split splits secret into n shares, any k of which suffice to reconstruct
+// it, using random coefficients read from rand. It requires 2 ≤ k ≤ n ≤ 255
+// and a non-empty secret.
+func Split(secret []byte, k, n int, rand io.Reader) ([][]byte, error) {
+	if k < 2 || k > n || n > 255 {
+		return nil, fmt.Errorf("invalid threshold %d of %d", k, n)
+	} else if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+
+	// coef[i*(k-1)+j] is the coefficient of x^(j+1) for byte i of the secret.
+	coef := make([]byte, len(secret)*(k-1))
+	defer clear(coef)
+	if _, err := io.ReadFull(rand, coef); err != nil {
+		return nil, fmt.Errorf("generate coefficients: %w", err)
+	}
+
+	shares := make([][]byte, n)
+	for s := range shares {
+		x := byte(s + 1)
+		share := make([]byte, 1+len(secret))
+		share[0] = x
+		for i, b := range secret {
+			// Evaluate by Horner's rule, from the highest-order coefficient.
+			c := coef[i*(k-1) : (i+1)*(k-1)]
+			var y byte
+			for j := len(c) - 1; j >= 0; j-- {
+				y = mul(y, x) ^ c[j]
+			}
+			share[1+i] = mul(y, x) ^ b
+		}
+		shares[s] = share
+	}
+	return shares, nil
+}
+
+// Combine reconstructs a secret from shares produced by [Split]. If fewer
+// than the threshold number of shares are given, the result is not the
+// original secret, and Combine cannot detect this. It reports an error if
+// the shares are malformed, have different lengths, or repeat a share.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, fmt.Errorf("share is too short (%d bytes)", size)
+	}
+	var seen [256]bool
+	for i, s := range shares {
+		if len(s) != size {
+			return nil, fmt.Errorf("share %d has length %d, want %d", i, len(s), size)
+		} else if s[0] == 0 {
+			return nil, fmt.Errorf("share %d has invalid index 0", i)
+		} else if seen[s[0]] {
+			return nil, fmt.Errorf("share %d duplicates index %d", i, s[0])
+		}
+		seen[s[0]] = true
+	}
+
+	// Interpolate each polynomial at x = 0 using the Lagrange basis. In this
+	// field subtraction is XOR, so the basis term for share j is the product
+	// of x_m / (x_m ^ x_j) over the other shares m.
+	secret := make([]byte, size-1)
+	for j, sj := range shares {
+		basis := byte(1)
+		for m, sm := range shares {
+			if m != j {
+				basis = mul(basis, mul(sm[0], inv(sm[0]^sj[0])))
+			}
+		}
+		for i := range secret {
+			secret[i] ^= mul(basis, sj[1+i])
+		}
+	}
+	return secret, nil
+}
+
+// mul returns the product of a and b in GF(2^8).
+func mul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= a & -(b & 1)
+		a = a<<1 ^ (0x1b & -(a >> 7))
+		b >>= 1
+	}
+	return p
+}
+
+// inv returns the multiplicative inverse of a in GF(2^8), computed as a^254.
+// The inverse of 0 is 0.
+func inv(a byte) byte {
+	r := a
+	for range 6 {
+		r = mul(mul(r, r), a)
+	}
+	return mul(r, r)
+}
@@ -4,12 +4,19 @@ package keyring
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/creachadair/keyring/internal/cipher"
 	"github.com/creachadair/keyring/internal/packet"
+	"github.com/creachadair/mds/mtest"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestRoundTripInternal(t *testing.T) {
@@ -28,7 +35,7 @@ func TestRoundTripInternal(t *testing.T) {
 	}
 
 	r := &Ring{
-		formatVersion: 1,
+		formatVersion: CurrentFormat,
 		accessKeySalt: []byte("salt"),
 		dkEncrypted:   dataKeyEncrypted,
 		dkPlaintext:   dataKey,
@@ -51,12 +58,937 @@ func TestRoundTripInternal(t *testing.T) {
 	}
 	t.Logf("Wrote %d bytes", nw)
 
-	s, err := Read(bytes.NewReader(buf.Bytes()), afunc)
+	s, err := Read(bytes.NewReader(buf.Bytes()), AccessKeyFunc(afunc))
 	if err != nil {
 		t.Fatalf("Read failed: %v", err)
 	}
 
-	if diff := cmp.Diff(s, r, cmp.AllowUnexported(Ring{}, View{})); diff != "" {
+	r.generation++ // the stored generation is incremented by the write
+	r.openSlot = 1 // the copy read was unlocked by access key 0
+	opts := []cmp.Option{cmp.AllowUnexported(Ring{}, View{}), cmpopts.IgnoreFields(Ring{}, "mu", "cleanups")}
+	if diff := cmp.Diff(s, r, opts...); diff != "" {
 		t.Errorf("Round trip (-got, +want):\n%s", diff)
 	}
 }
+
+func TestReleaseToPool(t *testing.T) {
+	r := AcquireRing()
+	id := r.Add([]byte("sensitive"))
+	if err := r.Rekey(make([]byte, AccessKeyLen), nil); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	key, dk := r.view.keys[id].Key, r.dkPlaintext
+
+	r.ReleaseToPool()
+	if !isZero(key) {
+		t.Errorf("Key not zeroed: %q", key)
+	}
+	if !isZero(dk) {
+		t.Errorf("Data key not zeroed: %x", dk)
+	}
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestClose(t *testing.T) {
+	r, err := New(Config{
+		InitialKey: []byte("sensitive"),
+		AccessKey:  make([]byte, AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	v := r.View()
+	key, dk, ek := r.view.keys[1].Key, r.dkPlaintext, r.dkEncrypted
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !isZero(key) {
+		t.Errorf("Key not zeroed: %q", key)
+	}
+	if !isZero(dk) {
+		t.Errorf("Data key not zeroed: %x", dk)
+	}
+	if !isZero(ek) {
+		t.Errorf("Encrypted data key not zeroed: %x", ek)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close again: unexpected error: %v", err)
+	}
+
+	// Methods of a closed ring panic.
+	for name, f := range map[string]func(){
+		"Len":      func() { r.Len() },
+		"Get":      func() { r.Get(1, nil) },
+		"Add":      func() { r.Add([]byte("x")) },
+		"Activate": func() { r.Activate(1) },
+		"View":     func() { r.View() },
+		"WriteTo":  func() { r.WriteTo(io.Discard) },
+		"Rekey":    func() { r.Rekey(make([]byte, AccessKeyLen), nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if x := recover(); x == nil || !strings.Contains(fmt.Sprint(x), "keyring is closed") {
+					t.Errorf("%s: got panic %v, want keyring is closed", name, x)
+				}
+			}()
+			f()
+		})
+	}
+
+	// A view taken before Close is not affected.
+	if got := string(v.Get(1, nil)); got != "sensitive" {
+		t.Errorf("View Get: got %q, want sensitive", got)
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	r, err := New(Config{
+		InitialKey:    []byte("karsh"),
+		AccessKey:     make([]byte, AccessKeyLen),
+		AccessKeySalt: []byte("pepper"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("kavanaugh"))
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	want, err := packet.ParseKeyring(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseKeyring failed: %v", err)
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		var got packet.Keyring
+		hdr, err := packet.ParseReader(bytes.NewReader(buf.Bytes()), func(p packet.Packet) error {
+			got.Packets = append(got.Packets, packet.Packet{Type: p.Type, Data: bytes.Clone(p.Data)})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ParseReader failed: %v", err)
+		}
+		got.Header = hdr
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("ParseReader (-got, +want):\n%s", diff)
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		stop := errors.New("stop")
+		var n int
+		_, err := packet.ParseReader(bytes.NewReader(buf.Bytes()), func(p packet.Packet) error {
+			n++
+			return stop
+		})
+		if err != stop {
+			t.Errorf("ParseReader: got error %v, want %v", err, stop)
+		}
+		if n != 1 {
+			t.Errorf("ParseReader visited %d packets, want 1", n)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		for _, n := range []int{0, 3, 6, buf.Len() - 1} {
+			_, err := packet.ParseReader(bytes.NewReader(buf.Bytes()[:n]), func(packet.Packet) error { return nil })
+			if err == nil {
+				t.Errorf("ParseReader(%d bytes): unexpectedly succeeded", n)
+			}
+		}
+	})
+}
+
+func TestDataKeyLength(t *testing.T) {
+	accessKey := make([]byte, AccessKeyLen)
+	for _, n := range []int{0, 16, cipher.KeyLen - 1, cipher.KeyLen + 1} {
+		dataKey := cipher.GenerateKey(n)
+		_, encDK, err := cipher.EncryptWithKey(accessKey, dataKey, nil)
+		if err != nil {
+			t.Fatalf("Encrypt data key: %v", err)
+		}
+
+		var buf packet.Buffer
+		buf.WriteHeader(1, [2]byte{})
+		buf.AddPacket(packet.DataKeyType, encDK)
+
+		_, err = Read(&buf, StaticKey(accessKey))
+		if !errors.Is(err, ErrCorruptKeyring) {
+			t.Errorf("Read with %d-byte data key: got %v, want %v", n, err, ErrCorruptKeyring)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	newRing := func(t *testing.T) *Ring {
+		t.Helper()
+		r, err := New(Config{InitialKey: []byte("first"), AccessKey: make([]byte, AccessKeyLen)})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		r.Add([]byte("second"))
+		if err := r.Check(); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name  string
+		munge func(r *Ring)
+		want  string
+	}{
+		{"ZeroID", func(r *Ring) { r.view.keys[0] = packet.KeyInfo{ID: 0, Key: []byte("x")} }, "invalid key ID 0"},
+		{"WrongID", func(r *Ring) { r.view.keys[2] = packet.KeyInfo{ID: 5, Key: []byte("x")} }, "key 2 has ID 5"},
+		{"EmptyKey", func(r *Ring) { r.view.keys[2] = packet.KeyInfo{ID: 2} }, "key 2 is empty"},
+		{"MaxID", func(r *Ring) { r.maxID = 1 }, "key 2 exceeds maximum ID 1"},
+		{"FlagID", func(r *Ring) {
+			var flag int64 = 1 << 31 // reserved in storage; negative on 32-bit targets
+			id := ID(flag)
+			r.view.keys[id] = packet.KeyInfo{ID: id, Key: []byte("x")}
+			r.maxID = id
+		}, "invalid key ID"},
+		{"NoActive", func(r *Ring) { r.view.activeKey = 3 }, "active key ID 3 not found"},
+		{"DataKey", func(r *Ring) { r.dkPlaintext = r.dkPlaintext[:16] }, "data key is 16 bytes"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newRing(t)
+			tc.munge(r)
+			err := r.Check()
+			if !errors.Is(err, ErrCorruptKeyring) {
+				t.Errorf("Check: got %v, want %v", err, ErrCorruptKeyring)
+			} else if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Check: got %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestAddExhaustedIDs(t *testing.T) {
+	r, err := New(Config{InitialKey: []byte("first"), AccessKey: make([]byte, AccessKeyLen)})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.maxID = 1<<31 - 1 // the largest ID that can be stored
+
+	if _, err := r.AddRandomFrom(bytes.NewReader(make([]byte, 16)), 16); !errors.Is(err, ErrTooManyKeys) {
+		t.Errorf("AddRandomFrom: got %v, want %v", err, ErrTooManyKeys)
+	}
+	v := mtest.MustPanic(t, func() { r.Add([]byte("second")) })
+	if err, ok := v.(error); !ok || !errors.Is(err, ErrTooManyKeys) {
+		t.Errorf("Add: got panic %v, want %v", v, ErrTooManyKeys)
+	}
+	if n := len(r.view.keys); n != 1 {
+		t.Errorf("Keys after failed adds: got %d, want 1", n)
+	}
+}
+
+// encodeTestRing encodes a keyring with a single bundle containing the packets
+// in kb, protected by accessKey and a randomly-generated data key. The extra
+// packets, if any, are added at the top level before the header MAC.
+func encodeTestRing(t *testing.T, accessKey []byte, kb *packet.Buffer, extra ...packet.Packet) []byte {
+	t.Helper()
+	dataKey, encDK, err := cipher.GenerateAndEncryptKey(accessKey, AccessKeyLen)
+	if err != nil {
+		t.Fatalf("Generate data key: %v", err)
+	}
+	_, bundle, err := cipher.EncryptWithKey(dataKey, kb.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("Encrypt bundle: %v", err)
+	}
+	var buf packet.Buffer
+	buf.WriteHeader(1, [2]byte{})
+	buf.AddPacket(packet.DataKeyType, encDK)
+	for _, p := range extra {
+		buf.AddPacket(p.Type, p.Data)
+	}
+	addTestMAC(&buf, dataKey)
+	buf.AddPacket(packet.BundleType, bundle)
+	return buf.Bytes()
+}
+
+// addTestMAC adds a header MAC for the contents of buf, keyed by dataKey.
+func addTestMAC(buf *packet.Buffer, dataKey []byte) {
+	buf.AddPacket(packet.HeaderMACType, cipher.MAC(cipher.MACKey(dataKey), buf.Bytes()))
+}
+
+// decodeTestBundle returns the packets in the first bundle of the encoded
+// keyring in data, decrypted using accessKey.
+func decodeTestBundle(t *testing.T, accessKey, data []byte) []packet.Packet {
+	t.Helper()
+	kr, err := packet.ParseKeyring(data)
+	if err != nil {
+		t.Fatalf("ParseKeyring failed: %v", err)
+	}
+	var dataKey []byte
+	for _, p := range kr.Packets {
+		switch p.Type {
+		case packet.DataKeyType:
+			dataKey, err = p.Decrypt(kr.Suite(), accessKey)
+			if err != nil {
+				t.Fatalf("Decrypt data key: %v", err)
+			}
+		case packet.BundleType:
+			bdata, err := kr.OpenBundle(p, dataKey)
+			if err != nil {
+				t.Fatalf("Decrypt bundle: %v", err)
+			}
+			pkts, err := packet.ParsePackets(bdata, 0)
+			if err != nil {
+				t.Fatalf("Parse bundle: %v", err)
+			}
+			return pkts
+		}
+	}
+	t.Fatal("No bundle found")
+	return nil
+}
+
+func TestCanonicalOrder(t *testing.T) {
+	accessKey := make([]byte, AccessKeyLen)
+	r, err := New(Config{InitialKey: []byte("first"), AccessKey: accessKey, DeterministicIDs: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for _, key := range []string{"second", "third", "fourth", "fifth"} {
+		r.Add([]byte(key))
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	// Content-derived IDs are not assigned in increasing order, but the
+	// entries must be written that way, after the header MAC marker and the
+	// active key ID.
+	pkts := decodeTestBundle(t, accessKey, data)
+	if len(pkts) < 2 || pkts[0].Type != packet.HeaderMACType || pkts[1].Type != packet.ActiveKeyType {
+		t.Fatalf("Bundle does not begin with the MAC marker and active key: %v", pkts)
+	}
+	var ids []ID
+	for _, p := range pkts[2:] {
+		if p.Type != packet.KeyringEntryType {
+			t.Fatalf("Unexpected packet %v among entries", p.Type)
+		}
+		ki, err := packet.ParseKeyInfo(p.Data)
+		if err != nil {
+			t.Fatalf("ParseKeyInfo failed: %v", err)
+		}
+		ids = append(ids, ki.ID)
+	}
+	if len(ids) != 5 || !slices.IsSorted(ids) {
+		t.Errorf("Entry IDs: got %v, want 5 in increasing order", ids)
+	}
+}
+
+func TestReadUnknown(t *testing.T) {
+	accessKey := make([]byte, AccessKeyLen)
+	var kb packet.Buffer
+	kb.AddKeyringEntry(packet.KeyInfo{ID: 1, Key: []byte("apple")})
+	data := encodeTestRing(t, accessKey, &kb, packet.Packet{Type: 99, Data: []byte("from the future")})
+
+	// By default, an unknown packet type is an error.
+	if _, err := Read(bytes.NewReader(data), StaticKey(accessKey)); !errors.Is(err, ErrCorruptKeyring) {
+		t.Errorf("Read: got %v, want %v", err, ErrCorruptKeyring)
+	}
+
+	// With AllowUnknown, the packet is kept and written back.
+	opts := &ReadOptions{AllowUnknown: true}
+	r, err := ReadWith(bytes.NewReader(data), StaticKey(accessKey), opts)
+	if err != nil {
+		t.Fatalf("ReadWith failed: %v", err)
+	}
+	out, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	kr, err := packet.ParseKeyring(out)
+	if err != nil {
+		t.Fatalf("ParseKeyring failed: %v", err)
+	}
+	i := slices.IndexFunc(kr.Packets, func(p packet.Packet) bool { return p.Type == 99 })
+	if i < 0 {
+		t.Fatal("Unknown packet was not written back")
+	} else if got := string(kr.Packets[i].Data); got != "from the future" {
+		t.Errorf("Unknown packet: got %q, want %q", got, "from the future")
+	}
+	r2, err := ReadWith(bytes.NewReader(out), StaticKey(accessKey), opts)
+	if err != nil {
+		t.Fatalf("ReadWith after round trip failed: %v", err)
+	}
+	if got := string(r2.Get(1, nil)); got != "apple" {
+		t.Errorf("Get(1): got %q, want %q", got, "apple")
+	}
+	if got, want := r2.UnknownPacketTypes(), []string{"UNKNOWN_TYPE_99"}; !slices.Equal(got, want) {
+		t.Errorf("UnknownPacketTypes: got %q, want %q", got, want)
+	}
+}
+
+func TestImplicitActive(t *testing.T) {
+	accessKey := make([]byte, AccessKeyLen)
+	hasActive := func(pkts []packet.Packet) bool {
+		return slices.ContainsFunc(pkts, func(p packet.Packet) bool { return p.Type == packet.ActiveKeyType })
+	}
+
+	t.Run("OneKey", func(t *testing.T) {
+		r, err := New(Config{InitialKey: []byte("solo"), AccessKey: accessKey})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		if hasActive(decodeTestBundle(t, accessKey, buf.Bytes())) {
+			t.Error("Single-key bundle has an active key packet")
+		}
+
+		r2, err := Read(&buf, StaticKey(accessKey))
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if id, got := r2.GetActive(nil); id != 1 || string(got) != "solo" {
+			t.Errorf("Active: got %v, %q, want 1, solo", id, got)
+		}
+	})
+
+	t.Run("TwoKeys", func(t *testing.T) {
+		r, err := New(Config{InitialKey: []byte("first"), AccessKey: accessKey})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		r.Add([]byte("second"))
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		if !hasActive(decodeTestBundle(t, accessKey, buf.Bytes())) {
+			t.Error("Multi-key bundle has no active key packet")
+		}
+	})
+
+	t.Run("TwoKeysNoActive", func(t *testing.T) {
+		var kb packet.Buffer
+		kb.AddKeyringEntry(packet.KeyInfo{ID: 1, Key: []byte("first")})
+		kb.AddKeyringEntry(packet.KeyInfo{ID: 2, Key: []byte("second")})
+		_, err := Read(bytes.NewReader(encodeTestRing(t, accessKey, &kb)), StaticKey(accessKey))
+		if err == nil || !strings.Contains(err.Error(), "no active key ID found") {
+			t.Errorf("Read: got %v, want missing active key", err)
+		}
+	})
+
+	t.Run("DanglingActive", func(t *testing.T) {
+		var kb packet.Buffer
+		kb.AddActiveKey(3)
+		kb.AddKeyringEntry(packet.KeyInfo{ID: 1, Key: []byte("first")})
+		kb.AddKeyringEntry(packet.KeyInfo{ID: 2, Key: []byte("second")})
+		_, err := Read(bytes.NewReader(encodeTestRing(t, accessKey, &kb)), StaticKey(accessKey))
+		if !errors.Is(err, ErrCorruptKeyring) || !strings.Contains(err.Error(), "active key ID 3 not found") {
+			t.Errorf("Read: got %v, want dangling active key", err)
+		}
+	})
+
+	t.Run("NoKeys", func(t *testing.T) {
+		var kb packet.Buffer
+		_, err := Read(bytes.NewReader(encodeTestRing(t, accessKey, &kb)), StaticKey(accessKey))
+		if err == nil || !strings.Contains(err.Error(), "no keys found") {
+			t.Errorf("Read: got %v, want no keys", err)
+		}
+	})
+}
+
+func TestTrailingData(t *testing.T) {
+	accessKey := make([]byte, AccessKeyLen)
+	var kb packet.Buffer
+	kb.AddKeyringEntry(packet.KeyInfo{ID: 1, Key: []byte("apple")})
+
+	// encode returns a keyring whose bundle holds the given plaintext.
+	encode := func(flags byte, plain []byte) []byte {
+		dataKey, encDK, err := cipher.GenerateAndEncryptKey(accessKey, AccessKeyLen)
+		if err != nil {
+			t.Fatalf("Generate data key: %v", err)
+		}
+		_, bundle, err := cipher.EncryptWithKey(dataKey, plain, nil)
+		if err != nil {
+			t.Fatalf("Encrypt bundle: %v", err)
+		}
+		var buf packet.Buffer
+		buf.WriteHeader(1, [2]byte{0, flags})
+		buf.AddPacket(packet.DataKeyType, encDK)
+		addTestMAC(&buf, dataKey)
+		buf.AddPacket(packet.BundleType, bundle)
+		return buf.Bytes()
+	}
+	var zbuf bytes.Buffer
+	zw := packet.Deflate(&zbuf)
+	zw.Write(kb.Bytes())
+	zw.Close()
+
+	for _, tc := range []struct {
+		name  string
+		flags byte
+		plain []byte
+	}{
+		{"Plain", 0, kb.Bytes()},
+		{"Compressed", packet.FlagCompressed, zbuf.Bytes()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Without junk, the bundle is accepted.
+			if _, err := Read(bytes.NewReader(encode(tc.flags, tc.plain)), StaticKey(accessKey)); err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			for _, junk := range []string{"\x00", "xyz", "\x00\x00\x00\x00", "\x04\x00\x00\x00extra"} {
+				plain := append(bytes.Clone(tc.plain), junk...)
+				_, err := Read(bytes.NewReader(encode(tc.flags, plain)), StaticKey(accessKey))
+				if !errors.Is(err, ErrCorruptKeyring) {
+					t.Errorf("Read with junk %q: got %v, want %v", junk, err, ErrCorruptKeyring)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyInfoAttrs(t *testing.T) {
+	accessKey := make([]byte, AccessKeyLen)
+	created := time.Unix(1735689600, 0)
+
+	// Entries without attributes (as written by older versions) are accepted,
+	// and may be mixed with entries that have attributes.
+	var kb packet.Buffer
+	kb.AddActiveKey(2)
+	kb.AddKeyringEntry(packet.KeyInfo{ID: 1, Key: []byte("old")})
+	kb.AddKeyringEntry(packet.KeyInfo{ID: 2, Key: []byte("new"), Created: created})
+
+	r, err := Read(bytes.NewReader(encodeTestRing(t, accessKey, &kb)), StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	want := map[ID]packet.KeyInfo{
+		1: {ID: 1, Key: []byte("old")},
+		2: {ID: 2, Key: []byte("new"), Created: created},
+	}
+	if diff := cmp.Diff(r.view.keys, want); diff != "" {
+		t.Errorf("Keys (-got, +want):\n%s", diff)
+	}
+
+	// Unknown attributes are ignored.
+	data := []byte{0x80, 0, 0, 7, 0, 5, 99, 3, 'a', 'b', 'c', 'k', 'e', 'y'}
+	ki, err := packet.ParseKeyInfo(data)
+	if err != nil {
+		t.Fatalf("ParseKeyInfo failed: %v", err)
+	}
+	if ki.ID != 7 || string(ki.Key) != "key" || !ki.Created.IsZero() {
+		t.Errorf("ParseKeyInfo: got %+v, want ID 7, key %q", ki, "key")
+	}
+
+	// Truncated attributes are rejected.
+	for _, bad := range [][]byte{
+		{0x80, 0, 0, 1},
+		{0x80, 0, 0, 1, 0, 4, 1},
+		{0x80, 0, 0, 1, 0, 2, 1, 8},
+		{0x80, 0, 0, 1, 0, 4, 1, 2, 0, 0},
+		{0x80, 0, 0, 1, 0, 3, 3, 1, 0xff, 'k'}, // label is not UTF-8
+	} {
+		if ki, err := packet.ParseKeyInfo(bad); err == nil {
+			t.Errorf("ParseKeyInfo(%x): got %+v, want error", bad, ki)
+		}
+	}
+}
+
+func TestEncryptInMemory(t *testing.T) {
+	keys := [][]byte{[]byte("apple pie"), []byte("cherry tart"), []byte("peach cobbler")}
+	r, err := New(Config{
+		InitialKey:      keys[0],
+		AccessKey:       cipher.GenerateKey(AccessKeyLen),
+		EncryptInMemory: true,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add(keys[1])
+	r.Activate(r.Add(keys[2]))
+	if err := r.Check(); err != nil {
+		t.Errorf("Check: unexpected error: %v", err)
+	}
+
+	// No plaintext key should be stored in the ring or a view of it.
+	checkSealed := func(t *testing.T, v *View) {
+		t.Helper()
+		for id, ki := range v.keys {
+			if bytes.Contains(ki.Key, keys[id-1]) {
+				t.Errorf("Key %v is stored in plaintext: %q", id, ki.Key)
+			}
+		}
+	}
+	checkKeys := func(t *testing.T, v *View) {
+		t.Helper()
+		for i, want := range keys {
+			id := ID(i + 1)
+			if got := v.Get(id, nil); !bytes.Equal(got, want) {
+				t.Errorf("Get(%v): got %q, want %q", id, got, want)
+			}
+			if got, ok := v.ConstantTimeGet(id, nil); !ok || !bytes.Equal(got, want) {
+				t.Errorf("ConstantTimeGet(%v): got %q, %v; want %q, true", id, got, ok, want)
+			}
+		}
+		if id, got := v.GetActive(nil); id != 3 || !bytes.Equal(got, keys[2]) {
+			t.Errorf("GetActive: got %v, %q; want 3, %q", id, got, keys[2])
+		}
+	}
+	checkSealed(t, &r.view)
+	checkKeys(t, &r.view)
+	if got, want := r.TotalKeyBytes(), len(keys[0])+len(keys[1])+len(keys[2]); got != want {
+		t.Errorf("TotalKeyBytes: got %d, want %d", got, want)
+	}
+	checkSealed(t, r.View())
+	checkKeys(t, r.View())
+
+	// The stored format is the same whether or not keys are sealed.
+	akey := cipher.GenerateKey(AccessKeyLen)
+	if err := r.Rekey(akey, nil); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	r2, err := Read(&buf, StaticKey(akey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if r2.view.sealed {
+		t.Error("Read ring is sealed, want unsealed")
+	}
+	checkKeys(t, &r2.view)
+	r2.EncryptInMemory()
+	r2.EncryptInMemory() // idempotent
+	checkSealed(t, &r2.view)
+	checkKeys(t, &r2.view)
+}
+
+func TestRewrapForRecipient(t *testing.T) {
+	oldKey := cipher.GenerateKey(AccessKeyLen)
+	r, err := New(Config{
+		InitialKey:    []byte("the quick brown fox"),
+		AccessKey:     oldKey,
+		AccessKeySalt: []byte("old salt"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Activate(r.Add([]byte("jumps over the lazy dog")))
+
+	var src bytes.Buffer
+	if _, err := r.WriteTo(&src); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	orig := src.Bytes()
+
+	newKey := cipher.GenerateKey(AccessKeyLen)
+	t.Run("WrongDataKey", func(t *testing.T) {
+		var dst bytes.Buffer
+		err := RewrapForRecipient(bytes.NewReader(orig), cipher.GenerateKey(cipher.KeyLen), newKey, nil, &dst)
+		if err == nil {
+			t.Errorf("Rewrap: got %d bytes, want error", dst.Len())
+		}
+	})
+	t.Run("BadAccessKey", func(t *testing.T) {
+		var dst bytes.Buffer
+		if err := RewrapForRecipient(bytes.NewReader(orig), r.dkPlaintext, newKey[:16], nil, &dst); err == nil {
+			t.Errorf("Rewrap: got %d bytes, want error", dst.Len())
+		}
+	})
+
+	for _, salt := range []string{"", "new salt"} {
+		t.Run("Salt="+salt, func(t *testing.T) {
+			var dst bytes.Buffer
+			if err := RewrapForRecipient(bytes.NewReader(orig), r.dkPlaintext, newKey, []byte(salt), &dst); err != nil {
+				t.Fatalf("Rewrap failed: %v", err)
+			}
+			wantSalt := salt
+			if wantSalt == "" {
+				wantSalt = "old salt"
+			}
+			got, err := Read(bytes.NewReader(dst.Bytes()), AccessKeyFunc(func(s []byte) ([]byte, error) {
+				if string(s) != wantSalt {
+					t.Errorf("Access key salt: got %q, want %q", s, wantSalt)
+				}
+				return newKey, nil
+			}))
+			if err != nil {
+				t.Fatalf("Read rewrapped failed: %v", err)
+			}
+			if diff := cmp.Diff(got.view.keys, r.view.keys); diff != "" {
+				t.Errorf("Rewrapped keys (-got, +want):\n%s", diff)
+			}
+			if got.Active() != r.Active() {
+				t.Errorf("Active: got %v, want %v", got.Active(), r.Active())
+			}
+			if _, err := Read(bytes.NewReader(dst.Bytes()), StaticKey(oldKey)); err == nil {
+				t.Error("Read rewrapped with old key: got nil, want error")
+			}
+		})
+	}
+}
+
+func TestChangeAccessKey(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), AccessKeyLen)
+	r, err := New(Config{AccessKey: oldKey, InitialKey: []byte("stable")})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	dataKey := bytes.Clone(r.dkPlaintext)
+
+	if err := r.ChangeAccessKey([]byte("short"), nil); err == nil {
+		t.Error("ChangeAccessKey with a short key: got nil, want error")
+	}
+
+	newKey := bytes.Repeat([]byte("n"), AccessKeyLen)
+	if err := r.ChangeAccessKey(newKey, []byte("pepper")); err != nil {
+		t.Fatalf("ChangeAccessKey failed: %v", err)
+	}
+	if !bytes.Equal(r.dkPlaintext, dataKey) {
+		t.Error("ChangeAccessKey changed the data key")
+	}
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes()), StaticKey(oldKey)); !errors.Is(err, ErrBadAccessKey) {
+		t.Errorf("Read with old key: got %v, want %v", err, ErrBadAccessKey)
+	}
+	r2, err := Read(bytes.NewReader(buf.Bytes()), AccessKeyFunc(func(salt []byte) ([]byte, error) {
+		if got := string(salt); got != "pepper" {
+			return nil, fmt.Errorf("salt: got %q, want pepper", got)
+		}
+		return newKey, nil
+	}))
+	if err != nil {
+		t.Fatalf("Read with new key failed: %v", err)
+	}
+	if !bytes.Equal(r2.dkPlaintext, dataKey) {
+		t.Error("Stored data key does not match the original")
+	}
+	if got := string(r2.Get(r2.Active(), nil)); got != "stable" {
+		t.Errorf("Active key: got %q, want stable", got)
+	}
+}
+
+func TestReadUnbundled(t *testing.T) {
+	accessKey := make([]byte, AccessKeyLen)
+	dataKey := cipher.GenerateKey(cipher.KeyLen)
+	_, encDK, err := cipher.EncryptWithKey(accessKey, dataKey, nil)
+	if err != nil {
+		t.Fatalf("Encrypt data key: %v", err)
+	}
+
+	// A keyring in the legacy layout, with its entries at the top level.
+	var flat packet.Buffer
+	flat.WriteHeader(1, [2]byte{})
+	flat.AddPacket(packet.DataKeyType, encDK)
+	flat.AddActiveKey(2)
+	flat.AddKeyringEntry(packet.KeyInfo{ID: 1, Key: []byte("old")})
+	flat.AddKeyringEntry(packet.KeyInfo{ID: 2, Key: []byte("older"), Label: "two"})
+	data := flat.Bytes()
+
+	if _, err := Read(bytes.NewReader(data), StaticKey(accessKey)); !errors.Is(err, ErrCorruptKeyring) {
+		t.Errorf("Read legacy: got %v, want %v", err, ErrCorruptKeyring)
+	}
+	opts := &ReadOptions{AllowUnbundled: true, AllowMissingMAC: true}
+	r, err := ReadWith(bytes.NewReader(data), StaticKey(accessKey), opts)
+	if err != nil {
+		t.Fatalf("ReadWith legacy failed: %v", err)
+	}
+	if got := string(r.Get(r.Active(), nil)); got != "older" || r.Active() != 2 {
+		t.Errorf("Active key: got %v %q, want 2 older", r.Active(), got)
+	}
+	if got := r.Label(2); got != "two" {
+		t.Errorf("Label(2): got %q, want two", got)
+	}
+
+	// Writing the ring migrates it to the bundled layout.
+	out, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	rk, err := packet.ParseKeyring(out)
+	if err != nil {
+		t.Fatalf("Parse output: %v", err)
+	}
+	for _, p := range rk.Packets {
+		if p.Type == packet.KeyringEntryType {
+			t.Errorf("Output has a top-level keyring entry: %v", p)
+		}
+	}
+	if _, err := Read(bytes.NewReader(out), StaticKey(accessKey)); err != nil {
+		t.Errorf("Read migrated: %v", err)
+	}
+
+	// Entries may not be mixed with bundles, even with the option set.
+	var mixed packet.Buffer
+	mixed.Write(out)
+	mixed.AddKeyringEntry(packet.KeyInfo{ID: 3, Key: []byte("sneaky")})
+	if _, err := ReadWith(&mixed, StaticKey(accessKey), opts); !errors.Is(err, ErrCorruptKeyring) {
+		t.Errorf("ReadWith mixed: got %v, want %v", err, ErrCorruptKeyring)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	accessKey := make([]byte, AccessKeyLen)
+	r, err := New(Config{AccessKey: accessKey, InitialKey: []byte("current")})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	cur, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	// A current keyring is not migrated, and nothing is written.
+	var buf bytes.Buffer
+	if ok, err := Migrate(bytes.NewReader(cur), &buf, StaticKey(accessKey)); err != nil || ok {
+		t.Errorf("Migrate current: got %v, %v; want false, nil", ok, err)
+	} else if buf.Len() != 0 {
+		t.Errorf("Migrate current: wrote %d bytes, want 0", buf.Len())
+	}
+
+	// A legacy keyring is rewritten in the current layout.
+	var flat packet.Buffer
+	flat.WriteHeader(1, [2]byte{})
+	flat.AddPacket(packet.DataKeyType, r.dkEncrypted)
+	flat.AddKeyringEntry(packet.KeyInfo{ID: 1, Key: []byte("legacy")})
+	if ok, err := Migrate(&flat, &buf, StaticKey(accessKey)); err != nil || !ok {
+		t.Fatalf("Migrate legacy: got %v, %v; want true, nil", ok, err)
+	}
+	r2, err := Read(&buf, StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read migrated: %v", err)
+	}
+	if got := string(r2.Get(1, nil)); got != "legacy" {
+		t.Errorf("Get(1): got %q, want legacy", got)
+	}
+
+	// The access key is checked either way.
+	if _, err := Migrate(bytes.NewReader(cur), io.Discard, StaticKey(make([]byte, AccessKeyLen-1))); err == nil {
+		t.Error("Migrate with bad key: got nil, want error")
+	}
+}
+
+func TestOpenStream(t *testing.T) {
+	r, err := New(Config{
+		InitialKey: []byte("apple"),
+		AccessKey:  make([]byte, AccessKeyLen),
+		Streaming:  true,
+		Compress:   true,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("pear"))
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	rk, err := packet.ParseKeyring(data)
+	if err != nil {
+		t.Fatalf("ParseKeyring failed: %v", err)
+	}
+	var frames []packet.Packet
+	for _, p := range rk.Packets {
+		if p.Type == packet.StreamFrameType {
+			frames = append(frames, p)
+		}
+	}
+	if len(frames) == 0 {
+		t.Fatal("No stream frames found")
+	}
+
+	// The decompressed stream holds the active key and both entries.
+	dec, err := rk.OpenStream(frames, r.dkPlaintext)
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	pkts, err := packet.ParsePackets(dec, 0)
+	if err != nil {
+		t.Fatalf("ParsePackets failed: %v", err)
+	}
+	var types []packet.PacketType
+	for _, p := range pkts {
+		types = append(types, p.Type)
+	}
+	if n := slices.Index(types, packet.KeyringEntryType); n < 0 || len(types)-n != 2 {
+		t.Errorf("Stream packet types: got %v, want 2 entries", types)
+	}
+
+	if _, err := rk.OpenStream(frames, make([]byte, AccessKeyLen)); err == nil {
+		t.Error("OpenStream with the wrong key: got nil error")
+	}
+}
+
+func TestMissingMAC(t *testing.T) {
+	accessKey := make([]byte, AccessKeyLen)
+	dataKey, encDK, err := cipher.GenerateAndEncryptKey(accessKey, AccessKeyLen)
+	if err != nil {
+		t.Fatalf("Generate data key: %v", err)
+	}
+	var kb packet.Buffer
+	kb.AddKeyringEntry(packet.KeyInfo{ID: 1, Key: []byte("apple")})
+	_, bundle, err := cipher.EncryptWithKey(dataKey, kb.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("Encrypt bundle: %v", err)
+	}
+
+	// A legacy keyring without a header MAC or a marker in its bundle.
+	var buf packet.Buffer
+	buf.WriteHeader(1, [2]byte{})
+	buf.AddPacket(packet.DataKeyType, encDK)
+	buf.AddPacket(packet.BundleType, bundle)
+	data := buf.Bytes()
+
+	if _, err := Read(bytes.NewReader(data), StaticKey(bytes.Clone(accessKey))); !errors.Is(err, ErrLegacyFormat) {
+		t.Errorf("Read legacy: got %v, want %v", err, ErrLegacyFormat)
+	}
+	if err := VerifyAccessKey(bytes.NewReader(data), StaticKey(bytes.Clone(accessKey))); !errors.Is(err, ErrLegacyFormat) {
+		t.Errorf("VerifyAccessKey legacy: got %v, want %v", err, ErrLegacyFormat)
+	}
+	opts := &ReadOptions{AllowMissingMAC: true}
+	if _, err := ReadWith(bytes.NewReader(data), StaticKey(bytes.Clone(accessKey)), opts); err != nil {
+		t.Errorf("ReadWith legacy failed: %v", err)
+	}
+	if err := VerifyAccessKeyWith(bytes.NewReader(data), StaticKey(bytes.Clone(accessKey)), opts); err != nil {
+		t.Errorf("VerifyAccessKeyWith legacy failed: %v", err)
+	}
+
+	// The current format always has a header MAC, so its absence is tampering
+	// even when legacy keyrings are allowed.
+	cur := bytes.Clone(data)
+	cur[1] = CurrentFormat
+	if _, err := ReadWith(bytes.NewReader(cur), StaticKey(bytes.Clone(accessKey)), opts); !errors.Is(err, ErrTampered) {
+		t.Errorf("ReadWith current: got %v, want %v", err, ErrTampered)
+	}
+	if err := VerifyAccessKeyWith(bytes.NewReader(cur), StaticKey(bytes.Clone(accessKey)), opts); !errors.Is(err, ErrTampered) {
+		t.Errorf("VerifyAccessKeyWith current: got %v, want %v", err, ErrTampered)
+	}
+
+	// Migrating the keyring adds a header MAC.
+	var out bytes.Buffer
+	if ok, err := Migrate(bytes.NewReader(data), &out, StaticKey(bytes.Clone(accessKey))); err != nil || !ok {
+		t.Fatalf("Migrate: got %v, %v; want true, nil", ok, err)
+	}
+	if _, err := Read(&out, StaticKey(bytes.Clone(accessKey))); err != nil {
+		t.Errorf("Read migrated: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/creachadair/keyring/internal/packet"
+)
+
+// jsonView is the JSON encoding of a [View].
+type jsonView struct {
+	Active ID          `json:"active"`
+	Keys   []jsonEntry `json:"keys"`
+}
+
+// jsonEntry is the JSON encoding of a single key in a [View].
+type jsonEntry struct {
+	ID        ID        `json:"id"`
+	Label     string    `json:"label,omitempty"`
+	Key       []byte    `json:"key_base64"` // encoded as base64
+	Created   time.Time `json:"created,omitzero"`
+	NotBefore time.Time `json:"not_before,omitzero"`
+}
+
+// MarshalJSON encodes v as a JSON object. It satisfies the [json.Marshaler]
+// interface. The object has the ID of the active key (or 0) and an array of
+// the keys in increasing order of ID, each with its ID, label, contents
+// encoded as base64, and times:
+//
+//	{
+//	  "active": 2,
+//	  "keys": [
+//	    {"id": 1, "key_base64": "...", "created": "2025-01-02T15:04:05Z"},
+//	    {"id": 2, "label": "next", "key_base64": "...", "created": "..."}
+//	  ]
+//	}
+//
+// The output contains the plaintext of every key in v. A [Ring] does not
+// support this; to export the contents of a ring, use [Ring.View].
+// Use [ImportJSON] to decode the result.
+func (v *View) MarshalJSON() ([]byte, error) {
+	out := jsonView{Active: v.activeKey, Keys: make([]jsonEntry, 0, len(v.keys))}
+	for id := range v.IDs() {
+		ki := v.keys[id]
+		key := v.appendKey(nil, ki)
+		defer clear(key)
+		out.Keys = append(out.Keys, jsonEntry{
+			ID:        id,
+			Label:     ki.Label,
+			Key:       key,
+			Created:   ki.Created,
+			NotBefore: ki.NotBefore,
+		})
+	}
+	return json.Marshal(out)
+}
+
+// ImportJSON decodes a [View] from the JSON encoding produced by
+// [View.MarshalJSON]. It reports an error if the input is not valid, if any
+// key is empty, if IDs are not positive or are repeated, or if the active key
+// ID is not 0 and does not match any key.
+func ImportJSON(data []byte) (*View, error) {
+	var in jsonView
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("keyring: import JSON: %w", err)
+	}
+	keys := make(map[ID]packet.KeyInfo, len(in.Keys))
+	for i, e := range in.Keys {
+		switch {
+		case e.ID <= 0 || int64(e.ID) >= 1<<31: // see packet.KeyInfo
+			return nil, fmt.Errorf("keyring: import JSON: key %d has invalid ID %d", i+1, e.ID)
+		case len(e.Key) == 0:
+			return nil, fmt.Errorf("keyring: import JSON: key %d: %w", e.ID, ErrEmptyKey)
+		case len(e.Label) > packet.MaxLabelLen:
+			return nil, fmt.Errorf("keyring: import JSON: key %d label is %d bytes, maximum is %d", e.ID, len(e.Label), packet.MaxLabelLen)
+		case !utf8.ValidString(e.Label):
+			return nil, fmt.Errorf("keyring: import JSON: key %d label is not valid UTF-8", e.ID)
+		}
+		if _, ok := keys[e.ID]; ok {
+			return nil, fmt.Errorf("keyring: import JSON: duplicate key ID %d", e.ID)
+		}
+		keys[e.ID] = packet.KeyInfo{
+			ID:        e.ID,
+			Key:       e.Key,
+			Created:   e.Created,
+			NotBefore: e.NotBefore,
+			Label:     e.Label,
+		}
+	}
+	if _, ok := keys[in.Active]; !ok && in.Active != 0 {
+		return nil, fmt.Errorf("keyring: import JSON: active key ID %d not found", in.Active)
+	}
+	return &View{keys: keys, activeKey: in.Active}, nil
+}
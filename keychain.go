@@ -0,0 +1,72 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// KeychainKey returns an access key generation function that reads a
+// passphrase from the system keychain, stored under the given service and
+// account names, and derives the access key from it and the access key
+// generation salt as [PassphraseKey] does. The passphrase is read each time
+// the function is called, so it is not retained in memory.
+//
+// The keychain is accessed with a platform tool or API:
+//
+//   - On macOS, the "security" tool reads a generic password item from the
+//     login keychain.
+//   - On Linux, the "secret-tool" program (from libsecret) looks up a secret
+//     with attributes service and account in the Secret Service, such as
+//     GNOME Keyring or KWallet.
+//   - On Windows, the passphrase is the password of the generic credential
+//     in the Credential Manager whose target name is service and whose user
+//     name is account, as stored by "cmdkey /generic:service /user:account".
+//
+// KeychainKey reports an error if service or account is empty, if the
+// platform has no supported keychain, or if its tool is not installed.
+// It checks for these when it is called, rather than when the access key is
+// needed.
+func KeychainKey(service, account string) (AccessKeyFunc, error) {
+	if service == "" || account == "" {
+		return nil, errors.New("keyring: keychain service and account must be non-empty")
+	}
+	lookup, err := keychainLookup(service, account)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: keychain support unavailable: %w", err)
+	}
+	return func(salt []byte) ([]byte, error) {
+		secret, err := lookup()
+		if err != nil {
+			return nil, fmt.Errorf("read keychain: %w", err)
+		}
+		defer clear(secret)
+
+		// The tools terminate the secret with a newline, which is not part of it.
+		secret = bytes.TrimSuffix(secret, []byte("\n"))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("keychain item for %q/%q is empty", service, account)
+		}
+		return PassphraseKey(string(secret))(salt)
+	}, nil
+}
+
+// runKeychainTool runs the named tool with args, and returns its output.
+// Errors include the diagnostic output of the tool, if any.
+func runKeychainTool(tool string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(tool, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		clear(out)
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) != 0 {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,19 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+//go:build darwin
+
+package keyring
+
+import "os/exec"
+
+// keychainLookup returns a function that reads the password of the generic
+// password item for service and account from the macOS keychain.
+func keychainLookup(service, account string) (func() ([]byte, error), error) {
+	tool, err := exec.LookPath("security")
+	if err != nil {
+		return nil, err
+	}
+	return func() ([]byte, error) {
+		return runKeychainTool(tool, "find-generic-password", "-s", service, "-a", account, "-w")
+	}, nil
+}
@@ -0,0 +1,19 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+//go:build linux
+
+package keyring
+
+import "os/exec"
+
+// keychainLookup returns a function that reads the secret with the given
+// service and account attributes from the Secret Service.
+func keychainLookup(service, account string) (func() ([]byte, error), error) {
+	tool, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, err
+	}
+	return func() ([]byte, error) {
+		return runKeychainTool(tool, "lookup", "service", service, "account", account)
+	}, nil
+}
@@ -0,0 +1,15 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+//go:build !(linux || darwin || windows)
+
+package keyring
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// keychainLookup reports an error on platforms without keychain support.
+func keychainLookup(service, account string) (func() ([]byte, error), error) {
+	return nil, fmt.Errorf("no supported keychain on %s", runtime.GOOS)
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+//go:build windows
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	advapi32     = windows.NewLazySystemDLL("advapi32.dll")
+	procCredRead = advapi32.NewProc("CredReadW")
+	procCredFree = advapi32.NewProc("CredFree")
+)
+
+// credTypeGeneric is CRED_TYPE_GENERIC from wincred.h.
+const credTypeGeneric = 1
+
+// credential mirrors the layout of CREDENTIALW from wincred.h.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// keychainLookup returns a function that reads the password of the generic
+// credential whose target name is service from the Windows Credential
+// Manager. The user name of the credential must be account. This matches
+// credentials stored with "cmdkey /generic:service /user:account /pass".
+func keychainLookup(service, account string) (func() ([]byte, error), error) {
+	if err := procCredRead.Find(); err != nil {
+		return nil, err
+	}
+	target, err := windows.UTF16PtrFromString(service)
+	if err != nil {
+		return nil, err
+	}
+	return func() ([]byte, error) {
+		var pcred *credential
+		ok, _, err := procCredRead.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&pcred)))
+		if ok == 0 {
+			return nil, fmt.Errorf("credential %q: %w", service, err)
+		}
+		defer procCredFree.Call(uintptr(unsafe.Pointer(pcred)))
+
+		if user := windows.UTF16PtrToString(pcred.UserName); user != account {
+			return nil, fmt.Errorf("credential %q is for user %q, not %q", service, user, account)
+		}
+		blob := unsafe.Slice(pcred.CredentialBlob, pcred.CredentialBlobSize)
+		defer clear(blob)
+
+		// The Credential Manager stores passwords as UTF-16LE.
+		if len(blob)%2 != 0 {
+			return nil, errors.New("credential password is not UTF-16")
+		}
+		u16 := make([]uint16, len(blob)/2)
+		defer clear(u16)
+		for i := range u16 {
+			u16[i] = uint16(blob[2*i]) | uint16(blob[2*i+1])<<8
+		}
+		runes := utf16.Decode(u16)
+		defer clear(runes)
+		out := make([]byte, 0, utf8.UTFMax*len(runes)) // do not reallocate
+		for _, r := range runes {
+			out = utf8.AppendRune(out, r)
+		}
+		return out, nil
+	}, nil
+}
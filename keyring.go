@@ -102,25 +102,33 @@
 // or written to storage.
 //
 // Once a [View] is created, further changes to the [Ring] from which it was
-// derived do not affect the view. While a [Ring] is not safe for concurrent
-// access by multiple goroutines without separate synchronization, a [View] can
-// be shared among multiple goroutines safely.
+// derived do not affect the view. Both a [Ring] and a [View] can be shared
+// among multiple goroutines safely.
 //
 // # Deletion
 //
-// A [Ring] intentionally does not support explicit deletion of keys. Once a
-// key version has been used to encrypt data, deleting it would render those
-// data unreadable. A newly-added and unused key could be safely removed, but
-// the API omits this functionality to avoid accidental misuse. To remove a new
-// and unused key, create a new keyring and copy over the key material.
+// Use [Ring.Remove] to delete a key version that is no longer needed, for
+// example after all the data encrypted with it have been re-encrypted with a
+// newer version. Once a key version has been used to encrypt data, deleting
+// it renders those data unreadable, so use this with care. The active version
+// cannot be removed, and the ID of a removed version is never reused.
 package keyring
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"runtime"
 	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/creachadair/keyring/internal/cipher"
 	"github.com/creachadair/keyring/internal/packet"
@@ -144,15 +152,40 @@ type ID = int
 // contents.  When a keyring is read, the access key is used to recover the
 // data storage key, which can then be used to decrypt and re-encrypt the
 // contents of the keyring without further need of the access key.
+//
+// A Ring is safe for concurrent use by multiple goroutines. Methods that read
+// the ring may run concurrently with each other, while methods that modify it
+// (such as Add, Activate, and Rekey) are exclusive. Iterators returned by a
+// Ring report its contents as of the call that created them. Because the state
+// may change between calls, use a [View] to make several reads from the same
+// consistent snapshot.
 type Ring struct {
+	mu sync.RWMutex // protects the fields below
+
 	formatVersion byte
-	reserved      [2]byte // reserved format data
-	accessKeySalt []byte  // access key generation salt (optional)
-	dkEncrypted   []byte  // data storage key (for writing output)
-	dkPlaintext   []byte  // plaintext data storage key (in-memory only)
+	reserved      [2]byte          // reserved format data
+	accessKeySalt []byte           // access key generation salt (optional)
+	argon2Params  *Argon2Params    // access key derivation parameters (optional)
+	scryptParams  *ScryptParams    // access key derivation parameters (optional)
+	threshold     *ThresholdParams // access key sharing parameters (optional)
+	dkEncrypted   []byte           // data storage key (for writing output)
+	dkPlaintext   []byte           // plaintext data storage key (in-memory only)
+	moreSlots     []accessSlot     // additional access keys (see AddAccessKey)
+	wrapped       []wrappedSlot    // externally wrapped data keys (see AddWrappedKey)
+	unknown       []packet.Packet  // unrecognized top-level packets (see ReadOptions)
+	dkContext     []byte           // associated data for the data storage key (optional)
+	generation    uint64           // generation counter as of the last read
+
+	view      View // for read methods
+	maxID     ID   // maximum in-use key index
+	maxKeys   int  // if positive, the maximum number of keys (see Config.MaxKeys)
+	streaming bool // write the bundle in frames (see Config.Streaming)
+
+	openSlot int // 1 + index of the access key that unlocked the ring; 0 if none
 
-	view  View // for read methods
-	maxID ID   // maximum in-use key index
+	closed   bool              // set by Close
+	pending  AccessKeyFunc     // set by NewPending until ReadFrom succeeds
+	cleanups []runtime.Cleanup // registered by addCleanup
 }
 
 // New constructs a new [Ring] from c. At minimum, a non-empty initial key and
@@ -161,134 +194,794 @@ type Ring struct {
 func New(c Config) (*Ring, error) {
 	switch {
 	case len(c.InitialKey) == 0:
-		return nil, errors.New("keyring: initial key is empty")
+		return nil, fmt.Errorf("%w: initial key", ErrEmptyKey)
 	case len(c.AccessKey) != AccessKeyLen:
 		return nil, fmt.Errorf("keyring: access key is %d bytes, want %d", len(c.AccessKey), AccessKeyLen)
+	case c.MaxKeys < 0:
+		return nil, fmt.Errorf("keyring: invalid maximum key count %d", c.MaxKeys)
 	}
-	pkey, ekey, err := cipher.GenerateAndEncryptKey(c.AccessKey, AccessKeyLen)
+	var argon2Params *Argon2Params
+	if c.Argon2Params != nil {
+		if err := c.Argon2Params.check(); err != nil {
+			return nil, err
+		}
+		p := *c.Argon2Params
+		argon2Params = &p
+	}
+	suite, err := c.Cipher.suite()
 	if err != nil {
 		return nil, err
 	}
-	return addCleanup(&Ring{
-		formatVersion: 1,
+	var scryptParams *ScryptParams
+	if c.ScryptParams != nil {
+		if argon2Params != nil {
+			return nil, errors.New("keyring: both argon2id and scrypt parameters are set")
+		} else if err := c.ScryptParams.check(); err != nil {
+			return nil, err
+		}
+		p := *c.ScryptParams
+		scryptParams = &p
+	}
+	pkey := cipher.GenerateKey(AccessKeyLen)
+	_, ekey, err := suite.EncryptWithKey(c.AccessKey, pkey, c.Context)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: encrypt key: %w", err)
+	}
+	var flags byte
+	if c.Compress {
+		flags |= packet.FlagCompressed
+	}
+	id := ID(1)
+	if c.DeterministicIDs {
+		flags |= packet.FlagContentIDs
+		id = contentID(c.InitialKey)
+	}
+	r := addCleanup(&Ring{
+		formatVersion: CurrentFormat,
+		reserved:      [2]byte{byte(suite), flags},
 		accessKeySalt: bytes.Clone(c.AccessKeySalt),
+		argon2Params:  argon2Params,
+		scryptParams:  scryptParams,
 		dkEncrypted:   ekey,
 		dkPlaintext:   pkey,
-		maxID:         1,
+		dkContext:     bytes.Clone(c.Context),
+		maxID:         id,
+		maxKeys:       c.MaxKeys,
+		streaming:     c.Streaming,
 		view: View{
-			keys:      map[ID]packet.KeyInfo{1: {ID: 1, Key: bytes.Clone(c.InitialKey)}},
-			activeKey: 1,
+			keys:      map[ID]packet.KeyInfo{id: {ID: id, Key: bytes.Clone(c.InitialKey), Created: now()}},
+			activeKey: id,
 		},
-	}), nil
+	})
+	if c.EncryptInMemory {
+		r.EncryptInMemory()
+	}
+	return r, nil
+}
+
+// NewFromView constructs a new [Ring] from c, as [New] does, but whose keys
+// are copies of the keys in v, with the same IDs, labels, and timestamps. The
+// active key of the new ring is the active key of v, if any.
+//
+// It reports an error if c.InitialKey is set, if v has no keys, if v has more
+// keys than c.MaxKeys allows, or if c.DeterministicIDs is set and the ID of
+// some key in v is not derived from its contents.
+func NewFromView(c Config, v *View) (*Ring, error) {
+	if len(c.InitialKey) != 0 {
+		return nil, errors.New("keyring: initial key is set for a ring from a view")
+	} else if v == nil || len(v.keys) == 0 {
+		return nil, fmt.Errorf("%w: view has no keys", ErrEmptyKey)
+	} else if c.MaxKeys > 0 && len(v.keys) > c.MaxKeys {
+		return nil, fmt.Errorf("%w: view has %d keys, maximum is %d", ErrTooManyKeys, len(v.keys), c.MaxKeys)
+	}
+	keys := make(map[ID]packet.KeyInfo, len(v.keys))
+	var maxID ID
+	for id, ki := range v.keys {
+		ki = ki.Clone()
+		if v.sealed {
+			ki.Key = v.appendKey(nil, ki)
+		}
+		if c.DeterministicIDs && contentID(ki.Key) != id {
+			return nil, fmt.Errorf("keyring: key %d does not have a content-derived ID", id)
+		}
+		keys[id] = ki
+		maxID = max(maxID, id)
+	}
+
+	// Construct the ring with an arbitrary initial key, then replace its view.
+	inMemory := c.EncryptInMemory
+	c.InitialKey, c.EncryptInMemory = keys[maxID].Key, false
+	r, err := New(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, ki := range r.view.keys {
+		clear(ki.Key)
+	}
+	r.view = View{keys: keys, activeKey: v.activeKey}
+	r.maxID = maxID
+	if inMemory {
+		r.EncryptInMemory()
+	}
+	return r, nil
+}
+
+// ReadWithPassphrase parses and decrypts the binary representation of a [Ring]
+// from r, deriving the access key from passphrase. It fully consumes the
+// contents of r, and applies the same size limit as [Read].
+//
+// If the keyring stores Argon2id or scrypt parameters, the access key is
+// derived with [Argon2idKey] or [ScryptKey] using those parameters;
+// otherwise it is derived with [PassphraseKey].
+func ReadWithPassphrase(r io.Reader, passphrase string) (*Ring, error) {
+	data, err := readAllContext(context.Background(), r, DefaultMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	info, err := Inspect(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	keyFunc := passphraseKeyFunc(passphrase, info.Argon2Params, info.ScryptParams)
+	return Read(bytes.NewReader(data), keyFunc)
+}
+
+// VerifyAccessKey reads the header and unencrypted packets of a stored keyring
+// from r, and reports whether the access key returned by accessKey unlocks
+// its data storage key. It returns nil if so, or otherwise an error, which
+// wraps [ErrBadAccessKey] if the access key is wrong. If the access key is
+// right, the error wraps [ErrTampered] if the header MAC does not match, or
+// [ErrLegacyFormat] if the keyring has no header MAC, as [Read] reports.
+//
+// VerifyAccessKey stops reading at the first encrypted bundle, and does not
+// decrypt any of the keys in the keyring, so it is cheap enough to use in a
+// loop that prompts for a passphrase. It does not check that the rest of the
+// keyring is valid; [Read] may still fail for a keyring that passes.
+func VerifyAccessKey(r io.Reader, accessKey AccessKeySource) error {
+	return VerifyAccessKeyWith(r, accessKey, nil)
+}
+
+// VerifyAccessKeyWith behaves as [VerifyAccessKey], using the context from
+// opts to decrypt the data storage key, and accepting a keyring without a
+// header MAC if opts allows it. Since it does not read the bundle, it cannot
+// tell whether a MAC was removed; [ReadWith] can. The other settings of opts
+// are ignored.
+func VerifyAccessKeyWith(r io.Reader, accessKey AccessKeySource, opts *ReadOptions) error {
+	var sp slotParser
+	var mac []byte
+	var pre packet.Buffer // packets covered by the header MAC, if any
+	hdr, err := packet.ParseReaderUntil(r, func(pt packet.PacketType) bool {
+		return pt == packet.BundleType || pt == packet.StreamFrameType
+	}, func(p packet.Packet) error {
+		if mac != nil {
+			return fmt.Errorf("packet %v follows header MAC", p.Type)
+		}
+		switch p.Type {
+		case packet.HeaderMACType:
+			mac = bytes.Clone(p.Data)
+			return nil
+		case packet.DataKeyType, packet.AccessKeySaltType:
+			if err := sp.add(packet.Packet{Type: p.Type, Data: bytes.Clone(p.Data)}); err != nil {
+				return err
+			}
+		default:
+			sp.note()
+		}
+		pre.AddPacket(p.Type, p.Data)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("keyring: parse keyring: %w", err)
+	}
+	if !supportedVersion(hdr.Version) {
+		return fmt.Errorf("%w %d", ErrUnsupportedVersion, hdr.Version)
+	} else if s := hdr.Suite(); !s.IsValid() {
+		return fmt.Errorf("%w %d", ErrUnknownSuite, s)
+	}
+	slots, err := sp.finish()
+	if err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+
+	sources := flatten(accessKey)
+	for i, src := range sources {
+		sources[i] = AccessKeyFunc(func(salt []byte) ([]byte, error) {
+			akey, err := src.AccessKey(salt)
+			if err != nil {
+				return nil, fmt.Errorf("keyring: access key: %w", err)
+			}
+			return akey, nil
+		})
+	}
+	dk, _, err := unlockSlots(hdr.Suite(), slots, opts.context(), sources, true)
+	if err != nil {
+		return err
+	}
+	defer clear(dk)
+	if mac == nil {
+		if err := checkMissingMAC(hdr.Version, opts); err != nil {
+			return err
+		}
+	} else {
+		var hb packet.Buffer
+		hb.WriteHeader(hdr.Version, hdr.Reserved)
+		hb.Write(pre.Bytes())
+		macKey := cipher.MACKey(dk)
+		defer clear(macKey)
+		if !hmac.Equal(cipher.MAC(macKey, hb.Bytes()), mac) {
+			return ErrTampered
+		}
+	}
+	return nil
+}
+
+// unlockSlots tries each of sources in order, and returns the plaintext data
+// key from the first of slots that a source unlocks, along with the index of
+// that slot. A source that reports an error or does not unlock any slot is
+// skipped. If wipe is true, the access keys are zeroed before returning.
+//
+// If no source unlocks a slot, unlockSlots reports the error from the source,
+// or a combination of the errors from all of them if there is more than one.
+// A key that does not unlock any slot is reported as [ErrBadAccessKey].
+func unlockSlots(suite cipher.Suite, slots []accessSlot, extra []byte, sources []AccessKeySource, wipe bool) ([]byte, int, error) {
+	var akeys [][]byte
+	if wipe {
+		// Defer zeroing until all calls are done, since an accessKey function
+		// such as StaticKey may return the same slice each time.
+		defer func() {
+			for _, k := range akeys {
+				clear(k)
+			}
+		}()
+	}
+	errs := make([]error, len(sources))
+	for i, src := range sources {
+		dk, slot, akeyList, err := unlockWith(suite, slots, extra, src)
+		akeys = append(akeys, akeyList...)
+		if err == nil {
+			return dk, slot, nil
+		} else if len(sources) == 1 {
+			return nil, 0, err
+		}
+		errs[i] = fmt.Errorf("source %d: %w", i+1, err)
+	}
+	return nil, 0, keySources(sources).noSources(errs)
+}
+
+// unlockWith calls src with the salt of each of slots in turn, and returns the
+// plaintext data key from the first slot its result decrypts, along with the
+// index of that slot and the access keys src returned. If consecutive slots
+// share a salt, the access key is reused. It reports [ErrBadAccessKey] if no
+// slot decrypts.
+func unlockWith(suite cipher.Suite, slots []accessSlot, extra []byte, src AccessKeySource) (_ []byte, _ int, akeys [][]byte, _ error) {
+	var akey []byte
+	var lastErr error
+	for i, s := range slots {
+		if i == 0 || !bytes.Equal(s.salt, slots[i-1].salt) {
+			var err error
+			akey, err = src.AccessKey(s.salt)
+			if err != nil {
+				return nil, 0, akeys, err
+			}
+			akeys = append(akeys, akey)
+			if len(akey) != AccessKeyLen {
+				return nil, 0, akeys, fmt.Errorf("keyring: access key is %d bytes, want %d", len(akey), AccessKeyLen)
+			}
+		}
+
+		// Failure to decrypt the data key most likely indicates the wrong
+		// access key was provided, so report an error on that basis.
+		dk, err := suite.DecryptWithKey(akey, s.encDK, extra)
+		if err == nil {
+			return dk, i, akeys, nil
+		}
+		lastErr = err
+	}
+	return nil, 0, akeys, fmt.Errorf("%w: %w", ErrBadAccessKey, lastErr)
+}
+
+// passphraseKeyFunc returns an [AccessKeyFunc] that derives a key from
+// passphrase with [Argon2idKey] or [ScryptKey] if the corresponding parameters
+// are non-nil, or otherwise with [PassphraseKey].
+func passphraseKeyFunc(passphrase string, ap *Argon2Params, sp *ScryptParams) AccessKeyFunc {
+	if ap != nil {
+		return Argon2idKey(passphrase, *ap)
+	} else if sp != nil {
+		return ScryptKey(passphrase, sp.N, sp.R, sp.P)
+	}
+	return PassphraseKey(passphrase)
 }
 
 // Read parses, and decrypts the binary representation of a [Ring] from r.
 // It fully consumes the contents of r.
 //
-// The accessKey function is called to obtain the encryption key for the ring itself.
-// If the ring has a key generation salt, it is passed to the accessKey function;
-// otherwise the salt argument is nil.
-func Read(r io.Reader, accessKey AccessKeyFunc) (*Ring, error) {
-	data, err := io.ReadAll(r)
+// The accessKey source is called to obtain the encryption key for the ring
+// itself. Any [AccessKeyFunc] is a source. If the ring has a key generation
+// salt, it is passed to accessKey; otherwise the salt argument is nil. If the
+// ring has several access keys (see [Ring.AddAccessKey]), accessKey is called
+// with the salt of each in turn until one unlocks the ring. Use [FirstOf] to
+// try several sources.
+//
+// Read reports [ErrTampered] if the unencrypted packets of the stored ring do
+// not match its header MAC, and [ErrLegacyFormat] if the ring has no header
+// MAC because it was written in format version 1. Use [Migrate] to upgrade a
+// legacy keyring, or [ReadOptions.AllowMissingMAC] to read it as it is.
+//
+// Read reports [ErrTooLarge] if r contains more than [DefaultMaxSize] bytes.
+// Use [ReadWith] to set a different limit.
+func Read(r io.Reader, accessKey AccessKeySource) (*Ring, error) {
+	return readWith(context.Background(), r, accessKey, nil)
+}
+
+// CurrentFormat is the format version written by [Ring.WriteTo]. A stored
+// keyring records its format version in its header, and a change to the
+// encoding that older readers cannot understand uses a new version.
+//
+// Version 2 added the generation counter packet, which readers of version 1
+// reject. [Read] supports both versions.
+const CurrentFormat = 2
+
+// legacyFormat is the format version written before [CurrentFormat].
+const legacyFormat = 1
+
+// supportedVersion reports whether v is a format version [Read] understands.
+func supportedVersion(v byte) bool { return v == CurrentFormat || v == legacyFormat }
+
+// DefaultMaxSize is the default limit on the size in bytes of a stored keyring
+// read by [Read]. It is far larger than a keyring of typical keys requires.
+const DefaultMaxSize = 8 << 20
+
+// ReadOptions are optional settings for [ReadWith]. A nil *ReadOptions is
+// ready for use and provides default values.
+type ReadOptions struct {
+	// The maximum number of bytes to read from the input. If the input is
+	// longer, reading stops and reports [ErrTooLarge]. If zero, the limit is
+	// [DefaultMaxSize]; if negative, there is no limit.
+	MaxSize int
+
+	// If positive, the maximum number of keys the ring may hold. If the stored
+	// keyring has more keys, reading reports [ErrTooManyKeys]. The limit is
+	// kept by the ring that is read, as for [Config.MaxKeys].
+	MaxKeys int
+
+	// If true, accept a keyring in the legacy layout that stores its keyring
+	// entries (and active key ID) as unencrypted top-level packets, rather
+	// than in an encrypted bundle. Writing a ring read this way stores it in
+	// the current layout.
+	//
+	// Unlike a bundle, the entries of a legacy keyring are not authenticated
+	// by the data storage key, so anyone who can modify the stored keyring can
+	// replace its keys without knowing the access key. Use this only to
+	// migrate trusted legacy keyrings.
+	AllowUnbundled bool
+
+	// If true, accept top-level packets of types this package does not
+	// recognize, such as those added by a newer writer, rather than reporting
+	// [ErrCorruptKeyring]. The unknown packets are kept with the ring, and
+	// [Ring.WriteTo] writes them back unchanged (before the header MAC), so
+	// that reading and writing the keyring does not discard them. Their
+	// contents are not interpreted.
+	AllowUnknown bool
+
+	// If true, accept a keyring in format version 1 without a header MAC,
+	// rather than reporting [ErrLegacyFormat]. A keyring written with a header
+	// MAC records that fact in its encrypted bundle, so removing the MAC from
+	// it is still reported as [ErrTampered]. Writing a ring read this way adds
+	// a MAC.
+	//
+	// Without a header MAC, the unencrypted packets of a keyring (such as the
+	// salt and key derivation parameters) are not authenticated. Use this only
+	// to migrate trusted legacy keyrings.
+	AllowMissingMAC bool
+
+	// If non-nil, the weakest Argon2id parameters the stored keyring may use
+	// to derive its access key. If the keyring stores Argon2id parameters
+	// with fewer passes or less memory, reading reports [ErrWeakKDF] without
+	// calling the access key function. The Threads field is not checked.
+	MinArgon2Params *Argon2Params
+
+	// If non-nil, the weakest scrypt parameters the stored keyring may use to
+	// derive its access key. If the keyring stores scrypt parameters with a
+	// smaller N, R, or P, reading reports [ErrWeakKDF] without calling the
+	// access key function.
+	MinScryptParams *ScryptParams
+
+	// The context the keyring was bound to when it was created, as given by
+	// [Config.Context]. If it does not match, reading reports
+	// [ErrBadAccessKey]. The ring that is read stays bound to the same
+	// context.
+	Context []byte
+}
+
+func (o *ReadOptions) allowUnbundled() bool { return o != nil && o.AllowUnbundled }
+
+func (o *ReadOptions) allowUnknown() bool { return o != nil && o.AllowUnknown }
+
+func (o *ReadOptions) allowMissingMAC() bool { return o != nil && o.AllowMissingMAC }
+
+// checkMissingMAC reports whether a keyring in format version v may omit its
+// header MAC under opts. Only legacy keyrings were written without one.
+func checkMissingMAC(v byte, opts *ReadOptions) error {
+	if v != legacyFormat {
+		return fmt.Errorf("%w: header MAC is missing", ErrTampered)
+	} else if !opts.allowMissingMAC() {
+		return fmt.Errorf("%w: header MAC is missing", ErrLegacyFormat)
+	}
+	return nil
+}
+
+// checkKDF reports an error wrapping [ErrWeakKDF] if the stored key
+// derivation parameters are weaker than the minimums set in o.
+func (o *ReadOptions) checkKDF(ap *Argon2Params, sp *ScryptParams) error {
+	if o == nil {
+		return nil
+	}
+	if m := o.MinArgon2Params; m != nil && ap != nil && (ap.Time < m.Time || ap.Memory < m.Memory) {
+		return fmt.Errorf("%w: argon2id time=%d memory=%d, want at least time=%d memory=%d",
+			ErrWeakKDF, ap.Time, ap.Memory, m.Time, m.Memory)
+	}
+	if m := o.MinScryptParams; m != nil && sp != nil && (sp.N < m.N || sp.R < m.R || sp.P < m.P) {
+		return fmt.Errorf("%w: scrypt N=%d r=%d p=%d, want at least N=%d r=%d p=%d",
+			ErrWeakKDF, sp.N, sp.R, sp.P, m.N, m.R, m.P)
+	}
+	return nil
+}
+
+func (o *ReadOptions) context() []byte {
+	if o == nil {
+		return nil
+	}
+	return o.Context
+}
+
+func (o *ReadOptions) maxSize() int {
+	if o == nil || o.MaxSize == 0 {
+		return DefaultMaxSize
+	}
+	return o.MaxSize
+}
+
+// ReadWith behaves as [Read], using the settings from opts.
+func ReadWith(r io.Reader, accessKey AccessKeySource, opts *ReadOptions) (*Ring, error) {
+	return readWith(context.Background(), r, accessKey, opts)
+}
+
+// ReadContext behaves as [Read], but gives up and reports ctx.Err() if ctx
+// ends before the contents of r have been read, or before the accessKey
+// function is called.
+//
+// If ctx ends while a read from r is blocked, ReadContext returns without
+// waiting for it; the pending read continues until r returns, and its result
+// is discarded. The caller should close r (if possible) to release it.
+// ReadContext does not interrupt a call to accessKey that is in progress.
+func ReadContext(ctx context.Context, r io.Reader, accessKey AccessKeySource) (*Ring, error) {
+	return readWith(ctx, r, accessKey, nil)
+}
+
+// readWith implements [ReadContext] and [ReadWith].
+func readWith(ctx context.Context, r io.Reader, accessKey AccessKeySource, opts *ReadOptions) (*Ring, error) {
+	data, err := readAllContext(ctx, r, opts.maxSize())
 	if err != nil {
 		return nil, err
 	}
+	sources := flatten(accessKey)
+	for i, src := range sources {
+		sources[i] = AccessKeyFunc(func(salt []byte) ([]byte, error) {
+			// Don't invoke a possibly-expensive KDF if the caller has given up.
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			akey, err := src.AccessKey(salt)
+			if err != nil {
+				return nil, fmt.Errorf("access key: %w", err)
+			}
+			return akey, nil
+		})
+	}
+	var slot int
+	ring, err := readRing(data, opts, func(suite cipher.Suite, slots []accessSlot, _ []wrappedSlot) ([]byte, error) {
+		dk, i, err := unlockSlots(suite, slots, opts.context(), sources, false)
+		slot = i
+		return dk, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	ring.openSlot = slot + 1
+	ring.dkContext = bytes.Clone(opts.context())
+	if opts != nil && opts.MaxKeys > 0 {
+		if n := len(ring.view.keys); n > opts.MaxKeys {
+			ring.wipe()
+			return nil, fmt.Errorf("%w: stored keyring has %d keys, maximum is %d", ErrTooManyKeys, n, opts.MaxKeys)
+		}
+		ring.maxKeys = opts.MaxKeys
+	}
+	return ring, nil
+}
+
+// UnmarshalRing parses and decrypts the binary representation of a [Ring]
+// from data, as produced by [Ring.MarshalBinary] or [Ring.WriteTo]. It behaves
+// as [Read] does, and the result does not share storage with data.
+func UnmarshalRing(data []byte, accessKey AccessKeySource) (*Ring, error) {
+	return Read(bytes.NewReader(data), accessKey)
+}
+
+// ReadAndUse reads a [Ring] from r as [Read] does, calls use with a read-only
+// view of its contents, and then zeroes all the unencrypted key material of
+// the ring before returning. It returns the error from Read, if any, or else
+// the error from use. This limits the lifetime of plaintext keys to the
+// duration of the call.
+//
+// The use function must not retain the view or any slice obtained from it
+// after it returns; the contents of the view are erased when use returns.
+func ReadAndUse(r io.Reader, accessKey AccessKeySource, use func(v *View) error) error {
+	ring, err := Read(r, accessKey)
+	if err != nil {
+		return err
+	}
+	defer ring.wipe()
+	return use(&ring.view)
+}
+
+// Validate reads a stored keyring from r as [Read] does, checks the result
+// with [Ring.Check], and then zeroes all its decrypted key material. It
+// returns nil if the keyring is well-formed and unlocks with accessKey, or
+// otherwise the first error found. This is useful to verify backups without
+// keeping their keys in memory.
+//
+// Like Read, Validate decrypts every bundle and rejects any packet inside a
+// bundle that is not a keyring entry, active key ID, or maximum key ID, as
+// well as any keyring entry that does not parse.
+func Validate(r io.Reader, accessKey AccessKeySource) error {
+	ring, err := Read(r, accessKey)
+	if err != nil {
+		return err
+	}
+	defer ring.Close()
+	return ring.Check()
+}
+
+// readRing decodes the binary representation of a [Ring] from data. The
+// dataKey function is called with the cipher suite of the ring, its access
+// slots, and its wrapped data keys, in storage order, and must return the
+// plaintext data key.
+//
+// If the ring has a header MAC, readRing reports [ErrTampered] if it does not
+// match, before decrypting any bundles. A ring without a header MAC is
+// reported as described by [checkMissingMAC], or as ErrTampered if its bundles
+// record that it had one. The settings in opts (which may be nil) control
+// which legacy or unknown packets are accepted.
+func readRing(data []byte, opts *ReadOptions, dataKey func(suite cipher.Suite, slots []accessSlot, wrapped []wrappedSlot) ([]byte, error)) (*Ring, error) {
 	rk, err := packet.ParseKeyring(data)
 	if err != nil {
-		return nil, fmt.Errorf("parse keyring: %w", err)
+		return nil, fmt.Errorf("%w: parse keyring: %w", ErrCorruptKeyring, err)
 	}
-	if rk.Version != 1 {
-		return nil, fmt.Errorf("keyring: unknown format version %d", rk.Version)
+	if !supportedVersion(rk.Version) {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, rk.Version)
 	}
-	if rk.Reserved != ([2]byte{}) {
-		return nil, errors.New("keyring: reserved data are set")
+	if s := rk.Suite(); !s.IsValid() {
+		return nil, fmt.Errorf("%w %d", ErrUnknownSuite, s)
+	}
+	if unk := rk.Flags() &^ packet.KnownFlags; unk != 0 {
+		return nil, fmt.Errorf("%w %#02x", ErrUnknownFlag, unk)
 	}
 
 	// Check that the packets we found are sensible:
-	// - Exactly one data key
-	// - At most one access key salt
-	// - No unencrypted keyring entries
-	// - Otherwise only bundles
-	var encDK, salt packet.Packet
-	var bundles []packet.Packet
-	for _, p := range rk.Packets {
+	// - At least one data key, each followed by at most one access key salt
+	// - Any number of wrapped data keys, with distinct labels
+	// - At most one set of argon2id or scrypt parameters
+	// - At most one generation counter
+	// - No unencrypted keyring entries, unless opts allows them
+	// - At most one header MAC, followed only by bundles and stream frames
+	// - No unknown packet types, unless opts allows them
+	// - Otherwise only bundles and stream frames
+	var gen, kdf, mac packet.Packet
+	var bundles, frames, top, unknown []packet.Packet
+	var macPos int
+	var sp slotParser
+	var wrapped []wrappedSlot
+	for i, p := range rk.Packets {
+		if mac.IsValid() && p.Type != packet.BundleType && p.Type != packet.StreamFrameType {
+			return nil, fmt.Errorf("%w: packet %v follows header MAC", ErrCorruptKeyring, p.Type)
+		}
+		if p.Type != packet.DataKeyType && p.Type != packet.AccessKeySaltType {
+			sp.note()
+		}
 		switch p.Type {
-		case packet.DataKeyType:
-			if encDK.IsValid() {
-				return nil, errors.New("keyring: multiple data keys found")
+		case packet.HeaderMACType:
+			if mac.IsValid() {
+				return nil, fmt.Errorf("%w: multiple header MACs", ErrCorruptKeyring)
+			}
+			mac, macPos = p, i
+		case packet.DataKeyType, packet.AccessKeySaltType:
+			if err := sp.add(p); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrCorruptKeyring, err)
+			}
+		case packet.WrappedKeyType:
+			label, wk, err := packet.ParseWrappedKey(p.Data)
+			if err != nil {
+				return nil, fmt.Errorf("%w: wrapped data key: %w", ErrCorruptKeyring, err)
+			}
+			for _, w := range wrapped {
+				if w.label == label {
+					return nil, fmt.Errorf("%w: duplicate wrapped data key %q", ErrCorruptKeyring, label)
+				}
 			}
-			encDK = p
-		case packet.AccessKeySaltType:
-			if salt.IsValid() {
-				return nil, errors.New("keyring; multiple access key salts")
+			wrapped = append(wrapped, wrappedSlot{label: label, wrapped: wk})
+		case packet.Argon2ParamsType, packet.ScryptParamsType, packet.ThresholdType:
+			if kdf.IsValid() {
+				return nil, fmt.Errorf("%w: multiple key derivation parameters", ErrCorruptKeyring)
 			}
-			salt = p
-		case packet.KeyringEntryType:
-			return nil, errors.New("keyring: unencrypted keyring entry found")
+			kdf = p
+		case packet.GenerationType:
+			if gen.IsValid() {
+				return nil, fmt.Errorf("%w: multiple generation counters", ErrCorruptKeyring)
+			}
+			gen = p
+		case packet.KeyringEntryType, packet.ActiveKeyType, packet.MaxIDType:
+			if !opts.allowUnbundled() {
+				return nil, fmt.Errorf("%w: unencrypted keyring entry found", ErrCorruptKeyring)
+			}
+			top = append(top, p)
 		case packet.BundleType:
 			bundles = append(bundles, p)
+		case packet.StreamFrameType:
+			frames = append(frames, p)
 		default:
-			return nil, fmt.Errorf("keyring: invalid packet %v", p.Type)
+			if !opts.allowUnknown() {
+				return nil, fmt.Errorf("%w: invalid packet %v", ErrCorruptKeyring, p.Type)
+			}
+			unknown = append(unknown, p)
 		}
 	}
-	if !encDK.IsValid() {
-		return nil, errors.New("keyring: no data key found")
+	slots, err := sp.finish()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptKeyring, err)
+	} else if len(top) != 0 && (len(bundles) != 0 || len(frames) != 0) {
+		return nil, fmt.Errorf("%w: unencrypted keyring entries mixed with bundles", ErrCorruptKeyring)
+	}
+	var generation uint64
+	if gen.IsValid() {
+		generation, err = packet.ParseGeneration(gen.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: generation: %w", ErrCorruptKeyring, err)
+		}
 	}
 
-	akey, err := accessKey(salt.Data)
-	if err != nil {
-		return nil, fmt.Errorf("access key: %w", err)
+	var argon2Params *Argon2Params
+	var scryptParams *ScryptParams
+	var threshold *ThresholdParams
+	switch kdf.Type {
+	case packet.Argon2ParamsType:
+		argon2Params, err = parseArgon2Params(kdf.Data)
+	case packet.ScryptParamsType:
+		scryptParams, err = parseScryptParams(kdf.Data)
+	case packet.ThresholdType:
+		threshold, err = parseThreshold(kdf.Data)
 	}
-	if len(akey) != AccessKeyLen {
-		return nil, fmt.Errorf("access key is %d bytes, want %d", len(akey), AccessKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptKeyring, err)
+	} else if err := opts.checkKDF(argon2Params, scryptParams); err != nil {
+		return nil, err
 	}
 
-	// Failure to encrypt the data key most likely indicates the wrong access
-	// key was provided, so report an error on that basis.
-	plainDK, err := encDK.Decrypt(akey)
+	plainDK, err := dataKey(rk.Suite(), slots, wrapped)
 	if err != nil {
-		return nil, fmt.Errorf("invalid access key: %w", err)
+		return nil, err
+	}
+
+	// The data key is authenticated by the access key, but make sure it has
+	// the length required by the cipher before trying to use it.
+	if len(plainDK) != cipher.KeyLen {
+		return nil, fmt.Errorf("%w: data key is %d bytes, want %d", ErrCorruptKeyring, len(plainDK), cipher.KeyLen)
+	}
+
+	// The data key is correct, so a MAC mismatch means the unencrypted
+	// packets were modified. Check before decrypting the bundles.
+	if !mac.IsValid() {
+		if err := checkMissingMAC(rk.Version, opts); err != nil {
+			clear(plainDK)
+			return nil, err
+		}
+	} else {
+		var pre packet.Buffer
+		pre.WriteHeader(rk.Version, rk.Reserved)
+		for _, p := range rk.Packets[:macPos] {
+			pre.AddPacket(p.Type, p.Data)
+		}
+		macKey := cipher.MACKey(plainDK)
+		ok := hmac.Equal(cipher.MAC(macKey, pre.Bytes()), mac.Data)
+		clear(macKey)
+		if !ok {
+			clear(plainDK)
+			return nil, ErrTampered
+		}
 	}
 
 	// Now verify that we can decrypt all the bundles with the data key, and
-	// that they contain only keyring entries and (exactly) one active key.
-	var active packet.Packet
-	var entries []packet.Packet
+	// that they contain only keyring entries, (exactly) one active key, and
+	// at most one maximum key ID. The stream frames, if any, together hold
+	// the contents of one more bundle.
+	var contents [][]byte
 	for i, b := range bundles {
-		bdata, err := b.Decrypt(plainDK)
+		bdata, err := rk.OpenBundle(b, plainDK)
 		if err != nil {
-			return nil, fmt.Errorf("decrypt bundle %d: %w", i+1, err)
+			return nil, fmt.Errorf("%w: decrypt bundle %d: %w", ErrCorruptKeyring, i+1, err)
 		}
+		contents = append(contents, bdata)
+	}
+	if len(frames) != 0 {
+		sdata, err := rk.OpenStream(frames, plainDK)
+		if err != nil {
+			return nil, fmt.Errorf("%w: decrypt stream: %w", ErrCorruptKeyring, err)
+		}
+		contents = append(contents, sdata)
+	}
+
+	var groups [][]packet.Packet
+	for i, bdata := range contents {
 		pkts, err := packet.ParsePackets(bdata, 0)
 		if err != nil {
-			return nil, fmt.Errorf("parse bundle %d: %w", i+1, err)
+			return nil, fmt.Errorf("%w: parse bundle %d: %w", ErrCorruptKeyring, i+1, err)
 		}
+		groups = append(groups, pkts)
+	}
+	if len(top) != 0 {
+		groups = append(groups, top) // an unencrypted legacy "bundle"
+	}
+
+	var active, maxIDPkt packet.Packet
+	var entries []packet.Packet
+	var macMarker bool
+	for i, pkts := range groups {
 		for j, p := range pkts {
-			// An active key packet is valid, but only once.
+			// An active key packet is valid, but only once, and likewise the
+			// maximum key ID and the header MAC marker.
 			// Everything else must be a keyring entry.
-			if p.Type == packet.ActiveKeyType {
+			if p.Type == packet.HeaderMACType {
+				if macMarker || len(p.Data) != 0 {
+					return nil, fmt.Errorf("%w: bundle %d item %d: invalid header MAC marker", ErrCorruptKeyring, i+1, j+1)
+				}
+				macMarker = true
+				continue
+			} else if p.Type == packet.ActiveKeyType {
 				if active.IsValid() {
-					return nil, fmt.Errorf("bundle %d item %d: duplicate active key", i+1, j+1)
+					return nil, fmt.Errorf("%w: bundle %d item %d: duplicate active key", ErrCorruptKeyring, i+1, j+1)
 				}
 				active = p
 				continue
+			} else if p.Type == packet.MaxIDType {
+				if maxIDPkt.IsValid() {
+					return nil, fmt.Errorf("%w: bundle %d item %d: duplicate maximum key ID", ErrCorruptKeyring, i+1, j+1)
+				}
+				maxIDPkt = p
+				continue
 			} else if p.Type != packet.KeyringEntryType {
-				return nil, fmt.Errorf("bundle %d item %d: invalid packet %v", i+1, j+1, p.Type)
+				return nil, fmt.Errorf("%w: bundle %d item %d: invalid packet %v", ErrCorruptKeyring, i+1, j+1, p.Type)
 			}
 			entries = append(entries, p)
 		}
 	}
 
+	// If the bundle records a header MAC, it must not have been removed.
+	if macMarker && !mac.IsValid() {
+		return nil, fmt.Errorf("%w: header MAC was removed", ErrTampered)
+	}
+
 	// There must have been at least one key, and an active key marker.
+	// The marker may be omitted if there is only one key.
 	if len(entries) == 0 {
-		return nil, errors.New("keyring: no keys found")
-	} else if !active.IsValid() {
-		return nil, errors.New("keyring: no active key ID found")
+		return nil, fmt.Errorf("%w: no keys found", ErrCorruptKeyring)
+	} else if !active.IsValid() && len(entries) > 1 {
+		return nil, fmt.Errorf("%w: no active key ID found", ErrCorruptKeyring)
 	}
 
-	activeKeyID, err := packet.ParseActiveKey(active.Data)
-	if err != nil {
-		return nil, fmt.Errorf("active key ID: %w", err)
+	var activeKeyID ID
+	if active.IsValid() {
+		activeKeyID, err = packet.ParseActiveKey(active.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: active key ID: %w", ErrCorruptKeyring, err)
+		}
 	}
 
 	// Parse the key packets, sort them by ID, make sure there are no duplicate
@@ -301,121 +994,1174 @@ func Read(r io.Reader, accessKey AccessKeyFunc) (*Ring, error) {
 	for i, e := range entries {
 		ki, err := packet.ParseKeyInfo(e.Data)
 		if err != nil {
-			return nil, fmt.Errorf("keyring entry %d: %w", i+1, err)
+			return nil, fmt.Errorf("%w: keyring entry %d: %w", ErrCorruptKeyring, i+1, err)
 		}
 		if old, ok := keys[ki.ID]; ok {
-			return nil, fmt.Errorf("keyring: duplicate ID %v for key %d", old.ID, i+1)
+			return nil, fmt.Errorf("%w: duplicate ID %v for key %d", ErrCorruptKeyring, old.ID, i+1)
 		}
 		keys[ki.ID] = ki
 		if ki.ID > maxID {
 			maxID = ki.ID
 		}
 	}
-	if _, ok := keys[activeKeyID]; !ok {
-		return nil, fmt.Errorf("keyring: active key ID %v not found", activeKeyID)
+	if !active.IsValid() {
+		activeKeyID = maxID // the only key is implicitly active
+	}
+	if maxIDPkt.IsValid() {
+		storedMax, err := packet.ParseMaxID(maxIDPkt.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: maximum key ID: %w", ErrCorruptKeyring, err)
+		}
+		maxID = max(maxID, storedMax)
+	}
+	if _, ok := keys[activeKeyID]; !ok && activeKeyID != 0 {
+		return nil, fmt.Errorf("%w: active key ID %v not found", ErrCorruptKeyring, activeKeyID)
+	}
+	if rk.ContentIDs() {
+		for id, ki := range keys {
+			if want := contentID(ki.Key); id != want {
+				return nil, fmt.Errorf("%w: key %v has content ID %v", ErrCorruptKeyring, id, want)
+			}
+		}
+	}
+	var more []accessSlot
+	if len(slots) > 1 {
+		more = slots[1:]
 	}
 	return addCleanup(&Ring{
 		formatVersion: rk.Version,
 		reserved:      rk.Reserved,
-		accessKeySalt: salt.Data,
-		dkEncrypted:   encDK.Data,
+		accessKeySalt: slots[0].salt,
+		argon2Params:  argon2Params,
+		scryptParams:  scryptParams,
+		threshold:     threshold,
+		dkEncrypted:   slots[0].encDK,
+		moreSlots:     more,
+		wrapped:       wrapped,
+		unknown:       unknown,
 		dkPlaintext:   plainDK,
+		generation:    generation,
 		view: View{
 			keys:      keys,
 			activeKey: activeKeyID,
 		},
-		maxID: maxID,
+		maxID:     maxID,
+		streaming: len(frames) != 0,
 	}), nil
 }
 
+// FormatVersion reports the format version of the stored keyring from which r
+// was read, or [CurrentFormat] if r was not read from storage. Regardless of
+// this value, [Ring.WriteTo] always writes CurrentFormat.
+func (r *Ring) FormatVersion() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	return int(r.formatVersion)
+}
+
+// UnknownPacketTypes reports the names of the unrecognized top-level packet
+// types that r preserved from the stored keyring it was read from, in storage
+// order, as named by [Inspect]. The result is empty unless r was read with
+// [ReadOptions.AllowUnknown] from a keyring with such packets.
+func (r *Ring) UnknownPacketTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	var out []string
+	for _, p := range r.unknown {
+		out = append(out, p.Type.String())
+	}
+	return out
+}
+
 // Len reports the number of keys in r.
-func (r *Ring) Len() int { return r.view.Len() }
+func (r *Ring) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().Len()
+}
+
+// Clone returns a deep copy of r. The copy is independent of r: Subsequent
+// changes to either ring do not affect the other.
+func (r *Ring) Clone() *Ring {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	return addCleanup(&Ring{
+		formatVersion: r.formatVersion,
+		reserved:      r.reserved,
+		accessKeySalt: bytes.Clone(r.accessKeySalt),
+		argon2Params:  r.argon2Params, // not modified in place
+		scryptParams:  r.scryptParams, // not modified in place
+		threshold:     r.threshold,    // not modified in place
+		dkEncrypted:   bytes.Clone(r.dkEncrypted),
+		dkPlaintext:   bytes.Clone(r.dkPlaintext),
+		moreSlots:     slices.Clone(r.moreSlots), // slots are not modified in place
+		wrapped:       slices.Clone(r.wrapped),   // slots are not modified in place
+		unknown:       slices.Clone(r.unknown),   // packets are not modified in place
+		dkContext:     bytes.Clone(r.dkContext),
+		generation:    r.generation,
+		view:          *r.view.clone(),
+		maxID:         r.maxID,
+		maxKeys:       r.maxKeys,
+		streaming:     r.streaming,
+	})
+}
+
+// Close zeroes all the key material held by r, including the contents of
+// every stored key and both the plaintext and encrypted data storage key, and
+// marks r as closed. After r is closed, calling any other method of r will
+// panic. Views previously obtained from r are not affected. Calling Close on a
+// closed ring has no effect. It always returns nil.
+//
+// Close allows a program to erase keys from memory deterministically, rather
+// than waiting for r to be reclaimed by the garbage collector.
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	for _, c := range r.cleanups {
+		c.Stop()
+	}
+	r.wipe()
+	clear(r.dkEncrypted)
+	r.accessKeySalt, r.dkEncrypted, r.dkPlaintext, r.moreSlots = nil, nil, nil, nil
+	r.wrapped = nil
+	r.dkContext = nil
+	r.argon2Params, r.scryptParams, r.threshold = nil, nil, nil
+	r.view, r.maxID, r.cleanups = View{}, 0, nil
+	r.closed, r.pending = true, nil
+	return nil
+}
+
+// TotalKeyBytes reports the total length in bytes of all the keys in r.
+func (r *Ring) TotalKeyBytes() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().TotalKeyBytes()
+}
 
-// Active reports the current active key ID in r.
-func (r *Ring) Active() ID { return r.view.Active() }
+// Active reports the current active key ID in r, or 0 if r has no active key.
+func (r *Ring) Active() ID {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().Active()
+}
 
 // Has reports whether v contains a key with the given ID.
-func (r *Ring) Has(id ID) bool { return r.view.Has(id) }
+func (r *Ring) Has(id ID) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().Has(id)
+}
 
 // Get appends the contents of the specified key to buf, and returns the
 // resulting slice. It panics if id does not exist in r.
-func (r *Ring) Get(id ID, buf []byte) []byte { return r.view.Get(id, buf) }
+func (r *Ring) Get(id ID, buf []byte) []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().Get(id, buf)
+}
+
+// TryGet appends the contents of the specified key to buf, and returns the
+// resulting slice. Unlike [Ring.Get], it reports an error wrapping
+// [ErrUnknownKey] if id does not exist in r, rather than panicking.
+func (r *Ring) TryGet(id ID, buf []byte) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().TryGet(id, buf)
+}
+
+// ConstantTimeGet appends the contents of the specified key to buf, and
+// returns the resulting slice and true, without revealing the value of id
+// through timing or memory access patterns. If id does not exist in r, it
+// returns buf unmodified and false. See [View.ConstantTimeGet].
+func (r *Ring) ConstantTimeGet(id ID, buf []byte) ([]byte, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().ConstantTimeGet(id, buf)
+}
+
+// Find reports the ID of the key in r whose contents equal key, and whether
+// one was found, in constant time. See [View.Find].
+func (r *Ring) Find(key []byte) (ID, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().Find(key)
+}
+
+// Equal reports whether the key with the specified ID has the same contents
+// as candidate, comparing them in constant time. It returns false if id does
+// not exist in r. See [View.Equal].
+func (r *Ring) Equal(id ID, candidate []byte) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().Equal(id, candidate)
+}
+
+// CreatedAt reports the creation time of the specified key, or the zero time
+// if it is not known. It panics if id does not exist in r.
+func (r *Ring) CreatedAt(id ID) time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().CreatedAt(id)
+}
+
+// Label reports the label of the specified key, or "" if it has none.
+// It panics if id does not exist in r.
+func (r *Ring) Label(id ID) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().Label(id)
+}
+
+// SetLabel sets the label of the specified key, replacing any previous label.
+// If label == "", the key has no label. It panics if id does not exist in r,
+// or if label is not valid UTF-8 or is longer than 255 bytes.
+func (r *Ring) SetLabel(id ID, label string) {
+	if len(label) > packet.MaxLabelLen {
+		panic(fmt.Sprintf("keyring: label is %d bytes, maximum is %d", len(label), packet.MaxLabelLen))
+	} else if !utf8.ValidString(label) {
+		panic("keyring: label is not valid UTF-8")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	ki, ok := r.view.keys[id]
+	if !ok {
+		panic(fmt.Sprintf("keyring: no such key: %v", id))
+	}
+	ki.Label = label
+	r.view.keys[id] = ki
+}
+
+// NotBefore reports the time before which the specified key is not valid, or
+// the zero time if the key is valid immediately. It panics if id does not
+// exist in r.
+func (r *Ring) NotBefore(id ID) time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().NotBefore(id)
+}
+
+// SetNotBefore sets the time before which the specified key is not valid.
+// A key that is not yet valid is not reported by [Ring.EligibleIDs], which
+// allows a new key to be staged before it is put into use. If t is zero, the
+// key is valid immediately. The time is stored with a precision of one second.
+// It panics if id does not exist in r.
+func (r *Ring) SetNotBefore(id ID, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	ki, ok := r.view.keys[id]
+	if !ok {
+		panic(fmt.Sprintf("keyring: no such key: %v", id))
+	}
+	if !t.IsZero() {
+		t = t.Truncate(time.Second)
+	}
+	ki.NotBefore = t
+	r.view.keys[id] = ki
+}
 
 // GetActive appends the contents of the active key to buf, and returns active
-// ID and the updated slice.
-func (r *Ring) GetActive(buf []byte) (ID, []byte) { return r.view.GetActive(buf) }
+// ID and the updated slice. It panics if r has no active key.
+func (r *Ring) GetActive(buf []byte) (ID, []byte) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().GetActive(buf)
+}
+
+// GetActiveInfo appends the contents of the active key to buf, and returns the
+// active ID, the creation time of the active key, and the updated slice.
+// The creation time is zero if it is not known. It panics if r has no active
+// key.
+func (r *Ring) GetActiveInfo(buf []byte) (ID, time.Time, []byte) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().GetActiveInfo(buf)
+}
+
+// CopyActive copies the contents of the active key into dst, and returns the
+// active ID and the number of bytes copied. See [View.CopyActive].
+func (r *Ring) CopyActive(dst []byte) (ID, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().CopyActive(dst)
+}
+
+// IDs returns an iterator over the IDs of all the keys in r, in increasing
+// order. The IDs need not be contiguous, since keys may have been removed.
+// The iterator reports the IDs present when IDs was called.
+func (r *Ring) IDs() iter.Seq[ID] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Values(slices.Collect(r.openView().IDs()))
+}
+
+// Keys returns an iterator over the IDs and contents of all the keys in r, in
+// increasing order of ID. Each key is a fresh copy, which the caller may
+// modify without affecting r. The iterator reports the keys present when
+// Keys was called.
+func (r *Ring) Keys() iter.Seq2[ID, []byte] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().clone().Keys()
+}
+
+// EligibleIDs returns an iterator over the IDs of the keys in r that are
+// eligible for use with new data, in increasing order. A key is eligible
+// unless it has a not-before time later than the current time. The iterator
+// reports the IDs eligible when EligibleIDs was called.
+func (r *Ring) EligibleIDs() iter.Seq[ID] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Values(slices.Collect(r.openView().EligibleIDs()))
+}
 
 // Activate activates the specified key ID in r. It has no effect if the given
 // key ID is already active. It panics if id does not exist in r.
 func (r *Ring) Activate(id ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
 	if _, ok := r.view.keys[id]; !ok {
 		panic(fmt.Sprintf("keyring: no such key: %v", id))
 	}
 	r.view.activeKey = id
 }
 
+// TryActivate activates the specified key ID in r, as [Ring.Activate] does.
+// Unlike Activate, it reports an error wrapping [ErrUnknownKey] if id does not
+// exist in r, rather than panicking.
+func (r *Ring) TryActivate(id ID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if _, ok := r.view.keys[id]; !ok {
+		return fmt.Errorf("%w: %v", ErrUnknownKey, id)
+	}
+	r.view.activeKey = id
+	return nil
+}
+
+// Deactivate clears the active key of r, so that [Ring.Active] reports 0.
+// A ring with no active key can still be used to retrieve any of its keys by
+// ID, but methods that use the active key, such as [Ring.GetActive], will
+// panic. Use [Ring.Activate] to activate a key again.
+func (r *Ring) Deactivate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	r.view.activeKey = 0
+}
+
+// Remove removes the specified key from r, zeroes its contents, and reports
+// whether it was present. The ID of a removed key is not reused by subsequent
+// additions. It panics if id is the active key ID.
+func (r *Ring) Remove(id ID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if id != 0 && id == r.view.activeKey {
+		panic(fmt.Sprintf("keyring: cannot remove active key: %v", id))
+	}
+	ki, ok := r.view.keys[id]
+	if !ok {
+		return false
+	}
+	clear(ki.Key)
+	delete(r.view.keys, id)
+	return true
+}
+
+// Compact renumbers the keys of r to 1..N in increasing order of their
+// current IDs, where N is the number of keys, and updates the active key ID
+// to match. It returns a map from each old ID to its new ID, including IDs
+// that did not change. After compaction, the next key added to r has ID N+1.
+//
+// Compaction undoes the guarantee of [Ring.Remove] that the IDs of removed
+// keys are not reused. Any data that refer to keys of r by ID, such as
+// ciphertexts from [Ring.SealWithActive], must be updated with the result,
+// or they may be mistaken for data that refer to a different key.
+//
+// Compact panics if r has [Config.DeterministicIDs] set.
+func (r *Ring) Compact() map[ID]ID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if r.contentIDs() {
+		panic("keyring: cannot compact a ring with deterministic IDs")
+	}
+	ids := slice.MapKeys(r.view.keys)
+	slices.Sort(ids)
+	remap := make(map[ID]ID, len(ids))
+	keys := make(map[ID]packet.KeyInfo, len(ids))
+	for i, old := range ids {
+		ki := r.view.keys[old]
+		ki.ID = i + 1
+		keys[ki.ID] = ki
+		remap[old] = ki.ID
+	}
+	r.view.keys = keys
+	if r.view.activeKey != 0 {
+		r.view.activeKey = remap[r.view.activeKey]
+	}
+	r.maxID = len(ids)
+	return remap
+}
+
 // AddRandom adds a new randomly-generated n-byte key to r, and returns its ID.
 // It is shorthand for calling [Ring.Add] with a randomly-generated key.
-// It will panic if n ≤ 0.
-func (r *Ring) AddRandom(n int) ID { return r.addBytes(RandomKey(n)) }
+// It will panic if n ≤ 0, or if r already holds its maximum number of keys
+// (see [Config.MaxKeys]).
+func (r *Ring) AddRandom(n int) ID {
+	id, err := r.AddRandomFrom(crand.Reader, n)
+	if err != nil {
+		panic(err) // crypto/rand does not report errors, so r is full
+	}
+	return id
+}
+
+// AddRandomFrom adds a new n-byte key read from src to r, and returns its ID.
+// It reports an error without modifying r if src does not provide n bytes, or
+// if r already holds its maximum number of keys (see [Config.MaxKeys]). The
+// latter error wraps [ErrTooManyKeys]. It will panic if n ≤ 0.
+//
+// Use this to generate keys from a source other than [crypto/rand], such as a
+// hardware random number generator, or a deterministic source for testing.
+func (r *Ring) AddRandomFrom(src io.Reader, n int) (ID, error) {
+	if n <= 0 {
+		panic("keyring: key length must be positive")
+	}
+	key := make([]byte, n)
+	if _, err := io.ReadFull(src, key); err != nil {
+		clear(key)
+		return 0, fmt.Errorf("keyring: read random key: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if err := r.checkRoom(); err != nil {
+		clear(key)
+		return 0, err
+	}
+	id, _, err := r.addBytes(key)
+	return id, err
+}
 
 // Add adds the specified non-empty key to r and returns its new ID.
 // If r is empty, the The added key is not marked active; use [Ring.Activate]
-// to make it active. It panics if len(key) == 0.
+// to make it active. It panics if len(key) == 0, if r already holds its
+// maximum number of keys (see [Config.MaxKeys]), or if r has already assigned
+// the largest key ID, 1<<31 - 1.
+//
+// If r has [Config.DeterministicIDs] set, the ID is derived from the contents
+// of key. If r already has a key with the same contents, Add returns its ID
+// and does not change r. If the ID belongs to a key with different contents,
+// Add panics with an error wrapping [ErrIDCollision].
 func (r *Ring) Add(key []byte) ID {
 	if len(key) == 0 {
 		panic("keyring: empty key")
 	}
-	return r.addBytes(bytes.Clone(key))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if err := r.checkRoom(); err != nil {
+		panic(err)
+	}
+	id, _, err := r.addBytes(bytes.Clone(key))
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// AddLabeled adds the specified non-empty key to r with the given label, and
+// returns its new ID. The label is stored with the key, and can be recovered
+// with [Ring.Label]. It panics if len(key) == 0, if label is not valid UTF-8
+// or is longer than 255 bytes, or if r already holds its maximum number of
+// keys (see [Config.MaxKeys]). IDs are assigned as for [Ring.Add]; if r
+// already has the same key, its label is not changed.
+func (r *Ring) AddLabeled(label string, key []byte) ID {
+	if len(label) > packet.MaxLabelLen {
+		panic(fmt.Sprintf("keyring: label is %d bytes, maximum is %d", len(label), packet.MaxLabelLen))
+	} else if !utf8.ValidString(label) {
+		panic("keyring: label is not valid UTF-8")
+	} else if len(key) == 0 {
+		panic("keyring: empty key")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if err := r.checkRoom(); err != nil {
+		panic(err)
+	}
+	id, added, err := r.addBytes(bytes.Clone(key))
+	if err != nil {
+		panic(err)
+	} else if added {
+		ki := r.view.keys[id]
+		ki.Label = label
+		r.view.keys[id] = ki
+	}
+	return id
+}
+
+// Merge adds to r a copy of each key in other whose contents are not already
+// stored in r, and returns the number of keys added. Each added key is given a
+// new ID in r, in increasing order of its ID in other, and keeps its label and
+// timestamps. Keys with the same contents as a key already in r (including
+// one added earlier by the same Merge) are skipped, so that merging the same
+// keys more than once has no further effect. The active key of r is not
+// changed. It reports an error if other == nil.
+//
+// If adding a key would exceed the maximum number of keys for r (see
+// [Config.MaxKeys]), Merge stops and reports an error wrapping
+// [ErrTooManyKeys], along with the number of keys added before that point. It
+// stops in the same way if a key cannot be added because its ID collides with
+// another key (see [Config.DeterministicIDs]).
+func (r *Ring) Merge(other *View) (added int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if other == nil {
+		return 0, errors.New("keyring: merge from nil view")
+	}
+	var have [][]byte
+	for _, key := range r.view.Keys() {
+		have = append(have, key)
+	}
+	defer func() {
+		for _, key := range have {
+			clear(key)
+		}
+	}()
+	for id, key := range other.Keys() {
+		if slices.ContainsFunc(have, func(k []byte) bool { return subtle.ConstantTimeCompare(k, key) == 1 }) {
+			clear(key)
+			continue
+		}
+		if err := r.checkRoom(); err != nil {
+			clear(key)
+			return added, err
+		}
+		have = append(have, key)
+		src := other.keys[id]
+		nid, _, err := r.addBytes(bytes.Clone(key))
+		if err != nil {
+			return added, err
+		}
+		ki := r.view.keys[nid]
+		ki.Label, ki.NotBefore = src.Label, src.NotBefore
+		if !src.Created.IsZero() {
+			ki.Created = src.Created
+		}
+		r.view.keys[nid] = ki
+		added++
+	}
+	return added, nil
+}
+
+// Replace replaces the contents of the specified key in r with a copy of key,
+// and zeroes the previous contents. The ID, label, and timestamps of the key
+// are not changed. It reports an error if id does not exist in r, if key is
+// empty, or if r has [Config.DeterministicIDs] set.
+func (r *Ring) Replace(id ID, key []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	ki, ok := r.view.keys[id]
+	if r.contentIDs() {
+		return errors.New("keyring: cannot replace a key with a deterministic ID")
+	} else if !ok {
+		return fmt.Errorf("%w: %v", ErrUnknownKey, id)
+	} else if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	clear(ki.Key)
+	ki.Key = bytes.Clone(key)
+	if r.view.sealed {
+		ki.Key = sealKey(ki.Key)
+	}
+	r.view.keys[id] = ki
+	return nil
 }
 
 // Rekey generates a new data storage key for r, and changes the access key to
 // the provided value. If an error occurs, the current state of r is unchanged.
 // The accessKey must be exactly [AccessKeyLen] bytes; the salt may be empty or nil.
+// Any Argon2id, scrypt, or threshold parameters stored with r are discarded;
+// use [Ring.RekeyArgon2id] or [Ring.RekeyScrypt] to derive the new access key
+// from a passphrase and record its parameters. Any additional access keys
+// added by [Ring.AddAccessKey], and any wrapped data keys added by
+// [Ring.AddWrappedKey], are removed.
 func (r *Ring) Rekey(accessKey, accessKeySalt []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	return r.rekey(accessKey, accessKeySalt)
+}
+
+// rekey implements [Ring.Rekey]. The caller must hold r.mu exclusively.
+func (r *Ring) rekey(accessKey, accessKeySalt []byte) error {
 	if len(accessKey) != AccessKeyLen {
 		return fmt.Errorf("keyring: access key is %d bytes, want %d", len(accessKey), AccessKeyLen)
 	}
-	pkey, ekey, err := cipher.GenerateAndEncryptKey(accessKey, AccessKeyLen)
+	pkey := cipher.GenerateKey(AccessKeyLen)
+	_, ekey, err := r.suite().EncryptWithKey(accessKey, pkey, r.dkContext)
 	if err != nil {
-		return err
+		return fmt.Errorf("keyring: encrypt key: %w", err)
 	}
 	r.dkPlaintext = pkey
 	r.dkEncrypted = ekey
+	r.moreSlots, r.wrapped = nil, nil // they do not unlock the new data key
 	r.accessKeySalt = bytes.Clone(accessKeySalt)
+	r.argon2Params, r.scryptParams, r.threshold = nil, nil, nil
+	return nil
+}
+
+// ChangeAccessKey changes the access key of r to the provided value, and
+// re-encrypts the current data storage key with it. Unlike [Ring.Rekey], the
+// data storage key itself is not changed, so a copy of r written before the
+// change can still be decrypted by anyone who holds the data key. Use
+// ChangeAccessKey when only the passphrase changes, and [Ring.Rekey] when the
+// data key may have been exposed.
+//
+// The bundle of keys is encrypted with the data key each time r is written,
+// with a fresh random nonce, so its ciphertext differs between writes whether
+// or not the access key has changed. ChangeAccessKey saves the cost of
+// generating a new data key, but does not make the encoded bundle stable.
+//
+// The accessKey must be exactly [AccessKeyLen] bytes; the salt may be empty
+// or nil. Any Argon2id, scrypt, or threshold parameters stored with r are
+// discarded. If r has several access keys, only the first is changed. If an
+// error occurs, the current state of r is unchanged.
+func (r *Ring) ChangeAccessKey(accessKey, accessKeySalt []byte) error {
+	if len(accessKey) != AccessKeyLen {
+		return fmt.Errorf("keyring: access key is %d bytes, want %d", len(accessKey), AccessKeyLen)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if err := r.wrapDataKey(accessKey, accessKeySalt); err != nil {
+		return err
+	}
+	r.argon2Params, r.scryptParams, r.threshold = nil, nil, nil
+	return nil
+}
+
+// wrapDataKey re-encrypts the current data storage key of r with accessKey,
+// and records accessKeySalt. The caller must hold r.mu exclusively.
+func (r *Ring) wrapDataKey(accessKey, accessKeySalt []byte) error {
+	_, ekey, err := r.suite().EncryptWithKey(accessKey, r.dkPlaintext, r.dkContext)
+	if err != nil {
+		return fmt.Errorf("encrypt key: %w", err)
+	}
+	r.dkEncrypted = ekey
+	r.accessKeySalt = bytes.Clone(accessKeySalt)
+	return nil
+}
+
+// ChangePassphrase changes the passphrase from which an access key of r is
+// derived. It first derives an access key from oldPassphrase, using the same
+// function as [ReadWithPassphrase] and the salt of each access key of r in
+// turn, and checks whether it unlocks the data storage key. If none does, it
+// reports [ErrWrongPassphrase] and does not modify r.
+//
+// Otherwise, it derives a new access key from newPassphrase with a fresh
+// random salt, using the same key derivation function and parameters as the
+// old one, and re-encrypts the data storage key with it in place of the access
+// key that matched. The other access keys (see [Ring.AddAccessKey]) and the
+// data storage key itself are not changed.
+func (r *Ring) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	r.mu.RLock()
+	r.checkOpen()
+	slots := append([]accessSlot{{salt: r.accessKeySalt, encDK: r.dkEncrypted}}, r.moreSlots...)
+	ap, sp := r.argon2Params, r.scryptParams
+	suite, extra := r.suite(), bytes.Clone(r.dkContext)
+	shared := r.threshold != nil
+	r.mu.RUnlock()
+	if shared {
+		return errors.New("keyring: access key is not derived from a passphrase")
+	}
+
+	// Derive the keys without holding the lock, since this is deliberately
+	// slow. Slots are not modified in place, so the snapshot remains valid.
+	oldKeyFunc := passphraseKeyFunc(oldPassphrase, ap, sp)
+	match := -1
+	var matchDK []byte
+	for i, slot := range slots {
+		oldKey, err := oldKeyFunc(bytes.Clone(slot.salt))
+		if err != nil {
+			return err
+		}
+		dk, err := suite.DecryptWithKey(oldKey, slot.encDK, extra)
+		clear(oldKey)
+		if err == nil {
+			match, matchDK = i, dk
+			break
+		}
+	}
+	if match < 0 {
+		return ErrWrongPassphrase
+	}
+	defer clear(matchDK)
+	newSalt := GenerateSalt(16)
+	newKey, err := passphraseKeyFunc(newPassphrase, ap, sp)(newSalt)
+	if err != nil {
+		return err
+	}
+	defer clear(newKey)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if r.argon2Params != ap || r.scryptParams != sp || !r.hasSlot(match, slots[match]) {
+		return errors.New("keyring: access key changed concurrently")
+	} else if subtle.ConstantTimeCompare(matchDK, r.dkPlaintext) != 1 {
+		return ErrWrongPassphrase
+	}
+	if match == 0 {
+		return r.wrapDataKey(newKey, newSalt)
+	}
+	_, ekey, err := r.suite().EncryptWithKey(newKey, r.dkPlaintext, r.dkContext)
+	if err != nil {
+		return fmt.Errorf("encrypt key: %w", err)
+	}
+	r.moreSlots = slices.Clone(r.moreSlots) // do not modify a shared array
+	r.moreSlots[match-1] = accessSlot{salt: newSalt, encDK: ekey}
+	return nil
+}
+
+// hasSlot reports whether the access key of r at index i is still s.
+// The caller must hold r.mu.
+func (r *Ring) hasSlot(i int, s accessSlot) bool {
+	cur := accessSlot{salt: r.accessKeySalt, encDK: r.dkEncrypted}
+	if i > 0 {
+		if i > len(r.moreSlots) {
+			return false
+		}
+		cur = r.moreSlots[i-1]
+	}
+	return bytes.Equal(cur.salt, s.salt) && bytes.Equal(cur.encDK, s.encDK)
+}
+
+// RekeyArgon2id generates a new data storage key for r, and changes the access
+// key to one derived by [Argon2idKey] from passphrase with the given parameters
+// and a new random salt. The salt and the parameters are stored with r, so
+// that a reader can derive the same access key. If an error occurs, the
+// current state of r is unchanged.
+func (r *Ring) RekeyArgon2id(passphrase string, params Argon2Params) error {
+	salt := GenerateSalt(16)
+
+	// Derive the key without holding the lock, since it is deliberately slow.
+	akey, err := Argon2idKey(passphrase, params)(salt)
+	if err != nil {
+		return err
+	}
+	defer clear(akey)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if err := r.rekey(akey, salt); err != nil {
+		return err
+	}
+	r.argon2Params = &params
+	return nil
+}
+
+// RekeyScrypt generates a new data storage key for r, and changes the access
+// key to one derived by [ScryptKey] from passphrase with the cost parameters
+// n, rc, and p and a new random salt. The salt and the parameters are stored
+// with r, so that a reader can derive the same access key. If an error
+// occurs, the current state of r is unchanged.
+func (r *Ring) RekeyScrypt(passphrase string, n, rc, p int) error {
+	salt := GenerateSalt(16)
+
+	// Derive the key without holding the lock, since it is deliberately slow.
+	akey, err := ScryptKey(passphrase, n, rc, p)(salt)
+	if err != nil {
+		return err
+	}
+	defer clear(akey)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if err := r.rekey(akey, salt); err != nil {
+		return err
+	}
+	r.scryptParams = &ScryptParams{N: n, R: rc, P: p}
+	return nil
+}
+
+// RekeyVerified is like [Ring.Rekey], but first checks that oldAccessKey unlocks
+// the stored data storage key of r. If not, it reports [ErrBadAccessKey] and
+// does not modify r. This requires the caller to know the current access key,
+// even though r already holds the plaintext of the data storage key.
+func (r *Ring) RekeyVerified(oldAccessKey, newAccessKey, newSalt []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if !r.unlockedBy(oldAccessKey) {
+		return ErrBadAccessKey
+	}
+	return r.rekey(newAccessKey, newSalt)
+}
+
+// AccessKeyFuncWorks reports whether accessKey, given the access key generation
+// salt stored in r, produces an access key that unlocks the data storage key of
+// r. It does not modify r. This is useful to check that a new access key
+// function is compatible with an existing keyring before switching to it.
+func (r *Ring) AccessKeyFuncWorks(accessKey AccessKeyFunc) bool {
+	r.mu.RLock()
+	r.checkOpen()
+	salt := bytes.Clone(r.accessKeySalt)
+	r.mu.RUnlock()
+
+	// Call accessKey without holding the lock, since it may be slow.
+	akey, err := accessKey(salt)
+	if err != nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	return r.unlockedBy(akey)
+}
+
+// unlockedBy reports whether akey decrypts the data storage key of r.
+func (r *Ring) unlockedBy(akey []byte) bool {
+	if len(akey) != AccessKeyLen {
+		return false
+	}
+	dk, err := r.suite().DecryptWithKey(akey, r.dkEncrypted, r.dkContext)
+	if err != nil {
+		return false
+	}
+	defer clear(dk)
+	return subtle.ConstantTimeCompare(dk, r.dkPlaintext) == 1
+}
+
+// Check verifies the internal consistency of r, and reports an error
+// describing the first invariant that does not hold. A nil error means that
+// every key has a valid ID matching its index, no key is empty, the active key
+// exists, and the data storage key has the length required by the cipher. If
+// r has [Config.DeterministicIDs] set, each ID must also match the contents of
+// its key.
+// The rings returned by [New] and [Read] always satisfy these invariants.
+func (r *Ring) Check() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	ids := slice.MapKeys(r.view.keys)
+	slices.Sort(ids)
+	for _, id := range ids {
+		ki := r.view.keys[id]
+		switch {
+		case id <= 0 || int64(id) >= 1<<31: // see packet.KeyInfo
+			return fmt.Errorf("%w: invalid key ID %v", ErrCorruptKeyring, id)
+		case ki.ID != id:
+			return fmt.Errorf("%w: key %v has ID %v", ErrCorruptKeyring, id, ki.ID)
+		case r.view.keyLen(ki) <= 0:
+			return fmt.Errorf("%w: key %v is empty", ErrCorruptKeyring, id)
+		case id > r.maxID:
+			return fmt.Errorf("%w: key %v exceeds maximum ID %v", ErrCorruptKeyring, id, r.maxID)
+		}
+		if r.contentIDs() {
+			key := r.view.appendKey(nil, ki)
+			want := contentID(key)
+			clear(key)
+			if id != want {
+				return fmt.Errorf("%w: key %v has content ID %v", ErrCorruptKeyring, id, want)
+			}
+		}
+	}
+	if _, ok := r.view.keys[r.view.activeKey]; !ok && r.view.activeKey != 0 {
+		return fmt.Errorf("%w: active key ID %v not found", ErrCorruptKeyring, r.view.activeKey)
+	}
+	if len(r.dkPlaintext) != cipher.KeyLen {
+		return fmt.Errorf("%w: data key is %d bytes, want %d", ErrCorruptKeyring, len(r.dkPlaintext), cipher.KeyLen)
+	}
 	return nil
 }
 
 // WriteTo encrypts and encodes r in binary format and writes the result to w.
 // It satisfies the [io.WriterTo] interface.
+//
+// The encoding includes a generation counter one greater than the generation
+// of the stored keyring from which r was read (if any), so that concurrent
+// writers can detect each other's changes. See [UpdateFile].
+//
+// The packets of the encoding are always written in the same canonical order,
+// with the keys in increasing order of ID, so two rings with the same contents
+// have the same layout. The encrypted contents still differ between writes,
+// since each write uses fresh nonces; use [Ring.WriteDeterministic] if the
+// bytes must be reproducible.
+//
+// If r was created with [Config.Streaming] set, or read from a keyring that
+// was written that way, WriteTo encrypts and writes the keys incrementally in
+// frames, rather than building the whole encrypted bundle in memory first.
 func (r *Ring) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	if r.streaming {
+		return r.writeStream(w)
+	}
+	root, err := r.encode(false)
+	if err != nil {
+		return 0, err
+	}
+	defer clear(root.Bytes())
+	return root.WriteTo(w)
+}
+
+// WriteDeterministic encrypts and encodes r in binary format and writes the
+// result to w, as [Ring.WriteTo] does, except that the nonce for the encrypted
+// bundle of keys is derived from the data storage key and the contents of the
+// bundle, rather than chosen at random. Writing a ring whose contents and
+// generation have not changed thus produces identical output, which suits
+// content-addressed storage. The result can be read by [Read] as usual.
+// WriteDeterministic always writes a single bundle, even if r would
+// otherwise be written in frames (see [Config.Streaming]).
+//
+// The tradeoff is that deterministic encryption reveals when two encodings
+// of rings sharing a data storage key contain exactly the same keys, which
+// random nonces conceal. Because the nonce depends on the contents, distinct
+// contents still get distinct nonces, so the nonce is not reused for
+// different plaintexts, unlike a scheme based on a counter that might be
+// repeated. Use [Ring.WriteTo] if equality of contents should not be visible.
+func (r *Ring) WriteDeterministic(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	root, err := r.encode(true)
+	if err != nil {
+		return 0, err
+	}
+	defer clear(root.Bytes())
+	return root.WriteTo(w)
+}
+
+// MarshalBinary encrypts and encodes r in binary format, and returns the same
+// bytes that [Ring.WriteTo] would write. It satisfies the
+// [encoding.BinaryMarshaler] interface. Use [UnmarshalRing] to decode the
+// result.
+func (r *Ring) MarshalBinary() ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	if r.streaming {
+		var buf bytes.Buffer
+		if _, err := r.writeStream(&buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	root, err := r.encode(false)
+	if err != nil {
+		return nil, err
+	}
+	return root.Bytes(), nil
+}
+
+// encode encrypts and encodes r in binary format into a new buffer. If
+// deterministic is true, the bundle nonce is derived from its contents.
+// The caller must hold r.mu.
+func (r *Ring) encode(deterministic bool) (*packet.Buffer, error) {
+	var kb packet.Buffer
+	if r.compressed() {
+		zw := packet.Deflate(&kb)
+		r.writeBundle(zw) // cannot fail
+		zw.Close()
+	} else {
+		r.writeBundle(&kb) // cannot fail
+	}
+	defer clear(kb.Bytes())
+
+	encrypt := r.suite().EncryptWithKey
+	if deterministic {
+		encrypt = r.suite().EncryptDeterministic
+	}
+	_, data, err := encrypt(r.dkPlaintext, kb.Bytes(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt ring: %w", err)
+	}
+
+	// Size the output for the header and all the packets, including the fixed
+	// size parameter and generation packets, so it is allocated only once.
 	var root packet.Buffer
-	root.WriteHeader(r.formatVersion, r.reserved)
+	root.Grow(64 + len(r.dkEncrypted) + len(r.accessKeySalt) + len(data))
+	r.encodeHeader(&root)
+	root.AddPacket(packet.BundleType, data)
+	return &root, nil
+}
+
+// streamFrameSize is the plaintext size of the frames of a streamed bundle.
+const streamFrameSize = 64 << 10
+
+// writeStream encrypts and encodes r in binary format to w, sealing the
+// contents of the bundle in frames that are written as they are complete.
+// The caller must hold r.mu.
+func (r *Ring) writeStream(w io.Writer) (int64, error) {
+	var root packet.Buffer
+	r.encodeHeader(&root)
+	nw, err := root.WriteTo(w)
+	if err != nil {
+		return nw, err
+	}
+
+	var fb packet.Buffer
+	fw, err := r.suite().NewFrameWriter(r.dkPlaintext, streamFrameSize, func(frame []byte) error {
+		fb.Reset()
+		fb.AddPacket(packet.StreamFrameType, frame)
+		n, err := fb.WriteTo(w)
+		nw += n
+		return err
+	})
+	if err != nil {
+		return nw, fmt.Errorf("encrypt ring: %w", err)
+	}
+	bw := io.WriteCloser(fw)
+	if r.compressed() {
+		bw = packet.Deflate(fw)
+	}
+	if err := r.writeBundle(bw); err != nil {
+		return nw, err
+	}
+	if err := bw.Close(); err != nil {
+		return nw, err
+	}
+	err = fw.Close()
+	return nw, err
+}
+
+// encodeHeader writes the format header and the unencrypted packets of r
+// to root. The caller must hold r.mu.
+func (r *Ring) encodeHeader(root *packet.Buffer) {
+	root.WriteHeader(CurrentFormat, r.reserved)
 	root.AddPacket(packet.DataKeyType, r.dkEncrypted)
 	if len(r.accessKeySalt) != 0 {
 		root.AddPacket(packet.AccessKeySaltType, r.accessKeySalt)
 	}
+	for _, s := range r.moreSlots {
+		root.AddPacket(packet.DataKeyType, s.encDK)
+		if len(s.salt) != 0 {
+			root.AddPacket(packet.AccessKeySaltType, s.salt)
+		}
+	}
+	for _, s := range r.wrapped {
+		root.AddWrappedKey(s.label, s.wrapped)
+	}
+	if p := r.argon2Params; p != nil {
+		root.AddArgon2Params(p.Time, p.Memory, p.Threads)
+	}
+	if p := r.scryptParams; p != nil {
+		root.AddScryptParams(uint32(p.N), uint32(p.R), uint32(p.P))
+	}
+	if p := r.threshold; p != nil {
+		root.AddThreshold(uint8(p.K), uint8(p.N))
+	}
+	root.AddGeneration(r.generation + 1)
+	for _, p := range r.unknown {
+		root.AddPacket(p.Type, p.Data)
+	}
+	macKey := cipher.MACKey(r.dkPlaintext)
+	defer clear(macKey)
+	root.AddPacket(packet.HeaderMACType, cipher.MAC(macKey, root.Bytes()))
+}
 
-	// The keys and active key ID go into an encrypted bundle.
-	var kb packet.Buffer
-	kb.AddActiveKey(r.view.activeKey)
+// writeBundle writes the plaintext contents of the bundle for r to w, one
+// packet at a time. The caller must hold r.mu.
+func (r *Ring) writeBundle(w io.Writer) error {
+	var pb packet.Buffer
+	put := func() error {
+		_, err := w.Write(pb.Bytes())
+		clear(pb.Bytes())
+		pb.Reset()
+		return err
+	}
+
+	// Record that the header has a MAC, so that its removal can be detected.
+	pb.AddPacket(packet.HeaderMACType, nil)
+	if err := put(); err != nil {
+		return err
+	}
+
+	// The keys and active key ID go into an encrypted bundle.  If there is
+	// only one key and it is active, the marker is omitted.
+	if len(r.view.keys) != 1 || r.view.activeKey == 0 {
+		pb.AddActiveKey(r.view.activeKey)
+		if err := put(); err != nil {
+			return err
+		}
+	}
 
-	// Add keys in ID order for stability.
+	// Add keys in ID order for stability. If keys have been removed, record
+	// the maximum ID so that it will not be reused.
 	ids := slice.MapKeys(r.view.keys)
 	slices.Sort(ids)
+	if len(ids) != 0 && r.maxID > ids[len(ids)-1] {
+		pb.AddMaxID(r.maxID)
+		if err := put(); err != nil {
+			return err
+		}
+	}
 	for _, id := range ids {
-		kb.AddKeyringEntry(r.view.keys[id])
+		ki := r.view.keys[id]
+		if r.view.sealed {
+			ki.Key = r.view.appendKey(nil, ki)
+		}
+		pb.AddKeyringEntry(ki)
+		if r.view.sealed {
+			clear(ki.Key)
+		}
+		if err := put(); err != nil {
+			return err
+		}
 	}
-	defer clear(kb.Bytes())
+	return nil
+}
 
-	_, data, err := cipher.EncryptWithKey(r.dkPlaintext, kb.Bytes(), nil)
-	if err != nil {
-		return 0, fmt.Errorf("encrypt ring: %w", err)
+// Cipher identifies the authenticated encryption algorithm used to encrypt a
+// keyring in storage.
+type Cipher byte
+
+const (
+	ChaCha20Poly1305 Cipher = 0 // XChaCha20-Poly1305 (the default)
+	AES256GCM        Cipher = 1 // AES-256 in Galois/Counter Mode
+)
+
+func (c Cipher) String() string {
+	switch c {
+	case ChaCha20Poly1305:
+		return "ChaCha20Poly1305"
+	case AES256GCM:
+		return "AES256GCM"
+	default:
+		return fmt.Sprintf("Cipher(%d)", byte(c))
 	}
+}
 
-	root.AddPacket(packet.BundleType, data)
-	defer clear(root.Bytes())
-	return root.WriteTo(w)
+// suite returns the cipher suite for c, or an error if c is not known.
+// The values of Cipher are the cipher suite codes of the storage format.
+func (c Cipher) suite() (cipher.Suite, error) {
+	if s := cipher.Suite(c); s.IsValid() {
+		return s, nil
+	}
+	return 0, fmt.Errorf("keyring: unknown cipher %v", c)
+}
+
+// Cipher reports the cipher used to encrypt r in storage.
+func (r *Ring) Cipher() Cipher {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	return Cipher(r.suite())
 }
 
 // Config carries the settings for a [Ring].
@@ -430,5 +2176,73 @@ type Config struct {
 	// An optional key-generation salt for the access key. If provided, this
 	// value will be passed to the accessKey callback of [Read] when reading the
 	// keyring from storage. This may be empty or nil.
+	//
+	// If the salt is empty, no salt is stored with the keyring, and the
+	// accessKey callback of [Read] receives a nil salt. This is appropriate
+	// when the access key does not depend on a salt, as with [StaticKey], or
+	// when the caller manages the salt separately.
 	AccessKeySalt []byte
+
+	// If true, the keys stored in the ring are kept encrypted in memory under
+	// a random key generated for the process, and are decrypted only as needed
+	// to return them to the caller or write the ring to storage. This narrows
+	// the window during which plaintext keys are present in memory, at some
+	// cost in CPU time for each access. See also [Ring.EncryptInMemory].
+	EncryptInMemory bool
+
+	// If non-nil, the Argon2id parameters used to derive AccessKey from a
+	// passphrase and AccessKeySalt, as by [Argon2idKey]. The parameters are
+	// stored in plaintext with the keyring, and are reported by [Inspect], so
+	// that a reader can derive the same access key. New reports an error if
+	// the parameters are invalid.
+	Argon2Params *Argon2Params
+
+	// The cipher used to encrypt the keyring in storage. The default is
+	// [ChaCha20Poly1305]. The choice is recorded in the stored keyring, and
+	// [Read] uses the same cipher to decrypt it.
+	Cipher Cipher
+
+	// If true, [Ring.WriteTo] encrypts the keys in fixed-size frames and
+	// writes each frame as it is complete, rather than building the whole
+	// encrypted bundle in memory first. This reduces memory use when writing
+	// rings with many large keys. The choice is recorded in the stored
+	// keyring, so a ring read from such a keyring is also written this way.
+	Streaming bool
+
+	// If true, the keys are compressed with DEFLATE before they are encrypted
+	// for storage. This makes the stored keyring smaller when its keys are
+	// compressible (for example, structured tokens rather than random keys).
+	// The choice is recorded in the stored keyring, and [Read] decompresses it
+	// automatically. Note that the buffers used by the compressor are not
+	// zeroed after use.
+	Compress bool
+
+	// If positive, the maximum number of keys the ring may hold. Methods that
+	// add keys, such as [Ring.Add], panic or report [ErrTooManyKeys] when the
+	// ring is full. If zero, the number of keys is not limited. The limit is
+	// not stored with the keyring; use [ReadOptions] to apply it when reading.
+	MaxKeys int
+
+	// If true, the ID of each key is derived from a hash of its contents,
+	// rather than assigned in sequence, so that the same key has the same ID
+	// in any ring. See [Ring.Add] for how duplicates and collisions are
+	// handled. The choice is recorded in the stored keyring, so a ring read
+	// from such a keyring assigns IDs the same way. [Ring.Active] still
+	// reports whichever ID is marked active, and methods that look up keys by
+	// ID work as usual. Such a ring does not support [Ring.Compact] or
+	// [Ring.Replace], since they would break the relation between keys and IDs.
+	DeterministicIDs bool
+
+	// If non-empty, a caller-chosen context (such as a file name or a tenant
+	// ID) to which the stored keyring is bound. It is used as associated data
+	// when encrypting the data storage key, so the keyring can be read only
+	// by a reader that supplies the same context in [ReadOptions]; otherwise
+	// reading reports [ErrBadAccessKey]. The context itself is not stored
+	// with the keyring.
+	Context []byte
+
+	// If non-nil, the scrypt parameters used to derive AccessKey from a
+	// passphrase and AccessKeySalt, as by [ScryptKey]. They are stored like
+	// Argon2Params, and at most one of the two may be set.
+	ScryptParams *ScryptParams
 }
@@ -4,13 +4,27 @@ package keyring_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/aes"
+	stdcipher "crypto/cipher"
 	crand "crypto/rand"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"iter"
 	mrand "math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/creachadair/keyring"
 	"github.com/creachadair/mds/mtest"
@@ -91,6 +105,14 @@ func TestBasic(t *testing.T) {
 
 	// Check the list of available IDs.
 	checkHasKeys(t, r, 1, 2)
+
+	const wantBytes = len(firstKey) + len(secondKey)
+	if n := r.TotalKeyBytes(); n != wantBytes {
+		t.Errorf("TotalKeyBytes: got %d, want %d", n, wantBytes)
+	}
+	if n := r.View().TotalKeyBytes(); n != wantBytes {
+		t.Errorf("View TotalKeyBytes: got %d, want %d", n, wantBytes)
+	}
 }
 
 func TestRoundTrip(t *testing.T) {
@@ -132,12 +154,12 @@ func TestRoundTrip(t *testing.T) {
 	t.Logf("Encoded keyring as %d bytes", nw)
 
 	// Load the binary encoding back and check its contents.
-	r2, err := keyring.Read(&buf, func(salt []byte) ([]byte, error) {
+	r2, err := keyring.Read(&buf, keyring.AccessKeyFunc(func(salt []byte) ([]byte, error) {
 		if got := string(salt); got != testSalt {
 			return nil, fmt.Errorf("salt is %q, want %q", got, testSalt)
 		}
 		return accessKey, nil
-	})
+	}))
 	if err != nil {
 		t.Fatalf("Read failed: %v", err)
 	}
@@ -160,6 +182,9 @@ func TestRoundTrip(t *testing.T) {
 	if got, want := r2.Active(), r.Active(); got != want {
 		t.Errorf("Decoded active: got %v, want %v", got, want)
 	}
+	if err := r2.Check(); err != nil {
+		t.Errorf("Check failed: %v", err)
+	}
 }
 
 func TestErrors(t *testing.T) {
@@ -179,7 +204,30 @@ func TestErrors(t *testing.T) {
 
 	t.Run("NoInitialKey", func(t *testing.T) {
 		_, err := keyring.New(keyring.Config{AccessKey: accessKey})
-		checkError(t, "New", err, "initial key is empty")
+		if !errors.Is(err, keyring.ErrEmptyKey) {
+			t.Errorf("New: got %v, want %v", err, keyring.ErrEmptyKey)
+		}
+	})
+
+	t.Run("ReplaceMissing", func(t *testing.T) {
+		if err := r.Replace(12345, []byte("x")); !errors.Is(err, keyring.ErrUnknownKey) {
+			t.Errorf("Replace: got %v, want %v", err, keyring.ErrUnknownKey)
+		}
+		if err := r.Replace(r.Active(), nil); !errors.Is(err, keyring.ErrEmptyKey) {
+			t.Errorf("Replace: got %v, want %v", err, keyring.ErrEmptyKey)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		data, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		data[len(data)-1] ^= 1 // break the bundle
+		_, err = keyring.UnmarshalRing(data, keyring.StaticKey(accessKey))
+		if !errors.Is(err, keyring.ErrCorruptKeyring) {
+			t.Errorf("UnmarshalRing: got %v, want %v", err, keyring.ErrCorruptKeyring)
+		}
 	})
 
 	t.Run("NoAccessKey", func(t *testing.T) {
@@ -197,6 +245,26 @@ func TestErrors(t *testing.T) {
 		mtest.MustPanic(t, func() { r.Get(12345, nil) })
 	})
 
+	t.Run("TryMissing", func(t *testing.T) {
+		for _, id := range []keyring.ID{0, 12345} {
+			if got, err := r.TryGet(id, nil); !errors.Is(err, keyring.ErrUnknownKey) {
+				t.Errorf("TryGet(%v): got %q, %v; want %v", id, got, err, keyring.ErrUnknownKey)
+			}
+			if got, err := r.View().TryGet(id, nil); !errors.Is(err, keyring.ErrUnknownKey) {
+				t.Errorf("View.TryGet(%v): got %q, %v; want %v", id, got, err, keyring.ErrUnknownKey)
+			}
+			if err := r.TryActivate(id); !errors.Is(err, keyring.ErrUnknownKey) {
+				t.Errorf("TryActivate(%v): got %v, want %v", id, err, keyring.ErrUnknownKey)
+			}
+		}
+		if got, err := r.TryGet(r.Active(), nil); err != nil || string(got) != "ok I am awake" {
+			t.Errorf("TryGet(%v): got %q, %v; want ok I am awake, nil", r.Active(), got, err)
+		}
+		if err := r.TryActivate(r.Active()); err != nil {
+			t.Errorf("TryActivate(%v): unexpected error: %v", r.Active(), err)
+		}
+	})
+
 	t.Run("AddEmpty", func(t *testing.T) {
 		mtest.MustPanic(t, func() { r.Add(nil) })
 		mtest.MustPanic(t, func() { r.Add([]byte{}) })
@@ -211,6 +279,114 @@ func TestErrors(t *testing.T) {
 		mtest.MustPanic(t, func() { keyring.RandomKey(0) })
 		mtest.MustPanic(t, func() { keyring.RandomKey(-1) })
 	})
+
+	t.Run("YubiKeySlot", func(t *testing.T) {
+		for _, slot := range []int{-1, 0, 3} {
+			_, err := keyring.YubiKeyHMACKey(slot)
+			checkError(t, "YubiKeyHMACKey", err, "invalid YubiKey slot")
+		}
+	})
+
+	t.Run("KeychainName", func(t *testing.T) {
+		for _, names := range [][2]string{{"", "account"}, {"service", ""}} {
+			_, err := keyring.KeychainKey(names[0], names[1])
+			checkError(t, "KeychainKey", err, "must be non-empty")
+		}
+	})
+
+	t.Run("BadSalt", func(t *testing.T) {
+		mtest.MustPanic(t, func() { keyring.GenerateSalt(0) })
+		mtest.MustPanic(t, func() { keyring.GenerateSalt(-1) })
+	})
+	t.Run("Header", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		tests := []struct {
+			name     string
+			pos, val byte
+			want     error
+			msg      string
+		}{
+			{"Version", 1, 3, keyring.ErrUnsupportedVersion, "version 3"},
+			{"UnknownSuite", 2, 7, keyring.ErrUnknownSuite, "cipher suite 7"},
+			{"UnknownFlag", 3, 0x80, keyring.ErrUnknownFlag, "flags 0x80"},
+		}
+		for _, tc := range tests {
+			data := bytes.Clone(buf.Bytes())
+			data[tc.pos] = tc.val
+			_, err := keyring.Read(bytes.NewReader(data), keyring.StaticKey(accessKey))
+			if !errors.Is(err, tc.want) {
+				t.Errorf("Read %s: got %v, want %v", tc.name, err, tc.want)
+			}
+			checkError(t, "Read "+tc.name, err, tc.msg)
+		}
+		if _, err := keyring.Read(bytes.NewReader(buf.Bytes()), keyring.StaticKey(accessKey)); err != nil {
+			t.Errorf("Read valid: unexpected error: %v", err)
+		}
+	})
+}
+
+func TestRandomKeyString(t *testing.T) {
+	for _, alphabet := range []string{
+		keyring.AlphabetBase62, keyring.AlphabetHex, keyring.AlphabetURLSafe, "x", "ab",
+	} {
+		key := keyring.RandomKeyString(64, alphabet)
+		if len(key) != 64 {
+			t.Errorf("RandomKeyString(64, %q): got %d bytes, want 64", alphabet, len(key))
+		}
+		for _, b := range key {
+			if strings.IndexByte(alphabet, b) < 0 {
+				t.Errorf("RandomKeyString(64, %q): byte %q not in alphabet", alphabet, b)
+			}
+		}
+	}
+
+	// With a large sample, every character of the alphabet should appear.
+	seen := make(map[byte]bool)
+	for _, b := range keyring.RandomKeyString(10000, keyring.AlphabetBase62) {
+		seen[b] = true
+	}
+	if len(seen) != len(keyring.AlphabetBase62) {
+		t.Errorf("RandomKeyString: saw %d distinct characters, want %d", len(seen), len(keyring.AlphabetBase62))
+	}
+
+	mtest.MustPanic(t, func() { keyring.RandomKeyString(0, keyring.AlphabetHex) })
+	mtest.MustPanic(t, func() { keyring.RandomKeyString(8, "") })
+	mtest.MustPanic(t, func() { keyring.RandomKeyString(8, strings.Repeat("x", 257)) })
+}
+
+func TestGenerateSalt(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	salt := keyring.GenerateSalt(16)
+	if len(salt) != 16 {
+		t.Fatalf("GenerateSalt(16): got %d bytes, want 16", len(salt))
+	}
+	if other := keyring.GenerateSalt(16); bytes.Equal(salt, other) {
+		t.Errorf("GenerateSalt: got duplicate salt %x", salt)
+	}
+
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("fee fie foe fum"),
+		AccessKey:     accessKey,
+		AccessKeySalt: salt,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if _, err := keyring.Read(&buf, keyring.AccessKeyFunc(func(got []byte) ([]byte, error) {
+		if !bytes.Equal(got, salt) {
+			return nil, fmt.Errorf("salt: got %x, want %x", got, salt)
+		}
+		return accessKey, nil
+	})); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
 }
 
 func TestRekey(t *testing.T) {
@@ -253,8 +429,8 @@ func TestRekey(t *testing.T) {
 
 	// Reading buf1 with k2 should fail.
 	k1.Seek(0, io.SeekStart)
-	if r2, err := keyring.Read(k1, keyring.StaticKey(accessKey2)); err == nil {
-		t.Errorf("Read k1: got %v, want error", r2)
+	if r2, err := keyring.Read(k1, keyring.StaticKey(accessKey2)); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("Read k1: got %v, %v; want %v", r2, err, keyring.ErrBadAccessKey)
 	}
 
 	// Reading buf2 with k1 should fail.
@@ -264,19 +440,49 @@ func TestRekey(t *testing.T) {
 
 	// Reading buf2 with k2 should work.
 	k2.Seek(0, io.SeekStart)
-	if r2, err := keyring.Read(k2, func(salt []byte) ([]byte, error) {
+	if r2, err := keyring.Read(k2, keyring.AccessKeyFunc(func(salt []byte) ([]byte, error) {
 		// Check that we kept the salt set during rekeying.
 		if got := string(salt); got != "acorn" {
 			return nil, fmt.Errorf("wrong salt: got %q, want acorn", got)
 		}
 		return accessKey2, nil
-	}); err != nil {
+	})); err != nil {
 		t.Fatalf("Read k2 failed: %v", err)
 	} else if got := string(r2.Get(r2.Active(), nil)); got != testKey {
 		t.Errorf("k2 active: got %q, want %q", got, testKey)
 	}
 }
 
+func TestRekeyVerified(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		AccessKey:  accessKey,
+		InitialKey: []byte("prove it"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	newKey := randomBytes(keyring.AccessKeyLen)
+
+	// The wrong old key is rejected, and the ring is not changed.
+	if err := r.RekeyVerified(newKey, newKey, nil); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("RekeyVerified: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+	if !r.AccessKeyFuncWorks(keyring.StaticKey(accessKey)) {
+		t.Error("Access key changed after failed RekeyVerified")
+	}
+
+	if err := r.RekeyVerified(accessKey, newKey, []byte("salt")); err != nil {
+		t.Fatalf("RekeyVerified failed: %v", err)
+	}
+	if !r.AccessKeyFuncWorks(keyring.StaticKey(newKey)) {
+		t.Error("New access key does not work after RekeyVerified")
+	}
+	if r.AccessKeyFuncWorks(keyring.StaticKey(accessKey)) {
+		t.Error("Old access key still works after RekeyVerified")
+	}
+}
+
 func TestPassphraseKeys(t *testing.T) {
 	const passphrase = "character is what you are in the dark"
 
@@ -309,6 +515,316 @@ func TestPassphraseKeys(t *testing.T) {
 	}
 }
 
+func TestEnvKeys(t *testing.T) {
+	const keyVar, passVar = "KEYRING_TEST_ACCESS_KEY", "KEYRING_TEST_PASSPHRASE"
+	salt := keyring.GenerateSalt(16)
+
+	t.Run("Key", func(t *testing.T) {
+		accessKey := randomBytes(keyring.AccessKeyLen)
+		t.Setenv(keyVar, base64.StdEncoding.EncodeToString(accessKey))
+		got, err := keyring.EnvKey(keyVar)(salt)
+		if err != nil {
+			t.Fatalf("EnvKey failed: %v", err)
+		} else if !bytes.Equal(got, accessKey) {
+			t.Errorf("EnvKey: got %x, want %x", got, accessKey)
+		}
+
+		for _, bad := range []struct {
+			val, msg string
+		}{
+			{"", "is empty"},
+			{"not base64!", "invalid base64"},
+			{base64.StdEncoding.EncodeToString([]byte("short")), "key is 5 bytes"},
+		} {
+			t.Setenv(keyVar, bad.val)
+			_, err := keyring.EnvKey(keyVar)(salt)
+			checkError(t, "EnvKey", err, bad.msg)
+		}
+	})
+
+	t.Run("Passphrase", func(t *testing.T) {
+		const passphrase = "a horse is a horse, of course"
+		t.Setenv(passVar, passphrase)
+		got, err := keyring.EnvPassphraseKey(passVar)(salt)
+		if err != nil {
+			t.Fatalf("EnvPassphraseKey failed: %v", err)
+		}
+		want, _ := keyring.PassphraseKey(passphrase)(salt)
+		if !bytes.Equal(got, want) {
+			t.Errorf("EnvPassphraseKey: got %x, want %x", got, want)
+		}
+		t.Setenv(passVar, "")
+		_, err = keyring.EnvPassphraseKey(passVar)(salt)
+		checkError(t, "EnvPassphraseKey", err, "is empty")
+	})
+
+	t.Run("Unset", func(t *testing.T) {
+		const unset = "KEYRING_TEST_NO_SUCH_VARIABLE"
+		_, err := keyring.EnvKey(unset)(salt)
+		checkError(t, "EnvKey", err, "is not set")
+		_, err = keyring.EnvPassphraseKey(unset)(salt)
+		checkError(t, "EnvPassphraseKey", err, "is not set")
+	})
+}
+
+func TestFileKey(t *testing.T) {
+	const passphrase = "swordfish"
+	key, salt := keyring.AccessKeyFromPassphrase(passphrase)
+	r, err := keyring.New(keyring.Config{InitialKey: []byte("apple"), AccessKey: key, AccessKeySalt: salt})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, contents := range []string{passphrase, passphrase + "\n", passphrase + "\r\n"} {
+		path := filepath.Join(dir, "passphrase")
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatalf("Write passphrase file: %v", err)
+		}
+		r2, err := keyring.Read(bytes.NewReader(data), keyring.FileKey(path))
+		if err != nil {
+			t.Fatalf("Read with file %q failed: %v", contents, err)
+		}
+		checkHasKeys(t, r2, 1)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatalf("Write empty file: %v", err)
+	}
+	_, err = keyring.Read(bytes.NewReader(data), keyring.FileKey(empty))
+	checkError(t, "Read with empty file", err, "is empty")
+
+	_, err = keyring.Read(bytes.NewReader(data), keyring.FileKey(filepath.Join(dir, "missing")))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Read with missing file: got %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestAccessKeyError(t *testing.T) {
+	r, err := keyring.New(keyring.Config{InitialKey: []byte("apple"), AccessKey: randomBytes(keyring.AccessKeyLen)})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	// An error from the access key function is reported to the caller, and
+	// is not mistaken for a wrong key.
+	errHSM := errors.New("cannot reach the HSM")
+	keyFunc := keyring.AccessKeyFunc(func([]byte) ([]byte, error) { return nil, errHSM })
+	if _, err := keyring.Read(bytes.NewReader(data), keyFunc); !errors.Is(err, errHSM) {
+		t.Errorf("Read: got %v, want %v", err, errHSM)
+	} else if errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("Read: got %v, which should not be %v", err, keyring.ErrBadAccessKey)
+	}
+	if err := keyring.Validate(bytes.NewReader(data), keyFunc); !errors.Is(err, errHSM) {
+		t.Errorf("Validate: got %v, want %v", err, errHSM)
+	}
+}
+
+func TestFirstOf(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{InitialKey: []byte("apple"), AccessKey: accessKey})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	const unset = "KEYRING_TEST_NO_SUCH_VARIABLE"
+	failing := keyring.AccessKeyFunc(func([]byte) ([]byte, error) { return nil, errors.New("no key here") })
+
+	// Sources that fail or give the wrong length are skipped.
+	keyFunc := keyring.FirstOf(
+		keyring.EnvKey(unset),
+		failing,
+		keyring.StaticKey([]byte("too short")),
+		keyring.StaticKey(bytes.Clone(accessKey)),
+		failing,
+	)
+	if _, err := keyring.Read(bytes.NewReader(data), keyFunc); err != nil {
+		t.Errorf("Read failed: %v", err)
+	}
+
+	// If no source succeeds, all their errors are reported.
+	_, err = keyring.Read(bytes.NewReader(data), keyring.FirstOf(keyring.EnvKey(unset), failing))
+	checkError(t, "Read", err, "is not set")
+	checkError(t, "Read", err, "no key here")
+
+	_, err = keyring.Read(bytes.NewReader(data), keyring.FirstOf())
+	checkError(t, "Read", err, "no access key sources")
+
+	// A source whose key does not unlock the ring is skipped.
+	wrongKey := randomBytes(keyring.AccessKeyLen)
+	both := keyring.FirstOf(keyring.StaticKey(wrongKey), keyring.StaticKey(bytes.Clone(accessKey)))
+	if _, err := keyring.Read(bytes.NewReader(data), both); err != nil {
+		t.Errorf("Read with a wrong key first failed: %v", err)
+	}
+	if err := keyring.VerifyAccessKey(bytes.NewReader(data), both); err != nil {
+		t.Errorf("VerifyAccessKey with a wrong key first failed: %v", err)
+	}
+
+	// Nested combinations are tried in order.
+	nested := keyring.FirstOf(keyring.FirstOf(failing, keyring.StaticKey(wrongKey)), keyring.StaticKey(bytes.Clone(accessKey)))
+	if _, err := keyring.Read(bytes.NewReader(data), nested); err != nil {
+		t.Errorf("Read with nested sources failed: %v", err)
+	}
+
+	// If no source has the right key, reading reports ErrBadAccessKey.
+	_, err = keyring.Read(bytes.NewReader(data), keyring.FirstOf(failing, keyring.StaticKey(wrongKey)))
+	if !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("Read with wrong keys: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+	checkError(t, "Read", err, "no key here")
+
+	// Reading with a combination does not make one of its keys work for a
+	// different keyring.
+	other, err := keyring.New(keyring.Config{InitialKey: []byte("pear"), AccessKey: randomBytes(keyring.AccessKeyLen)})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	otherData, err := other.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if _, err := keyring.Read(bytes.NewReader(otherData), keyring.StaticKey(wrongKey)); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("Read other with a wrong key: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+
+	// Calling the combination directly returns the first key of the right
+	// length.
+	if key, err := both.AccessKey(nil); err != nil || !bytes.Equal(key, wrongKey) {
+		t.Errorf("AccessKey: got %x, %v; want %x, nil", key, err, wrongKey)
+	}
+}
+
+func TestChangePassphrase(t *testing.T) {
+	const oldPass, newPass = "old and busted", "new hotness"
+
+	check := func(t *testing.T, r *keyring.Ring) {
+		t.Helper()
+		if err := r.ChangePassphrase("wrong", newPass); !errors.Is(err, keyring.ErrWrongPassphrase) {
+			t.Errorf("ChangePassphrase(wrong): got %v, want %v", err, keyring.ErrWrongPassphrase)
+		}
+		if err := r.ChangePassphrase(oldPass, newPass); err != nil {
+			t.Fatalf("ChangePassphrase failed: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		if _, err := keyring.ReadWithPassphrase(bytes.NewReader(buf.Bytes()), oldPass); !errors.Is(err, keyring.ErrBadAccessKey) {
+			t.Errorf("Read with old passphrase: got %v, want %v", err, keyring.ErrBadAccessKey)
+		}
+		r2, err := keyring.ReadWithPassphrase(bytes.NewReader(buf.Bytes()), newPass)
+		if err != nil {
+			t.Fatalf("Read with new passphrase failed: %v", err)
+		}
+		if got := string(r2.Get(r2.Active(), nil)); got != "hunter2" {
+			t.Errorf("Active key: got %q, want hunter2", got)
+		}
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		key, salt := keyring.AccessKeyFromPassphrase(oldPass)
+		r, err := keyring.New(keyring.Config{
+			AccessKey:     key,
+			AccessKeySalt: salt,
+			InitialKey:    []byte("hunter2"),
+		})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		check(t, r)
+	})
+
+	t.Run("Scrypt", func(t *testing.T) {
+		r, err := keyring.New(keyring.Config{
+			AccessKey:  randomBytes(keyring.AccessKeyLen),
+			InitialKey: []byte("hunter2"),
+		})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if err := r.RekeyScrypt(oldPass, 1024, 8, 1); err != nil {
+			t.Fatalf("RekeyScrypt failed: %v", err)
+		}
+		check(t, r) // the parameters are preserved, or ReadWithPassphrase fails
+	})
+
+	t.Run("SecondAccessKey", func(t *testing.T) {
+		const otherPass = "the other one"
+		key, salt := keyring.AccessKeyFromPassphrase(otherPass)
+		r, err := keyring.New(keyring.Config{
+			AccessKey:     key,
+			AccessKeySalt: salt,
+			InitialKey:    []byte("hunter2"),
+		})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if err := r.AddAccessKey(keyring.PassphraseKey(oldPass)); err != nil {
+			t.Fatalf("AddAccessKey failed: %v", err)
+		}
+		check(t, r)
+
+		// The access key that did not match is unchanged.
+		data, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		if _, err := keyring.ReadWithPassphrase(bytes.NewReader(data), otherPass); err != nil {
+			t.Errorf("Read with other passphrase failed: %v", err)
+		}
+		if n := r.NumAccessKeys(); n != 2 {
+			t.Errorf("NumAccessKeys: got %d, want 2", n)
+		}
+	})
+}
+
+func TestVerifyAccessKey(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		AccessKey:     accessKey,
+		AccessKeySalt: []byte("salt"),
+		InitialKey:    []byte("cheap check"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	// Verification does not read the bundle, so a truncated bundle is OK.
+	trunc := data[:len(data)-8]
+	if err := keyring.VerifyAccessKey(bytes.NewReader(trunc), keyring.StaticKey(accessKey)); err != nil {
+		t.Errorf("VerifyAccessKey: unexpected error: %v", err)
+	}
+	if err := keyring.VerifyAccessKey(bytes.NewReader(data), keyring.AccessKeyFunc(func(salt []byte) ([]byte, error) {
+		if string(salt) != "salt" {
+			t.Errorf("Salt: got %q, want salt", salt)
+		}
+		return randomBytes(keyring.AccessKeyLen), nil
+	})); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("VerifyAccessKey(wrong): got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+	if err := keyring.VerifyAccessKey(strings.NewReader("nonsense"), keyring.StaticKey(accessKey)); err == nil {
+		t.Error("VerifyAccessKey(nonsense): got nil, want error")
+	}
+}
+
 func TestNoSharing(t *testing.T) {
 	var zero [keyring.AccessKeyLen]byte
 	const testKey = "apple pear plum cherry"
@@ -338,6 +854,50 @@ func TestNoSharing(t *testing.T) {
 	if string(testKeyBytes) != testKey {
 		t.Errorf("Get: got %q, want %q", testKeyBytes, testKey)
 	}
+
+	// Editing the results from Keys does not affect the stored copy.
+	for _, key := range r.Keys() {
+		clear(key)
+	}
+	if got := r.Get(r.Active(), nil); string(got) != testKey {
+		t.Errorf("Stored key modified: got %q, want %q", got, testKey)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("one"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("two"))
+	r.Add([]byte("three"))
+	r.Remove(2)
+
+	type entry struct {
+		ID  keyring.ID
+		Key string
+	}
+	want := []entry{{1, "one"}, {3, "three"}}
+	for _, keys := range []iter.Seq2[keyring.ID, []byte]{r.Keys(), r.View().Keys()} {
+		var got []entry
+		for id, key := range keys {
+			got = append(got, entry{id, string(key)})
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("Keys (-got, +want):\n%s", diff)
+		}
+	}
+
+	// Stopping early is supported.
+	for id := range r.Keys() {
+		if id != 1 {
+			t.Errorf("Keys: got first ID %v, want 1", id)
+		}
+		break
+	}
 }
 
 func TestView(t *testing.T) {
@@ -369,6 +929,26 @@ func TestView(t *testing.T) {
 		t.Errorf("View append: got %v, %q, want %v, %q", id, got, 1, testKey)
 	}
 
+	t.Run("ActiveView", func(t *testing.T) {
+		av := r.ActiveView()
+		if n := av.Len(); n != 1 {
+			t.Errorf("Len is %d, want 1", n)
+		}
+		if av.Has(1) {
+			t.Error("Active view has inactive key 1")
+		}
+		if id, got := av.GetActive(nil); id != 2 || string(got) != "booga booga booga" {
+			t.Errorf("Active view: got %v, %q, want 2, %q", id, got, "booga booga booga")
+		}
+
+		// Changes to r do not affect the view.
+		r.Activate(1)
+		if id := av.Active(); id != 2 {
+			t.Errorf("Active view: got active %v, want 2", id)
+		}
+		r.Activate(2)
+	})
+
 	t.Run("SingleKey", func(t *testing.T) {
 		v := keyring.SingleKeyView([]byte(testKey))
 		if n := v.Len(); n != 1 {
@@ -386,3 +966,2587 @@ func TestView(t *testing.T) {
 		})
 	})
 }
+
+func TestPool(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	const testKey = "wibble wobble"
+
+	r := keyring.AcquireRing()
+	if n := r.Len(); n != 0 {
+		t.Errorf("Len: got %d, want 0", n)
+	}
+	r.Activate(r.Add([]byte(testKey)))
+	if err := r.Rekey(accessKey, nil); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	v := r.View()
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	r.ReleaseToPool()
+
+	// The view is not affected by releasing the ring.
+	if id, got := v.GetActive(nil); id != 1 || string(got) != testKey {
+		t.Errorf("View active: got %v, %q, want 1, %q", id, got, testKey)
+	}
+
+	r2, err := keyring.Read(&buf, keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if id, got := r2.GetActive(nil); id != 1 || string(got) != testKey {
+		t.Errorf("Active key: got %v, %q, want 1, %q", id, got, testKey)
+	}
+
+	// A ring acquired after a release is empty.
+	r3 := keyring.AcquireRing()
+	defer r3.ReleaseToPool()
+	if n := r3.Len(); n != 0 {
+		t.Errorf("Len: got %d, want 0", n)
+	}
+	if id := r3.Add([]byte("x")); id != 1 {
+		t.Errorf("Add: got id %v, want 1", id)
+	}
+}
+
+func TestGetActiveInfo(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	start := time.Now().Truncate(time.Second)
+
+	r, err := keyring.New(keyring.Config{InitialKey: []byte("alpha"), AccessKey: accessKey})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Activate(r.Add([]byte("bravo")))
+
+	checkInfo := func(id keyring.ID, created time.Time, key []byte) {
+		t.Helper()
+		if id != 2 || string(key) != "bravo" {
+			t.Errorf("GetActiveInfo: got %v, %q, want 2, bravo", id, key)
+		}
+		if created.Before(start) || created.After(time.Now()) {
+			t.Errorf("GetActiveInfo: created %v, want between %v and now", created, start)
+		}
+	}
+
+	id, created, key := r.GetActiveInfo(nil)
+	checkInfo(id, created, key)
+	if got := r.CreatedAt(2); !got.Equal(created) {
+		t.Errorf("CreatedAt(2): got %v, want %v", got, created)
+	}
+	mtest.MustPanic(t, func() { r.CreatedAt(12345) })
+	checkInfo(r.View().GetActiveInfo(nil))
+
+	// Creation times survive a round trip through storage.
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	r2, err := keyring.Read(&buf, keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	id2, created2, key2 := r2.GetActiveInfo(nil)
+	checkInfo(id2, created2, key2)
+	if !created2.Equal(created) {
+		t.Errorf("Reloaded created: got %v, want %v", created2, created)
+	}
+
+	// A single-key view has no creation time.
+	if _, created, _ := keyring.SingleKeyView([]byte("charlie")).GetActiveInfo(nil); !created.IsZero() {
+		t.Errorf("SingleKeyView created: got %v, want zero", created)
+	}
+}
+
+func TestEligibleIDs(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("one"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("two"))
+	r.Activate(r.Add([]byte("three")))
+
+	want := []keyring.ID{1, 2, 3}
+	if diff := cmp.Diff(slices.Collect(r.EligibleIDs()), want); diff != "" {
+		t.Errorf("Ring EligibleIDs (-got, +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(slices.Collect(r.View().EligibleIDs()), want); diff != "" {
+		t.Errorf("View EligibleIDs (-got, +want):\n%s", diff)
+	}
+}
+
+func TestAccessKeyFuncWorks(t *testing.T) {
+	const passphrase = "it was a dark and stormy night"
+	key, salt := keyring.AccessKeyFromPassphrase(passphrase)
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("snoopy"),
+		AccessKey:     key,
+		AccessKeySalt: salt,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		fn   keyring.AccessKeyFunc
+		want bool
+	}{
+		{"Static", keyring.StaticKey(key), true},
+		{"Passphrase", keyring.PassphraseKey(passphrase), true},
+		{"WrongPassphrase", keyring.PassphraseKey("it was a bright cold day in april"), false},
+		{"WrongKey", keyring.StaticKey(randomBytes(keyring.AccessKeyLen)), false},
+		{"ShortKey", keyring.StaticKey(key[:16]), false},
+		{"Error", func([]byte) ([]byte, error) { return key, errors.New("bad") }, false},
+	}
+	for _, tc := range tests {
+		if got := r.AccessKeyFuncWorks(tc.fn); got != tc.want {
+			t.Errorf("AccessKeyFuncWorks(%s): got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestConstantTimeGet(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("medium"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("a much longer key"))
+	r.Add([]byte("x"))
+
+	for id := range r.EligibleIDs() {
+		want := r.Get(id, []byte("pfx:"))
+		got, ok := r.ConstantTimeGet(id, []byte("pfx:"))
+		if !ok || string(got) != string(want) {
+			t.Errorf("ConstantTimeGet(%v): got %q, %v; want %q, true", id, got, ok, want)
+		}
+	}
+	// On 32-bit targets these truncate to 0, 4, and 7, which are also absent.
+	var big int64 = 1 << 32
+	for _, id := range []keyring.ID{0, -1, 4, keyring.ID(big), keyring.ID(big + 4), keyring.ID(big + 7)} {
+		got, ok := r.ConstantTimeGet(id, []byte("pfx:"))
+		if ok || string(got) != "pfx:" {
+			t.Errorf("ConstantTimeGet(%v): got %q, %v; want pfx:, false", id, got, ok)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, sealed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("EncryptInMemory=%v", sealed), func(b *testing.B) {
+			r, err := keyring.New(keyring.Config{
+				InitialKey:      randomBytes(32),
+				AccessKey:       randomBytes(keyring.AccessKeyLen),
+				EncryptInMemory: sealed,
+			})
+			if err != nil {
+				b.Fatalf("New failed: %v", err)
+			}
+			buf := make([]byte, 0, 32)
+			for b.Loop() {
+				r.Get(1, buf[:0])
+			}
+		})
+	}
+}
+
+func TestReadAndUse(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("fleeting"),
+		AccessKey:  accessKey,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	var saved *keyring.View
+	if err := keyring.ReadAndUse(bytes.NewReader(data), keyring.StaticKey(accessKey), func(v *keyring.View) error {
+		if id, key := v.GetActive(nil); id != 1 || string(key) != "fleeting" {
+			t.Errorf("GetActive: got %v, %q; want 1, fleeting", id, key)
+		}
+		saved = v
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadAndUse failed: %v", err)
+	}
+	if saved.Len() != 0 {
+		t.Errorf("After ReadAndUse: view has %d keys, want 0", saved.Len())
+	}
+
+	errUse := errors.New("use failed")
+	if err := keyring.ReadAndUse(bytes.NewReader(data), keyring.StaticKey(accessKey), func(*keyring.View) error {
+		return errUse
+	}); err != errUse {
+		t.Errorf("ReadAndUse: got error %v, want %v", err, errUse)
+	}
+
+	called := false
+	if err := keyring.ReadAndUse(bytes.NewReader(data), keyring.StaticKey(randomBytes(keyring.AccessKeyLen)), func(*keyring.View) error {
+		called = true
+		return nil
+	}); err == nil || called {
+		t.Errorf("ReadAndUse with wrong key: got err=%v, called=%v; want error, false", err, called)
+	}
+}
+
+func TestNotBefore(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("current"),
+		AccessKey:  accessKey,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	staged := r.Add([]byte("staged"))
+	past := r.Add([]byte("past"))
+
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+	r.SetNotBefore(staged, future)
+	r.SetNotBefore(past, time.Now().Add(-time.Hour))
+
+	checkEligible := func(r *keyring.Ring, want ...keyring.ID) {
+		t.Helper()
+		if diff := cmp.Diff(slices.Collect(r.EligibleIDs()), want); diff != "" {
+			t.Errorf("EligibleIDs (-got, +want):\n%s", diff)
+		}
+	}
+	checkEligible(r, 1, past)
+	if got := r.NotBefore(staged); !got.Equal(future) {
+		t.Errorf("NotBefore(%v): got %v, want %v", staged, got, future)
+	}
+	if got := r.NotBefore(1); !got.IsZero() {
+		t.Errorf("NotBefore(1): got %v, want zero", got)
+	}
+	mtest.MustPanic(t, func() { r.SetNotBefore(12345, future) })
+
+	// The not-before time is preserved in storage.
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	r2, err := keyring.Read(&buf, keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got := r2.NotBefore(staged); !got.Equal(future) {
+		t.Errorf("Read NotBefore(%v): got %v, want %v", staged, got, future)
+	}
+	checkEligible(r2, 1, past)
+
+	// Clearing the not-before time makes the key eligible.
+	r2.SetNotBefore(staged, time.Time{})
+	checkEligible(r2, 1, staged, past)
+}
+
+func TestKeyShare(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("first"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	id := r.Add([]byte("for your eyes only"))
+	rkey := randomBytes(keyring.AccessKeyLen)
+
+	share, err := r.View().ExportKeyShare(id, rkey)
+	if err != nil {
+		t.Fatalf("ExportKeyShare failed: %v", err)
+	}
+	if strings.Contains(share, "eyes") {
+		t.Errorf("Share contains plaintext: %q", share)
+	}
+	got, err := keyring.ImportKeyShare(share, rkey)
+	if err != nil {
+		t.Fatalf("ImportKeyShare failed: %v", err)
+	}
+	if string(got) != "for your eyes only" {
+		t.Errorf("ImportKeyShare: got %q, want %q", got, "for your eyes only")
+	}
+
+	t.Run("ExportErrors", func(t *testing.T) {
+		if s, err := r.ExportKeyShare(12345, rkey); err == nil {
+			t.Errorf("Export unknown ID: got %q, want error", s)
+		}
+		if s, err := r.ExportKeyShare(id, rkey[:16]); err == nil {
+			t.Errorf("Export short key: got %q, want error", s)
+		}
+	})
+
+	t.Run("ImportErrors", func(t *testing.T) {
+		tampered := []byte(share)
+		tampered[len(tampered)/2] ^= 1
+		for _, tc := range []struct {
+			name, share string
+			key         []byte
+		}{
+			{"WrongKey", share, randomBytes(keyring.AccessKeyLen)},
+			{"ShortKey", share, rkey[:16]},
+			{"Tampered", string(tampered), rkey},
+			{"Truncated", share[:len(share)-4], rkey},
+			{"NotBase64", "!!!", rkey},
+			{"Empty", "", rkey},
+		} {
+			if got, err := keyring.ImportKeyShare(tc.share, tc.key); err == nil {
+				t.Errorf("Import %s: got %q, want error", tc.name, got)
+			}
+		}
+	})
+}
+
+func TestSealWithActive(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: randomBytes(32),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	const msg = "attack at dawn"
+	aad := []byte("header")
+
+	id1, ctext, err := r.SealWithActive([]byte(msg), aad)
+	if err != nil {
+		t.Fatalf("SealWithActive failed: %v", err)
+	}
+	if id1 != 1 {
+		t.Errorf("SealWithActive: got ID %v, want 1", id1)
+	}
+
+	// After rotation, old ciphertexts can still be opened by ID.
+	r.Activate(r.AddRandom(32))
+	id2, ctext2, err := r.View().SealWithActive([]byte(msg), nil)
+	if err != nil {
+		t.Fatalf("SealWithActive failed: %v", err)
+	} else if id2 != 2 {
+		t.Errorf("SealWithActive: got ID %v, want 2", id2)
+	}
+	for _, tc := range []struct {
+		id    keyring.ID
+		ctext []byte
+		aad   []byte
+	}{{id1, ctext, aad}, {id2, ctext2, nil}} {
+		got, err := r.OpenWithActive(tc.id, tc.ctext, tc.aad)
+		if err != nil {
+			t.Errorf("OpenWithActive(%v) failed: %v", tc.id, err)
+		} else if string(got) != msg {
+			t.Errorf("OpenWithActive(%v): got %q, want %q", tc.id, got, msg)
+		}
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		tampered := bytes.Clone(ctext)
+		tampered[len(tampered)-1] ^= 1
+		for _, tc := range []struct {
+			name  string
+			id    keyring.ID
+			ctext []byte
+			aad   []byte
+		}{
+			{"WrongKey", id2, ctext, aad},
+			{"WrongAAD", id1, ctext, []byte("footer")},
+			{"Tampered", id1, tampered, aad},
+			{"Short", id1, ctext[:8], aad},
+		} {
+			if got, err := r.OpenWithActive(tc.id, tc.ctext, tc.aad); !errors.Is(err, keyring.ErrDecryptFailed) {
+				t.Errorf("OpenWithActive %s: got %q, %v; want %v", tc.name, got, err, keyring.ErrDecryptFailed)
+			}
+		}
+		_, err := r.OpenWithActive(12345, ctext, aad)
+		checkError(t, "OpenWithActive", err, "no such key")
+
+		r.Activate(r.Add([]byte("too short")))
+		_, _, err = r.SealWithActive([]byte(msg), nil)
+		checkError(t, "SealWithActive", err, "is 9 bytes, want 32")
+	})
+}
+
+func TestRemove(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("one"),
+		AccessKey:  accessKey,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("two"))
+	id3 := r.Add([]byte("three"))
+
+	mtest.MustPanic(t, func() { r.Remove(1) }) // active
+	if r.Remove(12345) {
+		t.Error("Remove(12345): got true, want false")
+	}
+	if !r.Remove(2) {
+		t.Error("Remove(2): got false, want true")
+	}
+	if r.Remove(2) {
+		t.Error("Remove(2) again: got true, want false")
+	}
+	checkHasKeys(t, r, 1, id3)
+	if diff := cmp.Diff(slices.Collect(r.IDs()), []keyring.ID{1, id3}); diff != "" {
+		t.Errorf("IDs (-got, +want):\n%s", diff)
+	}
+
+	// Removing the key with the highest ID must not allow it to be reused,
+	// even after a round trip through storage.
+	if !r.Remove(id3) {
+		t.Errorf("Remove(%v): got false, want true", id3)
+	}
+	checkHasKeys(t, r, 1)
+	if err := r.Check(); err != nil {
+		t.Errorf("Check: unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	r2, err := keyring.Read(&buf, keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	checkHasKeys(t, r2, 1)
+	if id := r2.Add([]byte("four")); id != 4 {
+		t.Errorf("Add after Remove: got ID %v, want 4", id)
+	}
+	if got := string(r2.Get(4, nil)); got != "four" {
+		t.Errorf("Get(4): got %q, want four", got)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("one"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("two"))
+	id3 := r.Add([]byte("three"))
+	r.Add([]byte("four"))
+	id5 := r.Add([]byte("five"))
+	r.Activate(id5)
+	r.Remove(1)
+	r.Remove(id3)
+
+	got := r.Compact()
+	if diff := cmp.Diff(got, map[keyring.ID]keyring.ID{2: 1, 4: 2, 5: 3}); diff != "" {
+		t.Errorf("Compact (-got, +want):\n%s", diff)
+	}
+	checkHasKeys(t, r, 1, 2, 3)
+	if got := string(r.Get(r.Active(), nil)); got != "five" {
+		t.Errorf("Active key: got %q, want five", got)
+	}
+	if got := string(r.Get(1, nil)); got != "two" {
+		t.Errorf("Get(1): got %q, want two", got)
+	}
+	if err := r.Check(); err != nil {
+		t.Errorf("Check: unexpected error: %v", err)
+	}
+	if id := r.Add([]byte("six")); id != 4 {
+		t.Errorf("Add after Compact: got ID %v, want 4", id)
+	}
+}
+
+func TestMaxKeys(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	if _, err := keyring.New(keyring.Config{
+		InitialKey: []byte("one"),
+		AccessKey:  accessKey,
+		MaxKeys:    -1,
+	}); err == nil {
+		t.Error("New with negative MaxKeys: got nil, want error")
+	}
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("one"),
+		AccessKey:  accessKey,
+		MaxKeys:    2,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("two"))
+
+	// The ring is full, so adding another key fails.
+	mtest.MustPanic(t, func() { r.Add([]byte("three")) })
+	mtest.MustPanic(t, func() { r.AddLabeled("x", []byte("three")) })
+	mtest.MustPanic(t, func() { r.AddRandom(16) })
+	if _, err := r.AddRandomFrom(crand.Reader, 16); !errors.Is(err, keyring.ErrTooManyKeys) {
+		t.Errorf("AddRandomFrom: got %v, want %v", err, keyring.ErrTooManyKeys)
+	}
+	if n, err := r.Merge(keyring.SingleKeyView([]byte("three"))); !errors.Is(err, keyring.ErrTooManyKeys) || n != 0 {
+		t.Errorf("Merge: got %d, %v; want 0, %v", n, err, keyring.ErrTooManyKeys)
+	}
+
+	// The limit is kept by a clone, and removing a key makes room.
+	c := r.Clone()
+	mtest.MustPanic(t, func() { c.Add([]byte("three")) })
+	c.Remove(2)
+	c.Add([]byte("three"))
+	checkHasKeys(t, c, 1, 3)
+
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if _, err := keyring.ReadWith(bytes.NewReader(data), keyring.StaticKey(accessKey), &keyring.ReadOptions{
+		MaxKeys: 1,
+	}); !errors.Is(err, keyring.ErrTooManyKeys) {
+		t.Errorf("ReadWith(MaxKeys=1): got %v, want %v", err, keyring.ErrTooManyKeys)
+	}
+	r2, err := keyring.ReadWith(bytes.NewReader(data), keyring.StaticKey(accessKey), &keyring.ReadOptions{
+		MaxKeys: 2,
+	})
+	if err != nil {
+		t.Fatalf("ReadWith(MaxKeys=2) failed: %v", err)
+	}
+	mtest.MustPanic(t, func() { r2.Add([]byte("three")) })
+}
+
+func TestDeterministicIDs(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	newRing := func() *keyring.Ring {
+		t.Helper()
+		r, err := keyring.New(keyring.Config{
+			InitialKey:       []byte("alpha"),
+			AccessKey:        accessKey,
+			DeterministicIDs: true,
+		})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		return r
+	}
+	r1, r2 := newRing(), newRing()
+
+	// The same keys get the same IDs in different rings, regardless of order.
+	if r1.Active() != r2.Active() {
+		t.Errorf("Initial IDs differ: %v, %v", r1.Active(), r2.Active())
+	}
+	b1 := r1.Add([]byte("bravo"))
+	c1 := r1.AddLabeled("c", []byte("charlie"))
+	c2 := r2.Add([]byte("charlie"))
+	b2 := r2.Add([]byte("bravo"))
+	if b1 != b2 || c1 != c2 {
+		t.Errorf("IDs differ: bravo %v, %v; charlie %v, %v", b1, b2, c1, c2)
+	}
+	if id, ok := r1.View().Find([]byte("charlie")); !ok || id != c1 {
+		t.Errorf("Find(charlie): got %v, %v; want %v, true", id, ok, c1)
+	}
+
+	// Adding the same key again has no effect.
+	if id := r1.AddLabeled("other", []byte("bravo")); id != b1 {
+		t.Errorf("Add(bravo) again: got %v, want %v", id, b1)
+	}
+	if got := r1.Label(c1); got != "c" {
+		t.Errorf("Label(%v): got %q, want c", c1, got)
+	}
+	checkHasKeys(t, r1, r1.Active(), b1, c1)
+
+	// Add short random keys until two distinct keys have the same content ID.
+	// By the birthday bound this takes about 2^16 keys.
+	r4 := newRing()
+	src := mrand.NewChaCha8([32]byte{})
+	for {
+		n := r4.Len()
+		if _, err := r4.AddRandomFrom(src, 4); errors.Is(err, keyring.ErrIDCollision) {
+			if r4.Len() != n {
+				t.Errorf("After collision: got %d keys, want %d", r4.Len(), n)
+			}
+			break
+		} else if err != nil {
+			t.Fatalf("AddRandomFrom: unexpected error: %v", err)
+		}
+	}
+
+	if err := r1.Replace(b1, []byte("delta")); err == nil {
+		t.Error("Replace: got nil, want error")
+	}
+	mtest.MustPanic(t, func() { r1.Compact() })
+
+	// The mode persists through storage.
+	data, err := r1.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	r3, err := keyring.UnmarshalRing(data, keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("UnmarshalRing failed: %v", err)
+	}
+	if got, want := r3.Add([]byte("delta")), r2.Add([]byte("delta")); got != want {
+		t.Errorf("Add after read: got %v, want %v", got, want)
+	}
+	if err := r3.Check(); err != nil {
+		t.Errorf("Check: unexpected error: %v", err)
+	}
+}
+
+func TestWriteDeterministic(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	for _, c := range []keyring.Config{
+		{},
+		{Cipher: keyring.AES256GCM},
+		{Streaming: true, Compress: true},
+	} {
+		t.Run(fmt.Sprintf("%v/Stream=%v", c.Cipher, c.Streaming), func(t *testing.T) {
+			c.AccessKey = accessKey
+			c.InitialKey = []byte("same old")
+			r, err := keyring.New(c)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			write := func() []byte {
+				t.Helper()
+				var buf bytes.Buffer
+				if _, err := r.WriteDeterministic(&buf); err != nil {
+					t.Fatalf("WriteDeterministic failed: %v", err)
+				}
+				return buf.Bytes()
+			}
+
+			out1, out2 := write(), write()
+			if !bytes.Equal(out1, out2) {
+				t.Error("Unchanged ring: outputs differ")
+			}
+			r.Add([]byte("new key"))
+			out3 := write()
+			if bytes.Equal(out1, out3) {
+				t.Error("Changed ring: outputs are equal")
+			}
+
+			r2, err := keyring.Read(bytes.NewReader(out3), keyring.StaticKey(accessKey))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			checkHasKeys(t, r2, 1, 2)
+			if got := string(r2.Get(2, nil)); got != "new key" {
+				t.Errorf("Get(2): got %q, want new key", got)
+			}
+		})
+	}
+}
+
+func TestDeactivate(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("receive only"),
+		AccessKey:  accessKey,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	checkInactive := func(r *keyring.Ring) {
+		t.Helper()
+		if id := r.Active(); id != 0 {
+			t.Errorf("Active: got %v, want 0", id)
+		}
+		mtest.MustPanic(t, func() { r.GetActive(nil) })
+		mtest.MustPanic(t, func() { r.GetActiveInfo(nil) })
+		mtest.MustPanic(t, func() { r.ActiveView() })
+		mtest.MustPanic(t, func() { r.View().GetActive(nil) })
+		if _, _, err := r.SealWithActive([]byte("x"), nil); err == nil {
+			t.Error("SealWithActive: got nil, want error")
+		}
+		if got := string(r.Get(1, nil)); got != "receive only" {
+			t.Errorf("Get(1): got %q, want %q", got, "receive only")
+		}
+		if err := r.Check(); err != nil {
+			t.Errorf("Check: unexpected error: %v", err)
+		}
+	}
+
+	// Deactivate a ring with a single key, which normally omits the marker.
+	r.Deactivate()
+	checkInactive(r)
+	if r.Remove(0) {
+		t.Error("Remove(0): got true, want false")
+	}
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	r2, err := keyring.Read(&buf, keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	checkInactive(r2)
+
+	r2.Activate(1)
+	if id, key := r2.GetActive(nil); id != 1 || string(key) != "receive only" {
+		t.Errorf("GetActive: got %v, %q; want 1, %q", id, key, "receive only")
+	}
+}
+
+func TestLabels(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("unlabeled"),
+		AccessKey:  accessKey,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	id := r.AddLabeled("signing key ✍️", []byte("labeled"))
+	empty := r.AddLabeled("", []byte("also unlabeled"))
+
+	mtest.MustPanic(t, func() { r.AddLabeled(strings.Repeat("x", 256), []byte("k")) })
+	mtest.MustPanic(t, func() { r.AddLabeled("\xff", []byte("k")) })
+	mtest.MustPanic(t, func() { r.AddLabeled("ok", nil) })
+	mtest.MustPanic(t, func() { r.Label(12345) })
+
+	check := func(r *keyring.Ring) {
+		t.Helper()
+		for _, tc := range []struct {
+			id   keyring.ID
+			want string
+		}{{1, ""}, {id, "signing key ✍️"}, {empty, ""}} {
+			if got := r.Label(tc.id); got != tc.want {
+				t.Errorf("Label(%v): got %q, want %q", tc.id, got, tc.want)
+			}
+		}
+		if got := string(r.Get(id, nil)); got != "labeled" {
+			t.Errorf("Get(%v): got %q, want labeled", id, got)
+		}
+	}
+	check(r)
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	r2, err := keyring.Read(&buf, keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	check(r2)
+	checkHasKeys(t, r2, 1, id, empty)
+
+	// Labels can be changed and removed after the fact.
+	mtest.MustPanic(t, func() { r2.SetLabel(12345, "x") })
+	mtest.MustPanic(t, func() { r2.SetLabel(id, strings.Repeat("x", 256)) })
+	mtest.MustPanic(t, func() { r2.SetLabel(id, "\xff") })
+	r2.SetLabel(1, "now labeled")
+	r2.SetLabel(id, "")
+	if got := r2.Label(1); got != "now labeled" {
+		t.Errorf("Label(1): got %q, want %q", got, "now labeled")
+	}
+	if got := r2.Label(id); got != "" {
+		t.Errorf("Label(%v): got %q, want empty", id, got)
+	}
+}
+
+func TestClone(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("original"),
+		AccessKey:     accessKey,
+		AccessKeySalt: []byte("salty"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	c := r.Clone()
+	if err := c.Check(); err != nil {
+		t.Errorf("Clone Check: unexpected error: %v", err)
+	}
+
+	// Changes to the clone do not affect the original, and vice versa.
+	c.Activate(c.Add([]byte("clone only")))
+	r.Add([]byte("original only"))
+	r.AddRandom(8)
+	if err := r.Rekey(randomBytes(keyring.AccessKeyLen), nil); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+
+	checkHasKeys(t, r, 1, 2, 3)
+	checkHasKeys(t, c, 1, 2)
+	if id := r.Active(); id != 1 {
+		t.Errorf("Original active: got %v, want 1", id)
+	}
+	if got := string(r.Get(2, nil)); got != "original only" {
+		t.Errorf("Original Get(2): got %q, want %q", got, "original only")
+	}
+	if id, got := c.GetActive(nil); id != 2 || string(got) != "clone only" {
+		t.Errorf("Clone active: got %v, %q; want 2, %q", id, got, "clone only")
+	}
+
+	// The clone retains the original access key and salt.
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if _, err := keyring.Read(&buf, keyring.AccessKeyFunc(func(salt []byte) ([]byte, error) {
+		if string(salt) != "salty" {
+			t.Errorf("Clone salt: got %q, want salty", salt)
+		}
+		return accessKey, nil
+	})); err != nil {
+		t.Errorf("Read clone failed: %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	newRing := func(keys ...string) *keyring.Ring {
+		t.Helper()
+		r, err := keyring.New(keyring.Config{
+			InitialKey: []byte(keys[0]),
+			AccessKey:  randomBytes(keyring.AccessKeyLen),
+		})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		for _, key := range keys[1:] {
+			r.Add([]byte(key))
+		}
+		return r
+	}
+	type entry struct {
+		ID  keyring.ID
+		Key string
+	}
+	checkKeys := func(r *keyring.Ring, want ...entry) {
+		t.Helper()
+		var got []entry
+		for id, key := range r.Keys() {
+			got = append(got, entry{id, string(key)})
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("Keys (-got, +want):\n%s", diff)
+		}
+	}
+
+	r := newRing("apple", "cherry")
+	other := newRing("banana", "cherry", "banana", "date")
+	other.AddLabeled("fig label", []byte("fig"))
+
+	n, err := r.Merge(other.View())
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	} else if n != 3 {
+		t.Errorf("Merge: added %d keys, want 3", n)
+	}
+	want := []entry{{1, "apple"}, {2, "cherry"}, {3, "banana"}, {4, "date"}, {5, "fig"}}
+	checkKeys(r, want...)
+	if id := r.Active(); id != 1 {
+		t.Errorf("Active: got %v, want 1", id)
+	}
+	if got := r.Label(5); got != "fig label" {
+		t.Errorf("Label(5): got %q, want %q", got, "fig label")
+	}
+
+	// Merging the same keys again has no effect.
+	n, err = r.Merge(other.View())
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	} else if n != 0 {
+		t.Errorf("Merge again: added %d keys, want 0", n)
+	}
+	checkKeys(r, want...)
+
+	// Merging a ring into itself has no effect.
+	if n, err := r.Merge(r.View()); err != nil || n != 0 {
+		t.Errorf("Merge self: got %d, %v; want 0, nil", n, err)
+	}
+
+	if _, err := r.Merge(nil); err == nil {
+		t.Error("Merge(nil): got nil, want error")
+	}
+}
+
+func TestFind(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("alpha"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("bravo"))
+	r.Add([]byte("charlie"))
+	r.Add([]byte("bravo")) // duplicate
+
+	tests := []struct {
+		key    string
+		wantID keyring.ID
+		wantOK bool
+	}{
+		{"alpha", 1, true},
+		{"bravo", 2, true},
+		{"charlie", 3, true},
+		{"delta", 0, false},
+		{"alph", 0, false},
+		{"", 0, false},
+	}
+	for _, tc := range tests {
+		for name, find := range map[string]func([]byte) (keyring.ID, bool){
+			"Ring": r.Find, "View": r.View().Find,
+		} {
+			id, ok := find([]byte(tc.key))
+			if id != tc.wantID || ok != tc.wantOK {
+				t.Errorf("%s Find(%q): got %v, %v; want %v, %v", name, tc.key, id, ok, tc.wantID, tc.wantOK)
+			}
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	for _, inMemory := range []bool{false, true} {
+		r, err := keyring.New(keyring.Config{
+			InitialKey:      []byte("alpha"),
+			AccessKey:       randomBytes(keyring.AccessKeyLen),
+			EncryptInMemory: inMemory,
+		})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		id := r.Add([]byte("bravo"))
+
+		tests := []struct {
+			id   keyring.ID
+			key  string
+			want bool
+		}{
+			{1, "alpha", true},
+			{id, "bravo", true},
+			{1, "bravo", false},
+			{1, "alph", false},
+			{1, "", false},
+			{99, "alpha", false},
+		}
+		for _, tc := range tests {
+			for name, equal := range map[string]func(keyring.ID, []byte) bool{
+				"Ring": r.Equal, "View": r.View().Equal,
+			} {
+				if got := equal(tc.id, []byte(tc.key)); got != tc.want {
+					t.Errorf("%s Equal(%v, %q) [sealed=%v]: got %v, want %v", name, tc.id, tc.key, inMemory, got, tc.want)
+				}
+			}
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("first"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	id := r.AddLabeled("typo", []byte("secnod"))
+	created := r.CreatedAt(id)
+	old := r.View()
+
+	fixed := []byte("second")
+	if err := r.Replace(id, fixed); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	clear(fixed) // the ring keeps its own copy
+	if got := string(r.Get(id, nil)); got != "second" {
+		t.Errorf("Get(%v): got %q, want second", id, got)
+	}
+	if got := r.Label(id); got != "typo" {
+		t.Errorf("Label(%v): got %q, want typo", id, got)
+	}
+	if got := r.CreatedAt(id); !got.Equal(created) {
+		t.Errorf("CreatedAt(%v): got %v, want %v", id, got, created)
+	}
+	checkHasKeys(t, r, 1, id)
+
+	// A view taken before the replacement is not affected.
+	if got := string(old.Get(id, nil)); got != "secnod" {
+		t.Errorf("Old view Get(%v): got %q, want secnod", id, got)
+	}
+
+	checkError(t, "Replace", r.Replace(12345, []byte("x")), "no such key")
+	checkError(t, "Replace", r.Replace(id, nil), "empty key")
+}
+
+func TestConcurrent(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: randomBytes(16),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// Run readers and writers concurrently. Under the race detector, this
+	// reports any unsynchronized access to the ring.
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			for range 100 {
+				id, key := r.GetActive(nil)
+				if len(key) == 0 || !r.Has(id) {
+					t.Errorf("GetActive: got id %v, key %q", id, key)
+				}
+				for id := range r.IDs() {
+					r.Get(id, nil)
+				}
+				r.View()
+			}
+		})
+		wg.Go(func() {
+			for range 100 {
+				r.Activate(r.AddRandom(16))
+			}
+		})
+	}
+	wg.Go(func() {
+		for range 10 {
+			if err := r.Rekey(randomBytes(keyring.AccessKeyLen), nil); err != nil {
+				t.Errorf("Rekey failed: %v", err)
+			}
+			if _, err := r.WriteTo(io.Discard); err != nil {
+				t.Errorf("WriteTo failed: %v", err)
+			}
+		}
+	})
+	wg.Wait()
+
+	if got, want := r.Len(), 401; got != want {
+		t.Errorf("Len: got %d, want %d", got, want)
+	}
+	if err := r.Check(); err != nil {
+		t.Errorf("Check failed: %v", err)
+	}
+}
+
+func TestArgon2id(t *testing.T) {
+	// Use small parameters to keep the test fast.
+	params := keyring.Argon2Params{Time: 1, Memory: 64, Threads: 2}
+	salt := keyring.GenerateSalt(16)
+	akey, err := keyring.Argon2idKey("hunter2", params)(salt)
+	if err != nil {
+		t.Fatalf("Argon2idKey failed: %v", err)
+	}
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("apple"),
+		AccessKey:     akey,
+		AccessKeySalt: salt,
+		Argon2Params:  &params,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// readWith writes r, recovers its stored parameters, and reads it back
+	// with the given passphrase.
+	readWith := func(t *testing.T, passphrase string) (*keyring.Ring, *keyring.Info, error) {
+		t.Helper()
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		info, err := keyring.Inspect(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Inspect failed: %v", err)
+		}
+		if info.Argon2Params == nil {
+			return nil, info, errors.New("no argon2id parameters")
+		}
+		got, err := keyring.Read(&buf, keyring.Argon2idKey(passphrase, *info.Argon2Params))
+		return got, info, err
+	}
+
+	t.Run("Read", func(t *testing.T) {
+		got, info, err := readWith(t, "hunter2")
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if *info.Argon2Params != params {
+			t.Errorf("Argon2Params: got %+v, want %+v", *info.Argon2Params, params)
+		}
+		if _, key := got.GetActive(nil); string(key) != "apple" {
+			t.Errorf("GetActive: got %q, want apple", key)
+		}
+
+		// The parameters persist when the ring is written again.
+		r = got
+		if _, _, err := readWith(t, "hunter2"); err != nil {
+			t.Errorf("Read after rewrite failed: %v", err)
+		}
+	})
+
+	t.Run("WrongPassphrase", func(t *testing.T) {
+		_, _, err := readWith(t, "hunter3")
+		if !errors.Is(err, keyring.ErrBadAccessKey) {
+			t.Errorf("Read: got %v, want %v", err, keyring.ErrBadAccessKey)
+		}
+	})
+
+	t.Run("Rekey", func(t *testing.T) {
+		next := keyring.Argon2Params{Time: 2, Memory: 32, Threads: 1}
+		if err := r.RekeyArgon2id("swordfish", next); err != nil {
+			t.Fatalf("RekeyArgon2id failed: %v", err)
+		}
+		_, info, err := readWith(t, "swordfish")
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if *info.Argon2Params != next {
+			t.Errorf("Argon2Params: got %+v, want %+v", *info.Argon2Params, next)
+		}
+
+		// A plain rekey discards the parameters.
+		if err := r.Rekey(randomBytes(keyring.AccessKeyLen), nil); err != nil {
+			t.Fatalf("Rekey failed: %v", err)
+		}
+		if _, _, err := readWith(t, "swordfish"); err == nil {
+			t.Error("Read after Rekey: got nil error, want no parameters")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		bad := keyring.Argon2Params{Time: 1, Memory: 8, Threads: 2}
+		if _, err := keyring.Argon2idKey("x", bad)(salt); err == nil {
+			t.Error("Argon2idKey: got nil error for invalid parameters")
+		}
+		if _, err := keyring.Argon2idKey("x", params)(nil); err == nil {
+			t.Error("Argon2idKey: got nil error for empty salt")
+		}
+		_, err := keyring.New(keyring.Config{
+			InitialKey:   []byte("x"),
+			AccessKey:    akey,
+			Argon2Params: &bad,
+		})
+		checkError(t, "New", err, "invalid argon2id parameters")
+	})
+}
+
+func TestScrypt(t *testing.T) {
+	// Use small parameters to keep the test fast.
+	const n, r, p = 1024, 8, 1
+	salt := keyring.GenerateSalt(16)
+	akey, err := keyring.ScryptKey("hunter2", n, r, p)(salt)
+	if err != nil {
+		t.Fatalf("ScryptKey failed: %v", err)
+	}
+	ring, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("apple"),
+		AccessKey:     akey,
+		AccessKeySalt: salt,
+		ScryptParams:  &keyring.ScryptParams{N: n, R: r, P: p},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := ring.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	t.Run("Read", func(t *testing.T) {
+		got, err := keyring.ReadWithPassphrase(bytes.NewReader(data), "hunter2")
+		if err != nil {
+			t.Fatalf("ReadWithPassphrase failed: %v", err)
+		}
+		if _, key := got.GetActive(nil); string(key) != "apple" {
+			t.Errorf("GetActive: got %q, want apple", key)
+		}
+		info, err := keyring.Inspect(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Inspect failed: %v", err)
+		}
+		if want := (keyring.ScryptParams{N: n, R: r, P: p}); *info.ScryptParams != want {
+			t.Errorf("ScryptParams: got %+v, want %+v", *info.ScryptParams, want)
+		}
+	})
+
+	t.Run("WrongPassphrase", func(t *testing.T) {
+		_, err := keyring.ReadWithPassphrase(bytes.NewReader(data), "hunter3")
+		if !errors.Is(err, keyring.ErrBadAccessKey) {
+			t.Errorf("ReadWithPassphrase: got %v, want %v", err, keyring.ErrBadAccessKey)
+		}
+	})
+
+	t.Run("Rekey", func(t *testing.T) {
+		cp := ring.Clone()
+		if err := cp.RekeyScrypt("swordfish", 2048, 4, 2); err != nil {
+			t.Fatalf("RekeyScrypt failed: %v", err)
+		}
+		var buf bytes.Buffer
+		if _, err := cp.WriteTo(&buf); err != nil {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		if _, err := keyring.ReadWithPassphrase(&buf, "swordfish"); err != nil {
+			t.Errorf("ReadWithPassphrase failed: %v", err)
+		}
+	})
+
+	t.Run("BadStoredParams", func(t *testing.T) {
+		// Find the scrypt parameters packet and change N to a non-power of 2.
+		bad := bytes.Clone(data)
+		i := bytes.Index(bad, []byte{10, 0, 0, 12})
+		if i < 0 {
+			t.Fatal("Scrypt parameters packet not found")
+		}
+		bad[i+7] = 3 // N = 3
+		_, err := keyring.ReadWithPassphrase(bytes.NewReader(bad), "hunter2")
+		checkError(t, "ReadWithPassphrase", err, "not a power of two")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, tc := range []struct{ n, r, p int }{{1, 8, 1}, {1000, 8, 1}, {1024, 0, 1}, {1024, 1 << 15, 1 << 15}} {
+			if _, err := keyring.ScryptKey("x", tc.n, tc.r, tc.p)(salt); err == nil {
+				t.Errorf("ScryptKey(%d, %d, %d): got nil error", tc.n, tc.r, tc.p)
+			}
+		}
+		_, err := keyring.New(keyring.Config{
+			InitialKey:   []byte("x"),
+			AccessKey:    akey,
+			Argon2Params: &keyring.DefaultArgon2Params,
+			ScryptParams: &keyring.ScryptParams{N: n, R: r, P: p},
+		})
+		checkError(t, "New", err, "both argon2id and scrypt")
+	})
+}
+
+func TestPassphraseKeyN(t *testing.T) {
+	salt := keyring.GenerateSalt(16)
+
+	// The default number of passes matches PassphraseKey.
+	k1, _ := keyring.PassphraseKey("hunter2")(salt)
+	k2, err := keyring.PassphraseKeyN("hunter2", 3)(salt)
+	if err != nil {
+		t.Fatalf("PassphraseKeyN failed: %v", err)
+	}
+	if !bytes.Equal(k1, k2) {
+		t.Error("PassphraseKeyN(3) does not match PassphraseKey")
+	}
+	if _, err := keyring.PassphraseKeyN("hunter2", 0)(salt); err == nil {
+		t.Error("PassphraseKeyN(0): got nil error")
+	}
+
+	// A ring written with a custom count reopens with that count.
+	const iters = 5
+	akey, err := keyring.PassphraseKeyN("hunter2", iters)(salt)
+	if err != nil {
+		t.Fatalf("PassphraseKeyN failed: %v", err)
+	}
+	params := keyring.PassphraseArgon2Params(iters)
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("apple"),
+		AccessKey:     akey,
+		AccessKeySalt: salt,
+		Argon2Params:  &params,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	got, err := keyring.ReadWithPassphrase(bytes.NewReader(buf.Bytes()), "hunter2")
+	if err != nil {
+		t.Fatalf("ReadWithPassphrase failed: %v", err)
+	}
+	if _, key := got.GetActive(nil); string(key) != "apple" {
+		t.Errorf("GetActive: got %q, want apple", key)
+	}
+	if _, err := keyring.Read(bytes.NewReader(buf.Bytes()), keyring.PassphraseKeyN("hunter2", iters)); err != nil {
+		t.Errorf("Read with PassphraseKeyN failed: %v", err)
+	}
+	if _, err := keyring.Read(bytes.NewReader(buf.Bytes()), keyring.PassphraseKey("hunter2")); err == nil {
+		t.Error("Read with PassphraseKey: got nil error, want bad access key")
+	}
+}
+
+func TestCipher(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	for _, c := range []keyring.Cipher{keyring.ChaCha20Poly1305, keyring.AES256GCM} {
+		t.Run(c.String(), func(t *testing.T) {
+			r, err := keyring.New(keyring.Config{
+				InitialKey: []byte("apple"),
+				AccessKey:  accessKey,
+				Cipher:     c,
+			})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			r.Activate(r.Add([]byte("pear")))
+			if got := r.Cipher(); got != c {
+				t.Errorf("Cipher: got %v, want %v", got, c)
+			}
+
+			var buf bytes.Buffer
+			if _, err := r.WriteTo(&buf); err != nil {
+				t.Fatalf("WriteTo failed: %v", err)
+			}
+			info, err := keyring.Inspect(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("Inspect failed: %v", err)
+			}
+			if info.Cipher != c {
+				t.Errorf("Inspect: got cipher %v, want %v", info.Cipher, c)
+			}
+
+			got, err := keyring.Read(&buf, keyring.StaticKey(accessKey))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if got.Cipher() != c {
+				t.Errorf("Read: got cipher %v, want %v", got.Cipher(), c)
+			}
+			if _, key := got.GetActive(nil); string(key) != "pear" {
+				t.Errorf("GetActive: got %q, want pear", key)
+			}
+
+			// The cipher is preserved when the ring is rekeyed.
+			newKey := randomBytes(keyring.AccessKeyLen)
+			if err := got.Rekey(newKey, nil); err != nil {
+				t.Fatalf("Rekey failed: %v", err)
+			}
+			buf.Reset()
+			if _, err := got.WriteTo(&buf); err != nil {
+				t.Fatalf("WriteTo failed: %v", err)
+			}
+			if cp, err := keyring.Read(&buf, keyring.StaticKey(newKey)); err != nil {
+				t.Errorf("Read after Rekey failed: %v", err)
+			} else if cp.Cipher() != c {
+				t.Errorf("Read after Rekey: got cipher %v, want %v", cp.Cipher(), c)
+			}
+		})
+	}
+
+	t.Run("Unknown", func(t *testing.T) {
+		_, err := keyring.New(keyring.Config{
+			InitialKey: []byte("apple"),
+			AccessKey:  accessKey,
+			Cipher:     99,
+		})
+		checkError(t, "New", err, "unknown cipher")
+	})
+}
+
+func TestMarshalBinary(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("apple"),
+		AccessKey:     accessKey,
+		AccessKeySalt: []byte("salty"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Activate(r.AddLabeled("fruit", []byte("pear")))
+
+	var _ encoding.BinaryMarshaler = r
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	// The encoding has the same shape as the output of WriteTo. The contents
+	// differ, since each encryption uses a fresh nonce.
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if len(data) != buf.Len() {
+		t.Errorf("MarshalBinary: got %d bytes, WriteTo wrote %d", len(data), buf.Len())
+	}
+
+	got, err := keyring.UnmarshalRing(data, keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("UnmarshalRing failed: %v", err)
+	}
+	clear(data) // the result does not share storage with the input
+	if diff := cmp.Diff(r.View(), got.View(), cmp.AllowUnexported(keyring.View{})); diff != "" {
+		t.Errorf("UnmarshalRing (-want, +got):\n%s", diff)
+	}
+
+	if _, err := keyring.UnmarshalRing(buf.Bytes(), keyring.StaticKey(randomBytes(keyring.AccessKeyLen))); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("UnmarshalRing: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+}
+
+func TestReadFrom(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{InitialKey: []byte("apple"), AccessKey: accessKey})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Activate(r.AddLabeled("fruit", []byte("pear")))
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	p := keyring.NewPending(keyring.StaticKey(randomBytes(keyring.AccessKeyLen)))
+	var _ io.ReaderFrom = p
+	mtest.MustPanic(t, func() { p.Len() })
+
+	// A failed read leaves the ring pending.
+	if _, err := p.ReadFrom(bytes.NewReader(data)); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("ReadFrom: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+	mtest.MustPanic(t, func() { p.Active() })
+
+	p = keyring.NewPending(keyring.StaticKey(bytes.Clone(accessKey)))
+	n, err := p.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	} else if n != int64(len(data)) {
+		t.Errorf("ReadFrom: read %d bytes, want %d", n, len(data))
+	}
+	if diff := cmp.Diff(r.View(), p.View(), cmp.AllowUnexported(keyring.View{})); diff != "" {
+		t.Errorf("ReadFrom (-want, +got):\n%s", diff)
+	}
+	if got := p.AccessKeyIndex(); got != 0 {
+		t.Errorf("AccessKeyIndex: got %d, want 0", got)
+	}
+
+	// Once read, the ring is no longer pending.
+	if _, err := p.ReadFrom(bytes.NewReader(data)); err == nil {
+		t.Error("ReadFrom again: got nil, want error")
+	}
+	if _, err := r.ReadFrom(bytes.NewReader(data)); err == nil {
+		t.Error("ReadFrom on a ring from New: got nil, want error")
+	}
+	mtest.MustPanic(t, func() { keyring.NewPending(nil) })
+}
+
+func TestReadContext(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("apple"),
+		AccessKey:  accessKey,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		got, err := keyring.ReadContext(t.Context(), bytes.NewReader(data), keyring.StaticKey(accessKey))
+		if err != nil {
+			t.Fatalf("ReadContext failed: %v", err)
+		}
+		if _, key := got.GetActive(nil); string(key) != "apple" {
+			t.Errorf("GetActive: got %q, want apple", key)
+		}
+	})
+
+	t.Run("CancelRead", func(t *testing.T) {
+		pr, pw := io.Pipe() // never written, so reads block
+		defer pw.Close()
+
+		ctx, cancel := context.WithCancel(t.Context())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err := keyring.ReadContext(ctx, pr, keyring.StaticKey(accessKey))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ReadContext: got %v, want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("SkipKDF", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		_, err := keyring.ReadContext(ctx, bytes.NewReader(data), keyring.AccessKeyFunc(func(salt []byte) ([]byte, error) {
+			t.Error("Access key function was called after cancellation")
+			return accessKey, nil
+		}))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ReadContext: got %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestReadWith(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("apple"),
+		AccessKey:  accessKey,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	key := keyring.StaticKey(accessKey)
+
+	for _, max := range []int{0, -1, len(data)} {
+		if _, err := keyring.ReadWith(bytes.NewReader(data), key, &keyring.ReadOptions{MaxSize: max}); err != nil {
+			t.Errorf("ReadWith(MaxSize=%d) failed: %v", max, err)
+		}
+	}
+	if _, err := keyring.ReadWith(bytes.NewReader(data), key, nil); err != nil {
+		t.Errorf("ReadWith(nil) failed: %v", err)
+	}
+
+	_, err = keyring.ReadWith(bytes.NewReader(data), key, &keyring.ReadOptions{MaxSize: len(data) - 1})
+	if !errors.Is(err, keyring.ErrTooLarge) {
+		t.Errorf("ReadWith: got %v, want %v", err, keyring.ErrTooLarge)
+	}
+
+	// Read applies the default limit, without consuming more than it allows.
+	big := io.MultiReader(bytes.NewReader(data), crand.Reader)
+	if _, err := keyring.Read(big, key); !errors.Is(err, keyring.ErrTooLarge) {
+		t.Errorf("Read: got %v, want %v", err, keyring.ErrTooLarge)
+	}
+}
+
+func TestMinKDFParams(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	encode := func(t *testing.T, cfg keyring.Config) []byte {
+		t.Helper()
+		cfg.InitialKey = []byte("apple")
+		cfg.AccessKey = accessKey
+		cfg.AccessKeySalt = keyring.GenerateSalt(16)
+		r, err := keyring.New(cfg)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		data, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		return data
+	}
+	argon := encode(t, keyring.Config{Argon2Params: &keyring.Argon2Params{Time: 2, Memory: 1024, Threads: 1}})
+	scrypt := encode(t, keyring.Config{ScryptParams: &keyring.ScryptParams{N: 1 << 10, R: 8, P: 1}})
+	plain := encode(t, keyring.Config{})
+
+	weakArgon := &keyring.Argon2Params{Time: 3, Memory: 1024}
+	weakScrypt := &keyring.ScryptParams{N: 1 << 15, R: 8, P: 1}
+	tests := []struct {
+		name string
+		data []byte
+		opts *keyring.ReadOptions
+		weak bool
+	}{
+		{"Argon2OK", argon, &keyring.ReadOptions{MinArgon2Params: &keyring.Argon2Params{Time: 2, Memory: 1024}}, false},
+		{"Argon2Time", argon, &keyring.ReadOptions{MinArgon2Params: weakArgon}, true},
+		{"Argon2Memory", argon, &keyring.ReadOptions{MinArgon2Params: &keyring.Argon2Params{Time: 1, Memory: 2048}}, true},
+		{"Argon2Threads", argon, &keyring.ReadOptions{MinArgon2Params: &keyring.Argon2Params{Time: 1, Memory: 1024, Threads: 4}}, false},
+		{"Argon2ScryptFloor", argon, &keyring.ReadOptions{MinScryptParams: weakScrypt}, false},
+
+		{"ScryptOK", scrypt, &keyring.ReadOptions{MinScryptParams: &keyring.ScryptParams{N: 1 << 10, R: 8, P: 1}}, false},
+		{"ScryptN", scrypt, &keyring.ReadOptions{MinScryptParams: weakScrypt}, true},
+		{"ScryptR", scrypt, &keyring.ReadOptions{MinScryptParams: &keyring.ScryptParams{N: 2, R: 16, P: 1}}, true},
+		{"ScryptArgon2Floor", scrypt, &keyring.ReadOptions{MinArgon2Params: weakArgon}, false},
+
+		{"NoParams", plain, &keyring.ReadOptions{MinArgon2Params: weakArgon, MinScryptParams: weakScrypt}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var called bool
+			_, err := keyring.ReadWith(bytes.NewReader(tc.data), keyring.AccessKeyFunc(func([]byte) ([]byte, error) {
+				called = true
+				return bytes.Clone(accessKey), nil
+			}), tc.opts)
+			if tc.weak {
+				if !errors.Is(err, keyring.ErrWeakKDF) {
+					t.Errorf("ReadWith: got %v, want %v", err, keyring.ErrWeakKDF)
+				}
+				if called {
+					t.Error("ReadWith called the access key function for weak parameters")
+				}
+			} else if err != nil {
+				t.Errorf("ReadWith failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestStreamingCiphers(t *testing.T) {
+	for _, c := range []keyring.Cipher{keyring.ChaCha20Poly1305, keyring.AES256GCM} {
+		t.Run(c.String(), func(t *testing.T) {
+			accessKey := randomBytes(keyring.AccessKeyLen)
+			r, err := keyring.New(keyring.Config{
+				InitialKey: []byte("apple"),
+				AccessKey:  accessKey,
+				Cipher:     c,
+				Streaming:  true,
+			})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			// firstFrame returns the first stream frame of a new encoding of r.
+			firstFrame := func() []byte {
+				t.Helper()
+				data, err := r.MarshalBinary()
+				if err != nil {
+					t.Fatalf("MarshalBinary failed: %v", err)
+				}
+				if _, err := keyring.Read(bytes.NewReader(data), keyring.StaticKey(bytes.Clone(accessKey))); err != nil {
+					t.Fatalf("Read failed: %v", err)
+				}
+				dec, err := new(keyring.Decoder).Decode(data)
+				if err != nil {
+					t.Fatalf("Decode failed: %v", err)
+				}
+				for _, p := range dec.Packets {
+					if p.Type == "STREAM_FRAME" {
+						return bytes.Clone(p.Data)
+					}
+				}
+				t.Fatal("No stream frame found")
+				return nil
+			}
+
+			// Each write derives a new stream key from a random 32-byte salt,
+			// so that writes with the same data key do not share nonces.
+			f1, f2 := firstFrame(), firstFrame()
+			if len(f1) < 32 || len(f2) < 32 {
+				t.Fatalf("First frames are too short: %d, %d bytes", len(f1), len(f2))
+			}
+			if bytes.Equal(f1[:32], f2[:32]) {
+				t.Errorf("Stream salts are equal: %x", f1[:32])
+			}
+		})
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: randomBytes(1024),
+		AccessKey:  accessKey,
+		Streaming:  true,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	// Add enough key material to span several frames.
+	for range 300 {
+		r.AddRandom(1024)
+	}
+	r.Activate(r.AddLabeled("last", []byte("apple")))
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	types, err := keyring.PacketTypes(data)
+	if err != nil {
+		t.Fatalf("PacketTypes failed: %v", err)
+	}
+	var frames []int // indexes of frame packets
+	for i, pt := range types {
+		switch pt {
+		case "STREAM_FRAME":
+			frames = append(frames, i)
+		case "BUNDLE":
+			t.Errorf("Packet %d is a bundle, want only stream frames", i)
+		}
+	}
+	if len(frames) < 2 {
+		t.Fatalf("Got %d stream frames, want at least 2", len(frames))
+	}
+
+	got, err := keyring.Read(bytes.NewReader(data), keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if diff := cmp.Diff(r.View(), got.View(), cmp.AllowUnexported(keyring.View{})); diff != "" {
+		t.Errorf("Read (-want, +got):\n%s", diff)
+	}
+
+	// A ring read from a streamed keyring is written the same way.
+	rt, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if types, err := keyring.PacketTypes(rt); err != nil {
+		t.Fatalf("PacketTypes failed: %v", err)
+	} else if !slices.Contains(types, "STREAM_FRAME") {
+		t.Errorf("Rewritten packets: got %q, want stream frames", types)
+	}
+
+	// Split the encoding into its header and packets, to tamper with frames.
+	// Each packet has a 1-byte type and a 3-byte length.
+	hdr, rest := data[:4], data[4:]
+	var pkts [][]byte
+	for len(rest) != 0 {
+		n := 4 + (int(rest[1])<<16 | int(rest[2])<<8 | int(rest[3]))
+		pkts = append(pkts, rest[:n])
+		rest = rest[n:]
+	}
+	join := func(ps [][]byte) []byte { return append(bytes.Clone(hdr), slices.Concat(ps...)...) }
+	first, last := frames[0], frames[len(frames)-1]
+
+	tests := []struct {
+		name string
+		pkts [][]byte
+	}{
+		{"DropFirst", slices.Delete(slices.Clone(pkts), first, first+1)},
+		{"DropMiddle", slices.Delete(slices.Clone(pkts), first+1, first+2)},
+		{"DropLast", slices.Delete(slices.Clone(pkts), last, last+1)},
+		{"Swap", func() [][]byte {
+			cp := slices.Clone(pkts)
+			cp[first+1], cp[first+2] = cp[first+2], cp[first+1]
+			return cp
+		}()},
+		{"Repeat", slices.Insert(slices.Clone(pkts), last, pkts[last-1])},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := keyring.Read(bytes.NewReader(join(tc.pkts)), keyring.StaticKey(accessKey))
+			checkError(t, "Read", err, "decrypt stream")
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	newRing := func(t *testing.T, compress, streaming bool) *keyring.Ring {
+		t.Helper()
+		r, err := keyring.New(keyring.Config{
+			InitialKey: []byte("token-00000"),
+			AccessKey:  accessKey,
+			Compress:   compress,
+			Streaming:  streaming,
+		})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		for i := range 200 {
+			r.Add(fmt.Appendf(nil, "token-%05d", i+1))
+		}
+		return r
+	}
+	encode := func(t *testing.T, r *keyring.Ring) []byte {
+		t.Helper()
+		data, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		return data
+	}
+
+	plain := encode(t, newRing(t, false, false))
+	for _, streaming := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Streaming=%v", streaming), func(t *testing.T) {
+			r := newRing(t, true, streaming)
+			data := encode(t, r)
+			if len(data) >= len(plain) {
+				t.Errorf("Compressed size %d ≥ uncompressed size %d", len(data), len(plain))
+			}
+			got, err := keyring.Read(bytes.NewReader(data), keyring.StaticKey(accessKey))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if diff := cmp.Diff(r.View(), got.View(), cmp.AllowUnexported(keyring.View{})); diff != "" {
+				t.Errorf("Read (-want, +got):\n%s", diff)
+			}
+
+			// The setting is preserved when the ring is written again.
+			if again := encode(t, got); len(again) >= len(plain) {
+				t.Errorf("Rewritten size %d ≥ uncompressed size %d", len(again), len(plain))
+			}
+		})
+	}
+}
+
+func TestViewJSON(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("apple"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	id := r.AddLabeled("binary", []byte{0xff, 0x00, 0xfe})
+	r.SetNotBefore(id, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	r.Activate(id)
+
+	if _, ok := any(r).(json.Marshaler); ok {
+		t.Error("Ring implements json.Marshaler, but should not")
+	}
+
+	v := r.View()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	t.Logf("JSON: %s", data)
+
+	// Check the shape of the output.
+	var raw struct {
+		Active int
+		Keys   []map[string]any
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if raw.Active != id || len(raw.Keys) != 2 {
+		t.Errorf("JSON: got active %d with %d keys, want %d with 2", raw.Active, len(raw.Keys), id)
+	}
+	if got, want := raw.Keys[1]["key_base64"], "/wD+"; got != want {
+		t.Errorf("JSON key: got %v, want %q", got, want)
+	}
+	if _, ok := raw.Keys[0]["label"]; ok {
+		t.Errorf("JSON key 1 has a label: %v", raw.Keys[0])
+	}
+
+	got, err := keyring.ImportJSON(data)
+	if err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+	if diff := cmp.Diff(v, got, cmp.AllowUnexported(keyring.View{})); diff != "" {
+		t.Errorf("ImportJSON (-want, +got):\n%s", diff)
+	}
+
+	for _, bad := range []string{
+		`{"active":1,"keys":[{"id":1}]}`,
+		`{"active":1,"keys":[{"id":0,"key_base64":"YQ=="}]}`,
+		`{"active":1,"keys":[{"id":1,"key_base64":"YQ=="},{"id":1,"key_base64":"Yg=="}]}`,
+		`{"active":2,"keys":[{"id":1,"key_base64":"YQ=="}]}`,
+		`{"active":1,"keys":[{"id":1,"key_base64":"not base64"}]}`,
+		`[]`,
+	} {
+		if v, err := keyring.ImportJSON([]byte(bad)); err == nil {
+			t.Errorf("ImportJSON(%s): got %v, want error", bad, v)
+		}
+	}
+}
+
+func TestArmored(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("apple"),
+		AccessKey:  accessKey,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Activate(r.Add([]byte("pear")))
+
+	var buf bytes.Buffer
+	if err := r.WriteArmored(&buf); err != nil {
+		t.Fatalf("WriteArmored failed: %v", err)
+	}
+	text := buf.String()
+	t.Logf("Armored:\n%s", text)
+	if !strings.HasPrefix(text, "-----BEGIN KEYRING-----\n") {
+		t.Errorf("WriteArmored: output does not begin with a KEYRING block:\n%s", text)
+	}
+
+	// Surrounding text is ignored.
+	got, err := keyring.ReadArmored(strings.NewReader("prologue\n"+text+"epilogue\n"), keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("ReadArmored failed: %v", err)
+	}
+	if diff := cmp.Diff(r.View(), got.View(), cmp.AllowUnexported(keyring.View{})); diff != "" {
+		t.Errorf("ReadArmored (-want, +got):\n%s", diff)
+	}
+
+	_, err = keyring.ReadArmored(strings.NewReader("no block here"), keyring.StaticKey(accessKey))
+	checkError(t, "ReadArmored", err, "no PEM block")
+
+	wrong := strings.ReplaceAll(text, "KEYRING", "PRIVATE KEY")
+	_, err = keyring.ReadArmored(strings.NewReader(wrong), keyring.StaticKey(accessKey))
+	checkError(t, "ReadArmored", err, `type "PRIVATE KEY"`)
+}
+
+func TestAddRandomFrom(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("apple"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// A deterministic source produces the same keys each time.
+	seed := [32]byte{1, 2, 3}
+	id, err := r.AddRandomFrom(mrand.NewChaCha8(seed), 16)
+	if err != nil {
+		t.Fatalf("AddRandomFrom failed: %v", err)
+	}
+	want := make([]byte, 16)
+	mrand.NewChaCha8(seed).Read(want)
+	if got := r.Get(id, nil); !bytes.Equal(got, want) {
+		t.Errorf("Get(%v): got %x, want %x", id, got, want)
+	}
+
+	// A short read is an error, and does not add a key.
+	_, err = r.AddRandomFrom(strings.NewReader("short"), 16)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("AddRandomFrom: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	checkHasKeys(t, r, 1, id)
+
+	// A large key can be read from the random stream.
+	big, err := r.AddRandomFrom(keyring.RandomKeyReader(), 1<<16)
+	if err != nil {
+		t.Fatalf("AddRandomFrom failed: %v", err)
+	}
+	if got := len(r.Get(big, nil)); got != 1<<16 {
+		t.Errorf("Get(%v): got %d bytes, want %d", big, got, 1<<16)
+	}
+	checkHasKeys(t, r, 1, id, big)
+}
+
+func TestHeaderMAC(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("apple"),
+		AccessKey:     accessKey,
+		AccessKeySalt: []byte("original salt"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	// Note that the reader clears the access key when it is done, so each
+	// read below uses its own copy.
+
+	// The unmodified ring reads and verifies correctly.
+	if err := keyring.VerifyAccessKey(bytes.NewReader(data), keyring.StaticKey(bytes.Clone(accessKey))); err != nil {
+		t.Errorf("VerifyAccessKey: unexpected error: %v", err)
+	}
+
+	// Replace the salt with another of the same length. The access key does
+	// not depend on the salt, so the data key still decrypts, but the header
+	// no longer matches its MAC.
+	bad := bytes.Replace(data, []byte("original salt"), []byte("modified salt"), 1)
+	if bytes.Equal(bad, data) {
+		t.Fatal("Salt not found in the encoded ring")
+	}
+	if _, err := keyring.Read(bytes.NewReader(bad), keyring.StaticKey(bytes.Clone(accessKey))); !errors.Is(err, keyring.ErrTampered) {
+		t.Errorf("Read: got %v, want %v", err, keyring.ErrTampered)
+	}
+	if err := keyring.VerifyAccessKey(bytes.NewReader(bad), keyring.StaticKey(bytes.Clone(accessKey))); !errors.Is(err, keyring.ErrTampered) {
+		t.Errorf("VerifyAccessKey: got %v, want %v", err, keyring.ErrTampered)
+	}
+
+	// A wrong access key is reported as such, not as tampering.
+	wrongKey := keyring.StaticKey(randomBytes(keyring.AccessKeyLen))
+	if _, err := keyring.Read(bytes.NewReader(bad), wrongKey); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("Read: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+
+	// Removing the MAC is also tampering, even if a missing MAC is allowed,
+	// since the bundle records that the MAC was present.
+	dec, err := new(keyring.Decoder).Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	var stripped []byte
+	for _, p := range dec.Packets {
+		if p.Type == "HEADER_MAC" {
+			stripped = append(bytes.Clone(data[:p.Offset]), data[p.Offset+4+len(p.Data):]...)
+		}
+	}
+	if stripped == nil {
+		t.Fatal("Header MAC not found in the encoded ring")
+	}
+	if _, err := keyring.Read(bytes.NewReader(stripped), keyring.StaticKey(bytes.Clone(accessKey))); !errors.Is(err, keyring.ErrTampered) {
+		t.Errorf("Read stripped: got %v, want %v", err, keyring.ErrTampered)
+	}
+	legacy := &keyring.ReadOptions{AllowMissingMAC: true}
+	if _, err := keyring.ReadWith(bytes.NewReader(stripped), keyring.StaticKey(bytes.Clone(accessKey)), legacy); !errors.Is(err, keyring.ErrTampered) {
+		t.Errorf("ReadWith stripped: got %v, want %v", err, keyring.ErrTampered)
+	}
+	if err := keyring.VerifyAccessKey(bytes.NewReader(stripped), keyring.StaticKey(bytes.Clone(accessKey))); !errors.Is(err, keyring.ErrTampered) {
+		t.Errorf("VerifyAccessKey stripped: got %v, want %v", err, keyring.ErrTampered)
+	}
+}
+
+func TestContext(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("apple"),
+		AccessKey:  accessKey,
+		Context:    []byte("tenant-1"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	read := func(ctx string) (*keyring.Ring, error) {
+		return keyring.ReadWith(bytes.NewReader(data), keyring.StaticKey(bytes.Clone(accessKey)),
+			&keyring.ReadOptions{Context: []byte(ctx)})
+	}
+
+	// A missing or different context does not decrypt.
+	for _, ctx := range []string{"", "tenant-2"} {
+		if _, err := read(ctx); !errors.Is(err, keyring.ErrBadAccessKey) {
+			t.Errorf("Read(%q): got %v, want %v", ctx, err, keyring.ErrBadAccessKey)
+		}
+		err := keyring.VerifyAccessKeyWith(bytes.NewReader(data), keyring.StaticKey(bytes.Clone(accessKey)),
+			&keyring.ReadOptions{Context: []byte(ctx)})
+		if !errors.Is(err, keyring.ErrBadAccessKey) {
+			t.Errorf("VerifyAccessKeyWith(%q): got %v, want %v", ctx, err, keyring.ErrBadAccessKey)
+		}
+	}
+
+	// The matching context decrypts, and the ring stays bound to it after
+	// changing the access key.
+	r2, err := read("tenant-1")
+	if err != nil {
+		t.Fatalf("Read: unexpected error: %v", err)
+	}
+	checkHasKeys(t, r2, 1)
+
+	accessKey = randomBytes(keyring.AccessKeyLen)
+	if err := r2.Rekey(bytes.Clone(accessKey), nil); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	data, err = r2.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if _, err := read(""); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("Read after Rekey: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+	if _, err := read("tenant-1"); err != nil {
+		t.Errorf("Read after Rekey: unexpected error: %v", err)
+	}
+}
+
+func TestShares(t *testing.T) {
+	t.Run("SplitCombine", func(t *testing.T) {
+		secret := []byte("a secret of no particular length")
+		shares, err := keyring.SplitShares(secret, 3, 5)
+		if err != nil {
+			t.Fatalf("SplitShares failed: %v", err)
+		}
+		if len(shares) != 5 {
+			t.Fatalf("Got %d shares, want 5", len(shares))
+		}
+		for _, pick := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+			var sub [][]byte
+			for _, i := range pick {
+				sub = append(sub, shares[i])
+			}
+			got, err := keyring.CombineShares(sub)
+			if err != nil {
+				t.Errorf("CombineShares %v: unexpected error: %v", pick, err)
+			} else if !bytes.Equal(got, secret) {
+				t.Errorf("CombineShares %v: got %q, want %q", pick, got, secret)
+			}
+		}
+
+		// Too few shares do not reconstruct the secret.
+		if got, err := keyring.CombineShares(shares[:2]); err != nil {
+			t.Errorf("CombineShares: unexpected error: %v", err)
+		} else if bytes.Equal(got, secret) {
+			t.Error("CombineShares: two shares reconstructed the secret")
+		}
+
+		// Repeated shares are rejected.
+		if _, err := keyring.CombineShares([][]byte{shares[0], shares[1], shares[0]}); err == nil {
+			t.Error("CombineShares: got nil error for repeated share")
+		}
+	})
+
+	t.Run("BadParams", func(t *testing.T) {
+		for _, p := range [][2]int{{1, 3}, {4, 3}, {2, 256}} {
+			if _, err := keyring.SplitShares([]byte("x"), p[0], p[1]); err == nil {
+				t.Errorf("SplitShares(%d of %d): got nil error", p[0], p[1])
+			}
+		}
+	})
+
+	t.Run("Ring", func(t *testing.T) {
+		r, shares, err := keyring.NewShared(keyring.Config{InitialKey: []byte("apple")}, 2, 3)
+		if err != nil {
+			t.Fatalf("NewShared failed: %v", err)
+		}
+		data, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+
+		info, err := keyring.Inspect(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Inspect failed: %v", err)
+		}
+		if want := (keyring.ThresholdParams{K: 2, N: 3}); info.Threshold == nil || *info.Threshold != want {
+			t.Errorf("Inspect: got threshold %+v, want %+v", info.Threshold, want)
+		}
+
+		r2, err := keyring.Read(bytes.NewReader(data), keyring.ThresholdKey(shares[2], shares[0]))
+		if err != nil {
+			t.Fatalf("Read with shares failed: %v", err)
+		}
+		checkHasKeys(t, r2, 1)
+
+		if _, err := keyring.Read(bytes.NewReader(data), keyring.ThresholdKey(shares[1])); !errors.Is(err, keyring.ErrBadAccessKey) {
+			t.Errorf("Read with one share: got %v, want %v", err, keyring.ErrBadAccessKey)
+		}
+		if _, _, err := keyring.NewShared(keyring.Config{
+			InitialKey: []byte("apple"),
+			AccessKey:  randomBytes(keyring.AccessKeyLen),
+		}, 2, 3); err == nil {
+			t.Error("NewShared with an access key: got nil error")
+		}
+	})
+}
+
+func TestAccessKeys(t *testing.T) {
+	keyA := randomBytes(keyring.AccessKeyLen)
+	keyB := randomBytes(keyring.AccessKeyLen)
+	keyFor := func(key []byte) keyring.AccessKeyFunc { return keyring.StaticKey(bytes.Clone(key)) }
+
+	r, err := keyring.New(keyring.Config{
+		InitialKey:    []byte("apple"),
+		AccessKey:     keyA,
+		AccessKeySalt: []byte("salt A"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := r.AddAccessKey(keyFor(keyB)); err != nil {
+		t.Fatalf("AddAccessKey failed: %v", err)
+	}
+	if n := r.NumAccessKeys(); n != 2 {
+		t.Errorf("NumAccessKeys: got %d, want 2", n)
+	}
+	if got := r.AccessKeyIndex(); got != -1 {
+		t.Errorf("AccessKeyIndex of a new ring: got %d, want -1", got)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	// Either access key opens the ring, and a different key does not.
+	for i, key := range [][]byte{keyA, keyB} {
+		r2, err := keyring.Read(bytes.NewReader(data), keyFor(key))
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		checkHasKeys(t, r2, 1)
+		if n := r2.NumAccessKeys(); n != 2 {
+			t.Errorf("NumAccessKeys after Read: got %d, want 2", n)
+		}
+		if got := r2.AccessKeyIndex(); got != i {
+			t.Errorf("AccessKeyIndex after Read: got %d, want %d", got, i)
+		}
+		if err := keyring.VerifyAccessKey(bytes.NewReader(data), keyFor(key)); err != nil {
+			t.Errorf("VerifyAccessKey: unexpected error: %v", err)
+		}
+	}
+	wrongKey := randomBytes(keyring.AccessKeyLen)
+	if _, err := keyring.Read(bytes.NewReader(data), keyFor(wrongKey)); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("Read: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+
+	// Removing the first access key leaves only the second.
+	if err := r.RemoveAccessKey(2); err == nil {
+		t.Error("RemoveAccessKey(2): got nil error")
+	}
+	if err := r.RemoveAccessKey(0); err != nil {
+		t.Fatalf("RemoveAccessKey(0) failed: %v", err)
+	}
+	if err := r.RemoveAccessKey(0); err == nil {
+		t.Error("RemoveAccessKey of the only key: got nil error")
+	}
+	data, err = r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if _, err := keyring.Read(bytes.NewReader(data), keyFor(keyA)); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("Read with removed key: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+	if _, err := keyring.Read(bytes.NewReader(data), keyFor(keyB)); err != nil {
+		t.Errorf("Read with remaining key: unexpected error: %v", err)
+	}
+
+	// Rekey removes the additional access keys.
+	if err := r.AddAccessKey(keyFor(keyA)); err != nil {
+		t.Fatalf("AddAccessKey failed: %v", err)
+	}
+	if err := r.Rekey(bytes.Clone(keyB), nil); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if n := r.NumAccessKeys(); n != 1 {
+		t.Errorf("NumAccessKeys after Rekey: got %d, want 1", n)
+	}
+}
+
+// testWrapper is a [keyring.KeyWrapper] that wraps keys with AES-GCM, for
+// testing. A real implementation would keep its key in an HSM.
+type testWrapper struct {
+	label string
+	key   []byte
+	err   error // if set, report this error from UnwrapKey
+}
+
+func (w testWrapper) Label() string { return w.label }
+
+func (w testWrapper) aead() stdcipher.AEAD {
+	block, err := aes.NewCipher(w.key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := stdcipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+func (w testWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	aead := w.aead()
+	nonce := randomBytes(aead.NonceSize())
+	return aead.Seal(nonce, nonce, dataKey, []byte(w.label)), nil
+}
+
+func (w testWrapper) UnwrapKey(label string, wrapped []byte) ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	aead := w.aead()
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, wrapped[:n], wrapped[n:], []byte(label))
+}
+
+func TestWrappedKeys(t *testing.T) {
+	hsm := testWrapper{label: "hsm-key-1", key: randomBytes(32)}
+
+	t.Run("NewWrapped", func(t *testing.T) {
+		r, err := keyring.NewWrapped(keyring.Config{InitialKey: []byte("apple")}, hsm)
+		if err != nil {
+			t.Fatalf("NewWrapped failed: %v", err)
+		}
+		if got := r.WrappedKeyLabels(); !slices.Equal(got, []string{hsm.label}) {
+			t.Errorf("WrappedKeyLabels: got %q, want [%q]", got, hsm.label)
+		}
+		data, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+
+		r2, err := keyring.ReadWrapped(bytes.NewReader(data), hsm)
+		if err != nil {
+			t.Fatalf("ReadWrapped failed: %v", err)
+		}
+		checkHasKeys(t, r2, 1)
+		if got := r2.WrappedKeyLabels(); !slices.Equal(got, []string{hsm.label}) {
+			t.Errorf("WrappedKeyLabels after read: got %q, want [%q]", got, hsm.label)
+		}
+		if info, err := keyring.Inspect(bytes.NewReader(data)); err != nil {
+			t.Errorf("Inspect failed: %v", err)
+		} else if !slices.Equal(info.WrappedKeyLabels, []string{hsm.label}) {
+			t.Errorf("Inspect labels: got %q, want [%q]", info.WrappedKeyLabels, hsm.label)
+		}
+
+		// A wrapper whose label does not match is rejected without calling it.
+		other := testWrapper{label: "hsm-key-2", key: hsm.key, err: errors.New("unexpected call")}
+		if _, err := keyring.ReadWrapped(bytes.NewReader(data), other); !errors.Is(err, keyring.ErrBadAccessKey) {
+			t.Errorf("ReadWrapped(other): got %v, want %v", err, keyring.ErrBadAccessKey)
+		}
+
+		// An error from the wrapper is reported to the caller.
+		failErr := errors.New("token not present")
+		failing := testWrapper{label: hsm.label, key: hsm.key, err: failErr}
+		if _, err := keyring.ReadWrapped(bytes.NewReader(data), failing); !errors.Is(err, failErr) {
+			t.Errorf("ReadWrapped(failing): got %v, want %v", err, failErr)
+		}
+
+		// The wrong wrapping key does not unwrap the data key.
+		wrong := testWrapper{label: hsm.label, key: randomBytes(32)}
+		if _, err := keyring.ReadWrapped(bytes.NewReader(data), wrong); err == nil {
+			t.Error("ReadWrapped(wrong): got nil error")
+		}
+
+		// The random access key is not retained.
+		if _, err := keyring.Read(bytes.NewReader(data), keyring.StaticKey(randomBytes(keyring.AccessKeyLen))); !errors.Is(err, keyring.ErrBadAccessKey) {
+			t.Errorf("Read: got %v, want %v", err, keyring.ErrBadAccessKey)
+		}
+
+		if _, err := keyring.NewWrapped(keyring.Config{
+			InitialKey: []byte("apple"),
+			AccessKey:  randomBytes(keyring.AccessKeyLen),
+		}, hsm); err == nil {
+			t.Error("NewWrapped with an access key: got nil error")
+		}
+	})
+
+	t.Run("AddWrappedKey", func(t *testing.T) {
+		accessKey := randomBytes(keyring.AccessKeyLen)
+		r, err := keyring.New(keyring.Config{InitialKey: []byte("pear"), AccessKey: accessKey})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if err := r.AddWrappedKey(hsm); err != nil {
+			t.Fatalf("AddWrappedKey failed: %v", err)
+		}
+		if err := r.AddWrappedKey(hsm); err == nil {
+			t.Error("AddWrappedKey with a duplicate label: got nil error")
+		}
+		if err := r.AddWrappedKey(testWrapper{key: hsm.key}); err == nil {
+			t.Error("AddWrappedKey with an empty label: got nil error")
+		}
+		data, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+
+		// Both the access key and the wrapper open the ring.
+		r2, err := keyring.Read(bytes.NewReader(data), keyring.StaticKey(bytes.Clone(accessKey)))
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if _, err := keyring.ReadWrapped(bytes.NewReader(data), hsm); err != nil {
+			t.Fatalf("ReadWrapped failed: %v", err)
+		}
+
+		// The wrapped key survives a round trip, and Rekey removes it.
+		if got := r2.WrappedKeyLabels(); !slices.Equal(got, []string{hsm.label}) {
+			t.Errorf("WrappedKeyLabels: got %q, want [%q]", got, hsm.label)
+		}
+		if err := r2.Rekey(bytes.Clone(accessKey), nil); err != nil {
+			t.Fatalf("Rekey failed: %v", err)
+		}
+		if got := r2.WrappedKeyLabels(); len(got) != 0 {
+			t.Errorf("WrappedKeyLabels after Rekey: got %q, want none", got)
+		}
+		data, err = r2.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		if _, err := keyring.ReadWrapped(bytes.NewReader(data), hsm); !errors.Is(err, keyring.ErrBadAccessKey) {
+			t.Errorf("ReadWrapped after Rekey: got %v, want %v", err, keyring.ErrBadAccessKey)
+		}
+	})
+}
+
+func TestCopyActive(t *testing.T) {
+	r, err := keyring.New(keyring.Config{
+		InitialKey: []byte("apple"),
+		AccessKey:  randomBytes(keyring.AccessKeyLen),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	buf := make([]byte, 8)
+	id, n, err := r.CopyActive(buf)
+	if err != nil {
+		t.Fatalf("CopyActive failed: %v", err)
+	}
+	if id != 1 || string(buf[:n]) != "apple" {
+		t.Errorf("CopyActive: got %v, %q; want 1, %q", id, buf[:n], "apple")
+	}
+
+	// A buffer that is too short is not modified.
+	short := []byte("xyz")
+	if _, _, err := r.CopyActive(short); !errors.Is(err, io.ErrShortBuffer) {
+		t.Errorf("CopyActive: got %v, want %v", err, io.ErrShortBuffer)
+	}
+	if string(short) != "xyz" {
+		t.Errorf("CopyActive modified short buffer: %q", short)
+	}
+
+	r.Deactivate()
+	if _, _, err := r.CopyActive(buf); err == nil {
+		t.Error("CopyActive with no active key: got nil error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{InitialKey: []byte("apple"), AccessKey: accessKey})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Add([]byte("pear"))
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	if err := keyring.Validate(bytes.NewReader(data), keyring.StaticKey(accessKey)); err != nil {
+		t.Errorf("Validate: unexpected error: %v", err)
+	}
+	wrongKey := keyring.StaticKey(randomBytes(keyring.AccessKeyLen))
+	if err := keyring.Validate(bytes.NewReader(data), wrongKey); !errors.Is(err, keyring.ErrBadAccessKey) {
+		t.Errorf("Validate: got %v, want %v", err, keyring.ErrBadAccessKey)
+	}
+	if err := keyring.Validate(bytes.NewReader(data[:len(data)-1]), keyring.StaticKey(accessKey)); !errors.Is(err, keyring.ErrCorruptKeyring) {
+		t.Errorf("Validate truncated: got %v, want %v", err, keyring.ErrCorruptKeyring)
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	accessKey := randomBytes(keyring.AccessKeyLen)
+	r, err := keyring.New(keyring.Config{InitialKey: []byte("apple"), AccessKey: accessKey})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if v := r.FormatVersion(); v != keyring.CurrentFormat {
+		t.Errorf("FormatVersion: got %d, want %d", v, keyring.CurrentFormat)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	info, err := keyring.Inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if v := int(info.FormatVersion); v != keyring.CurrentFormat {
+		t.Errorf("Stored format version: got %d, want %d", v, keyring.CurrentFormat)
+	}
+	r2, err := keyring.Read(bytes.NewReader(data), keyring.StaticKey(accessKey))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if v := r2.FormatVersion(); v != keyring.CurrentFormat {
+		t.Errorf("FormatVersion after Read: got %d, want %d", v, keyring.CurrentFormat)
+	}
+
+	t.Run("Legacy", func(t *testing.T) {
+		if _, err := keyring.Read(bytes.NewReader(legacyRing(t)), keyring.StaticKey(legacyAccessKey)); !errors.Is(err, keyring.ErrLegacyFormat) {
+			t.Errorf("Read legacy: got %v, want %v", err, keyring.ErrLegacyFormat)
+		}
+		old, err := keyring.ReadWith(bytes.NewReader(legacyRing(t)), keyring.StaticKey(legacyAccessKey),
+			&keyring.ReadOptions{AllowMissingMAC: true})
+		if err != nil {
+			t.Fatalf("Read legacy failed: %v", err)
+		}
+		if v := old.FormatVersion(); v != 1 {
+			t.Errorf("FormatVersion: got %d, want 1", v)
+		}
+		checkHasKeys(t, old, 1, 2)
+
+		// Writing the ring back upgrades it to the current format.
+		data, err := old.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		if v := int(data[1]); v != keyring.CurrentFormat {
+			t.Errorf("Stored format version: got %d, want %d", v, keyring.CurrentFormat)
+		}
+		up, err := keyring.Read(bytes.NewReader(data), keyring.StaticKey(legacyAccessKey))
+		if err != nil {
+			t.Fatalf("Read upgraded failed: %v", err)
+		}
+		if v := up.FormatVersion(); v != keyring.CurrentFormat {
+			t.Errorf("FormatVersion after upgrade: got %d, want %d", v, keyring.CurrentFormat)
+		}
+		checkHasKeys(t, up, 1, 2)
+	})
+}
+
+// legacyAccessKey is the access key of the keyring returned by legacyRing.
+var legacyAccessKey = bytes.Repeat([]byte("legacy!!"), 4)
+
+// legacyRing returns a keyring in format version 1, as written before the
+// header MAC and generation counter were added. It holds key 1 ("apple") and
+// the active key 2 ("banana"), and opens with legacyAccessKey.
+func legacyRing(t *testing.T) []byte {
+	t.Helper()
+	const legacyHex = "ec0100000200004872cb66ae0f3392d954fb601a3043162c9bd919802bfb08" +
+		"4fa43ea19469bb4a1b4c277bb77723e41196b8a4bd931d8d1286b76f139660ad" +
+		"781958153364b434e823f564e919f9163d0300000b6c65676163792073616c74" +
+		"0600004b876b45d1dddbd0d07b6674545845f2080f135dd87c555f1c29ca5c5c" +
+		"63e2cb7572e7eb2659093825089e5ab4f580aaa3c67358debba93c0072913267" +
+		"defb21bd573cc5994f1ee53e3f59de"
+	data, err := hex.DecodeString(legacyHex)
+	if err != nil {
+		t.Fatalf("Decode legacy keyring: %v", err)
+	}
+	return data
+}
+
+func TestNewFromView(t *testing.T) {
+	v, err := keyring.ImportJSON([]byte(`{"active":3,"keys":[
+{"id":3,"key_base64":"YXBwbGU=","label":"fruit"},
+{"id":7,"key_base64":"cGVhcg=="}]}`))
+	if err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+	for _, inMemory := range []bool{false, true} {
+		accessKey := randomBytes(keyring.AccessKeyLen)
+		r, err := keyring.NewFromView(keyring.Config{
+			AccessKey:       accessKey,
+			EncryptInMemory: inMemory,
+		}, v)
+		if err != nil {
+			t.Fatalf("NewFromView failed: %v", err)
+		}
+		checkHasKeys(t, r, 3, 7)
+		if got := r.Active(); got != 3 {
+			t.Errorf("Active: got %v, want 3", got)
+		}
+		if got := r.Label(3); got != "fruit" {
+			t.Errorf("Label(3): got %q, want fruit", got)
+		}
+
+		// The next key added gets a new ID, and the keys survive a round trip.
+		if id := r.Add([]byte("plum")); id != 8 {
+			t.Errorf("Add: got ID %v, want 8", id)
+		}
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		r2, err := keyring.Read(&buf, keyring.StaticKey(accessKey))
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		checkHasKeys(t, r2, 3, 7, 8)
+		if got := string(r2.Get(7, nil)); got != "pear" {
+			t.Errorf("Get(7): got %q, want pear", got)
+		}
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		accessKey := randomBytes(keyring.AccessKeyLen)
+		for _, c := range []keyring.Config{
+			{AccessKey: accessKey, InitialKey: []byte("x")},
+			{AccessKey: accessKey, MaxKeys: 1},
+			{AccessKey: accessKey, DeterministicIDs: true},
+		} {
+			if r, err := keyring.NewFromView(c, v); err == nil {
+				t.Errorf("NewFromView(%+v): got %v, want error", c, r)
+			}
+		}
+		empty, err := keyring.ImportJSON([]byte(`{"keys":[]}`))
+		if err != nil {
+			t.Fatalf("ImportJSON failed: %v", err)
+		}
+		if r, err := keyring.NewFromView(keyring.Config{AccessKey: accessKey}, empty); !errors.Is(err, keyring.ErrEmptyKey) {
+			t.Errorf("NewFromView(empty): got %v, %v; want %v", r, err, keyring.ErrEmptyKey)
+		}
+	})
+}
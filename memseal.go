@@ -0,0 +1,77 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"sync"
+
+	"github.com/creachadair/keyring/internal/cipher"
+	"github.com/creachadair/keyring/internal/packet"
+)
+
+// memKey returns the process-ephemeral key used to seal keys in memory for a
+// ring with in-memory encryption enabled. The key is generated on first use
+// and is never stored; a best effort is made to lock it into memory so that it
+// is not written to swap.
+var memKey = sync.OnceValue(func() []byte {
+	key := cipher.GenerateKey(cipher.KeyLen)
+	mlock(key)
+	return key
+})
+
+// memSealOverhead is the number of bytes sealing adds to a key.
+const memSealOverhead = 24 + 16 // XChaCha20 nonce + Poly1305 tag
+
+// sealKey encrypts key under the in-memory key, zeroes key, and returns the
+// sealed result.
+func sealKey(key []byte) []byte {
+	defer clear(key)
+	_, sealed, err := cipher.EncryptWithKey(memKey(), key, nil)
+	if err != nil {
+		panic("keyring: seal key: " + err.Error())
+	}
+	return sealed
+}
+
+// EncryptInMemory enables in-memory encryption of the keys stored in r.
+// It has no effect if in-memory encryption is already enabled for r.
+// See [Config.EncryptInMemory].
+//
+// This is useful for a ring obtained from [Read], since the encoding of a
+// ring does not record whether in-memory encryption was enabled.
+func (r *Ring) EncryptInMemory() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	if r.view.sealed {
+		return
+	}
+	for id, ki := range r.view.keys {
+		ki.Key = sealKey(ki.Key)
+		r.view.keys[id] = ki
+	}
+	r.view.sealed = true
+}
+
+// keyLen reports the length in bytes of the plaintext of ki.
+func (v *View) keyLen(ki packet.KeyInfo) int {
+	if v.sealed {
+		return len(ki.Key) - memSealOverhead
+	}
+	return len(ki.Key)
+}
+
+// appendKey appends the plaintext of ki to buf, and returns the resulting
+// slice. If v is sealed, the key is decrypted and the temporary plaintext is
+// zeroed before returning.
+func (v *View) appendKey(buf []byte, ki packet.KeyInfo) []byte {
+	if !v.sealed {
+		return append(buf, ki.Key...)
+	}
+	pt, err := cipher.DecryptWithKey(memKey(), ki.Key, nil)
+	if err != nil {
+		panic("keyring: unseal key: " + err.Error())
+	}
+	defer clear(pt)
+	return append(buf, pt...)
+}
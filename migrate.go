@@ -0,0 +1,62 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/creachadair/keyring/internal/packet"
+)
+
+// Migrate reads a stored keyring from r in any layout this package supports,
+// and reports whether it is in the current layout. If not, Migrate writes an
+// equivalent keyring in the current layout to w, and reports true. If the
+// keyring is already current, Migrate writes nothing to w and reports false.
+// In either case, the access key is checked and the keyring is decrypted, so
+// an error means that the input could not be read.
+//
+// A keyring needs migration if it uses an older format version, if it stores
+// its entries at the top level rather than in an encrypted bundle (see
+// [ReadOptions.AllowUnbundled]), if it has no header MAC (see
+// [ReadOptions.AllowMissingMAC]), or if its entries are spread over more than
+// one bundle. Migrate trusts the contents of a legacy keyring, since they are
+// not authenticated; use it only for keyrings from a trusted source.
+func Migrate(r io.Reader, w io.Writer, accessKey AccessKeySource) (migrated bool, err error) {
+	data, err := readAllContext(context.Background(), r, DefaultMaxSize)
+	if err != nil {
+		return false, err
+	}
+	ring, err := ReadWith(bytes.NewReader(data), accessKey, &ReadOptions{AllowUnbundled: true, AllowMissingMAC: true})
+	if err != nil {
+		return false, err
+	}
+	defer ring.Close()
+
+	rk, err := packet.ParseKeyring(data)
+	if err != nil {
+		return false, fmt.Errorf("keyring: parse keyring: %w", err) // not reached if Read succeeded
+	}
+	migrated = rk.Version != CurrentFormat
+	var bundles int
+	var hasMAC bool
+	for _, p := range rk.Packets {
+		switch p.Type {
+		case packet.KeyringEntryType, packet.ActiveKeyType, packet.MaxIDType:
+			migrated = true
+		case packet.HeaderMACType:
+			hasMAC = true
+		case packet.BundleType:
+			bundles++
+		}
+	}
+	if !migrated && hasMAC && bundles <= 1 {
+		return false, nil
+	}
+	if _, err := ring.WriteTo(w); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,8 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+//go:build !(linux || darwin)
+
+package keyring
+
+// mlock is a no-op on platforms without memory locking support.
+func mlock([]byte) {}
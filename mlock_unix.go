@@ -0,0 +1,10 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+//go:build linux || darwin
+
+package keyring
+
+import "golang.org/x/sys/unix"
+
+// mlock makes a best effort to prevent the pages holding b from being swapped.
+func mlock(b []byte) { unix.Mlock(b) }
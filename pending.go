@@ -0,0 +1,85 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// NewPending returns an empty [Ring] that awaits its contents from a call to
+// its ReadFrom method, which decodes a stored keyring using accessKey as
+// [Read] does. This allows a ring to be populated through the
+// [io.ReaderFrom] interface. It will panic if accessKey == nil.
+//
+// Until ReadFrom succeeds, calling any other method of the ring except Close
+// will panic.
+func NewPending(accessKey AccessKeyFunc) *Ring {
+	if accessKey == nil {
+		panic("keyring: nil access key function")
+	}
+	return &Ring{pending: accessKey}
+}
+
+// ReadFrom reads and decrypts the binary representation of a keyring from src,
+// as [Read] does, and replaces the contents of r with the result. It satisfies
+// the [io.ReaderFrom] interface, and reports the number of bytes read from
+// src. Once ReadFrom succeeds, r is ready for use.
+//
+// The ring must have been created by [NewPending], and not yet successfully
+// read; otherwise ReadFrom reports an error. If reading fails, r remains
+// pending and ReadFrom may be called again.
+func (r *Ring) ReadFrom(src io.Reader) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		panic("keyring: keyring is closed")
+	} else if r.pending == nil {
+		return 0, errors.New("keyring: ReadFrom requires a ring from NewPending")
+	}
+	cr := &countReader{r: src}
+	nr, err := readWith(context.Background(), cr, r.pending, nil)
+	if err != nil {
+		return cr.n, err
+	}
+
+	// Take ownership of the contents of nr. Its cleanups refer to storage that
+	// now belongs to r, so replace them with cleanups for r.
+	for _, c := range nr.cleanups {
+		c.Stop()
+	}
+	r.formatVersion = nr.formatVersion
+	r.reserved = nr.reserved
+	r.accessKeySalt = nr.accessKeySalt
+	r.argon2Params = nr.argon2Params
+	r.scryptParams = nr.scryptParams
+	r.threshold = nr.threshold
+	r.dkEncrypted = nr.dkEncrypted
+	r.dkPlaintext = nr.dkPlaintext
+	r.moreSlots = nr.moreSlots
+	r.wrapped = nr.wrapped
+	r.unknown = nr.unknown
+	r.dkContext = nr.dkContext
+	r.generation = nr.generation
+	r.view = nr.view
+	r.maxID = nr.maxID
+	r.maxKeys = nr.maxKeys
+	r.streaming = nr.streaming
+	r.openSlot = nr.openSlot
+	r.pending = nil
+	addCleanup(r)
+	return cr.n, nil
+}
+
+// countReader is an [io.Reader] that counts the bytes read from r.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(data []byte) (int, error) {
+	nr, err := c.r.Read(data)
+	c.n += int64(nr)
+	return nr, err
+}
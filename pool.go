@@ -0,0 +1,47 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"sync"
+
+	"github.com/creachadair/keyring/internal/packet"
+)
+
+var ringPool = sync.Pool{New: func() any { return new(Ring) }}
+
+// AcquireRing returns an empty [Ring] from a shared pool. Unlike the rings
+// returned by [New] and [Read], a pooled ring does not register a cleanup to
+// zero its key material when it is reclaimed by the GC. The caller must call
+// [Ring.ReleaseToPool] when the ring is no longer needed.
+//
+// The returned ring has no keys, no active key, and no access key. Use
+// [Ring.Add] and [Ring.Activate] to populate it, and [Ring.Rekey] to set an
+// access key before writing it to storage.
+func AcquireRing() *Ring {
+	r := ringPool.Get().(*Ring)
+	r.formatVersion = CurrentFormat
+	if r.view.keys == nil {
+		r.view.keys = make(map[ID]packet.KeyInfo)
+	}
+	return r
+}
+
+// ReleaseToPool zeroes all the unencrypted key material in r, including the
+// contents of every stored key and the data storage key, and returns r to the
+// pool used by [AcquireRing]. The caller must not use r after calling
+// ReleaseToPool. Views previously obtained from r are not affected.
+func (r *Ring) ReleaseToPool() {
+	r.mu.Lock()
+	// The cleanups registered by New, Read, or Clone refer to the keys map,
+	// which the pool reuses, so stop them before r is recycled.
+	for _, c := range r.cleanups {
+		c.Stop()
+	}
+	r.wipe()
+	keys := r.view.keys
+
+	// This also resets r.mu, releasing the lock.
+	*r = Ring{view: View{keys: keys}}
+	ringPool.Put(r)
+}
@@ -0,0 +1,65 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/creachadair/keyring/internal/cipher"
+)
+
+// RewrapForRecipient reads the binary representation of a keyring from src,
+// decrypts it using the plaintext dataKey, and writes to dst an equivalent
+// keyring whose data key is encrypted with newAccessKey instead of the access
+// key of the original. If newSalt is non-empty, it is stored as the access key
+// generation salt of the new keyring, replacing any salt in the original.
+// The keys stored in the keyring and the data key itself are unchanged. Any
+// Argon2id, scrypt, or threshold parameters stored with the original are not
+// copied, since they describe the derivation of the original access key, nor
+// are its additional access keys or wrapped data keys. If
+// the original was bound to a context (see [Config.Context]), the new keyring
+// is not.
+//
+// This allows a party who holds the data key, but not the original access
+// key, to give a copy of the keyring to a new recipient. The newAccessKey
+// must be exactly [AccessKeyLen] bytes.
+//
+// This package does not export the data key of a [Ring]; the caller must
+// obtain it separately, for example from an escrow maintained when the
+// keyring was created. Note that anyone who holds the data key can read (and
+// rewrap) every copy of a keyring that shares it, regardless of access key.
+// Use [Ring.Rekey] to give a keyring a fresh data key.
+func RewrapForRecipient(src io.Reader, dataKey, newAccessKey, newSalt []byte, dst io.Writer) error {
+	if len(newAccessKey) != AccessKeyLen {
+		return fmt.Errorf("keyring: access key is %d bytes, want %d", len(newAccessKey), AccessKeyLen)
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	r, err := readRing(data, nil, func(cipher.Suite, []accessSlot, []wrappedSlot) ([]byte, error) {
+		if len(dataKey) != cipher.KeyLen {
+			return nil, fmt.Errorf("keyring: data key is %d bytes, want %d", len(dataKey), cipher.KeyLen)
+		}
+		return bytes.Clone(dataKey), nil
+	})
+	if err != nil {
+		return err
+	}
+	defer r.wipe()
+
+	_, ekey, err := r.suite().EncryptWithKey(newAccessKey, r.dkPlaintext, nil)
+	if err != nil {
+		return fmt.Errorf("encrypt key: %w", err)
+	}
+	r.dkEncrypted = ekey
+	r.moreSlots, r.wrapped = nil, nil
+	r.argon2Params, r.scryptParams, r.threshold = nil, nil, nil
+	if len(newSalt) != 0 {
+		r.accessKeySalt = bytes.Clone(newSalt)
+	}
+	_, err = r.WriteTo(dst)
+	return err
+}
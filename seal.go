@@ -0,0 +1,84 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/creachadair/keyring/internal/cipher"
+)
+
+// SealWithActive encrypts and authenticates plaintext and aad with the active
+// key of v, and returns the active ID and the resulting ciphertext. The key
+// bytes are not exposed to the caller. The ciphertext can be decrypted with
+// [View.OpenWithActive] using the returned ID. It reports an error if v has no
+// active key, or if the active key is not exactly 32 bytes.
+//
+// The encryption uses XChaCha20-Poly1305 with a random nonce, which is stored
+// at the beginning of the ciphertext.
+func (v *View) SealWithActive(plaintext, aad []byte) (ID, []byte, error) {
+	if v.activeKey == 0 {
+		return 0, nil, errors.New("keyring: keyring has no active key")
+	}
+	ki := v.keys[v.activeKey]
+	key, err := v.aeadKey(ki.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer clear(key)
+	_, ctext, err := cipher.EncryptWithKey(key, plaintext, aad)
+	if err != nil {
+		return 0, nil, fmt.Errorf("keyring: seal: %w", err)
+	}
+	return ki.ID, ctext, nil
+}
+
+// OpenWithActive decrypts and authenticates a ciphertext produced by
+// [View.SealWithActive] using the key with the specified ID, which need not be
+// the current active key, and returns the plaintext. It reports an error if
+// id does not exist in v or the key is not exactly 32 bytes. If the ciphertext
+// or aad do not authenticate, the error wraps [ErrDecryptFailed].
+func (v *View) OpenWithActive(id ID, ciphertext, aad []byte) ([]byte, error) {
+	key, err := v.aeadKey(id)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	ptext, err := cipher.DecryptWithKey(key, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+	return ptext, nil
+}
+
+// aeadKey returns a copy of the specified key for use with the cipher, or an
+// error if it does not exist or is the wrong length. The caller is
+// responsible for zeroing the result.
+func (v *View) aeadKey(id ID) ([]byte, error) {
+	ki, ok := v.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownKey, id)
+	} else if n := v.keyLen(ki); n != cipher.KeyLen {
+		return nil, fmt.Errorf("keyring: key %v is %d bytes, want %d", id, n, cipher.KeyLen)
+	}
+	return v.appendKey(nil, ki), nil
+}
+
+// SealWithActive encrypts and authenticates plaintext and aad with the active
+// key of r, and returns the active ID and the resulting ciphertext.
+// See [View.SealWithActive].
+func (r *Ring) SealWithActive(plaintext, aad []byte) (ID, []byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().SealWithActive(plaintext, aad)
+}
+
+// OpenWithActive decrypts and authenticates a ciphertext produced by
+// [Ring.SealWithActive] using the key with the specified ID.
+// See [View.OpenWithActive].
+func (r *Ring) OpenWithActive(id ID, ciphertext, aad []byte) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().OpenWithActive(id, ciphertext, aad)
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/creachadair/keyring/internal/cipher"
+)
+
+// shareVersion is the format version byte of a key share.
+const shareVersion = 1
+
+// shareContext is the extra data authenticated with a key share, to prevent
+// other ciphertexts under the same key from being accepted as a share.
+var shareContext = []byte("keyring key share v1")
+
+// ExportKeyShare encrypts the contents of the specified key with recipientKey,
+// and returns the result as a base64 string suitable for sending to the holder
+// of recipientKey. Use [ImportKeyShare] to recover the key. The recipientKey
+// must be exactly [AccessKeyLen] bytes. The share is authenticated, so that
+// any modification is detected when it is imported.
+//
+// A share contains only the key contents, not its ID or other attributes.
+func (v *View) ExportKeyShare(id ID, recipientKey []byte) (string, error) {
+	if len(recipientKey) != AccessKeyLen {
+		return "", fmt.Errorf("keyring: recipient key is %d bytes, want %d", len(recipientKey), AccessKeyLen)
+	}
+	ki, ok := v.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %v", ErrUnknownKey, id)
+	}
+	key := v.appendKey(nil, ki)
+	defer clear(key)
+	_, data, err := cipher.EncryptWithKey(recipientKey, key, shareContext)
+	if err != nil {
+		return "", fmt.Errorf("keyring: encrypt share: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(append([]byte{shareVersion}, data...)), nil
+}
+
+// ExportKeyShare encrypts the contents of the specified key with recipientKey,
+// and returns the result as a base64 string. See [View.ExportKeyShare].
+func (r *Ring) ExportKeyShare(id ID, recipientKey []byte) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().ExportKeyShare(id, recipientKey)
+}
+
+// ImportKeyShare decrypts a key share produced by [View.ExportKeyShare] with
+// recipientKey, and returns the contents of the key. It reports an error if
+// the share is malformed, if it was modified, or if recipientKey is not the
+// key with which it was exported.
+func ImportKeyShare(s string, recipientKey []byte) ([]byte, error) {
+	if len(recipientKey) != AccessKeyLen {
+		return nil, fmt.Errorf("keyring: recipient key is %d bytes, want %d", len(recipientKey), AccessKeyLen)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: invalid key share: %w", err)
+	} else if len(data) == 0 || data[0] != shareVersion {
+		return nil, errors.New("keyring: invalid key share: unknown version")
+	}
+	key, err := cipher.DecryptWithKey(recipientKey, data[1:], shareContext)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: invalid key share: %w", err)
+	} else if len(key) == 0 {
+		return nil, fmt.Errorf("keyring: invalid key share: %w", ErrEmptyKey)
+	}
+	return key, nil
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/creachadair/keyring/internal/cipher"
+	"github.com/creachadair/keyring/internal/packet"
+	"github.com/creachadair/keyring/internal/shamir"
+)
+
+// ThresholdParams describe how the access key of a keyring is split into
+// shares. Any K of the N shares suffice to reconstruct the access key.
+type ThresholdParams struct {
+	K int // the number of shares needed, 2 ≤ K ≤ N
+	N int // the total number of shares, N ≤ 255
+}
+
+func (p ThresholdParams) check() error {
+	if p.K < 2 || p.K > p.N || p.N > 255 {
+		return fmt.Errorf("keyring: invalid threshold %d of %d", p.K, p.N)
+	}
+	return nil
+}
+
+// parseThreshold parses and checks stored threshold parameters.
+func parseThreshold(data []byte) (*ThresholdParams, error) {
+	k, n, err := packet.ParseThreshold(data)
+	if err != nil {
+		return nil, fmt.Errorf("threshold parameters: %w", err)
+	}
+	p := &ThresholdParams{K: int(k), N: int(n)}
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SplitShares splits secret into n shares using Shamir's secret sharing, so
+// that any k of the shares suffice to reconstruct secret with
+// [CombineShares], but fewer reveal nothing about it. It requires
+// 2 ≤ k ≤ n ≤ 255. Each share is one byte longer than secret.
+func SplitShares(secret []byte, k, n int) ([][]byte, error) {
+	if err := (ThresholdParams{K: k, N: n}).check(); err != nil {
+		return nil, err
+	}
+	shares, err := shamir.Split(secret, k, n, crand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: split: %w", err)
+	}
+	return shares, nil
+}
+
+// CombineShares reconstructs a secret from shares produced by [SplitShares].
+// At least the threshold number of distinct shares must be given; with
+// fewer, the result is not the original secret, and CombineShares cannot
+// detect this. It reports an error if the shares are malformed or
+// inconsistent.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: combine: %w", err)
+	}
+	return secret, nil
+}
+
+// ThresholdKey returns an [AccessKeyFunc] that reconstructs the access key
+// from shares with [CombineShares], ignoring the salt. Use it to read a
+// keyring created by [NewShared]. If too few shares are given, the resulting
+// key does not unlock the keyring, and reading reports [ErrBadAccessKey].
+func ThresholdKey(shares ...[]byte) AccessKeyFunc {
+	return func([]byte) ([]byte, error) { return CombineShares(shares) }
+}
+
+// NewShared constructs a new [Ring] from c, as [New] does, but with a random
+// access key that is split into n shares, any k of which unlock the keyring.
+// It returns the ring and the shares; the access key itself is not retained,
+// and the caller is responsible for distributing the shares to custodians.
+// The threshold parameters (but not the shares) are stored with the keyring
+// and reported by [Inspect]. Use [ThresholdKey] to read it.
+//
+// It reports an error if c sets AccessKey, Argon2Params, or ScryptParams,
+// since the access key is not derived from a passphrase.
+func NewShared(c Config, k, n int) (*Ring, [][]byte, error) {
+	params := ThresholdParams{K: k, N: n}
+	if err := params.check(); err != nil {
+		return nil, nil, err
+	} else if len(c.AccessKey) != 0 {
+		return nil, nil, errors.New("keyring: access key is set for a shared keyring")
+	} else if c.Argon2Params != nil || c.ScryptParams != nil {
+		return nil, nil, errors.New("keyring: key derivation parameters are set for a shared keyring")
+	}
+	akey := cipher.GenerateKey(AccessKeyLen)
+	defer clear(akey)
+	shares, err := SplitShares(akey, k, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.AccessKey = akey
+	r, err := New(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.threshold = &params
+	return r, shares, nil
+}
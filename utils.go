@@ -3,7 +3,20 @@
 package keyring
 
 import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
 	"runtime"
+	"time"
 
 	"github.com/creachadair/keyring/internal/cipher"
 	"github.com/creachadair/keyring/internal/packet"
@@ -12,24 +25,143 @@ import (
 // addCleanup adds cleanup handlers to make a best effort to zero out
 // unencrypted key material in r when r is reclaimed by the GC.
 func addCleanup(r *Ring) *Ring {
-	runtime.AddCleanup(r, func(keys map[ID]packet.KeyInfo) {
-		for _, ki := range keys {
-			clear(ki.Key)
-		}
-	}, r.view.keys)
-	runtime.AddCleanup(r, func(key []byte) { clear(key) }, r.dkPlaintext)
+	r.cleanups = append(r.cleanups,
+		runtime.AddCleanup(r, func(keys map[ID]packet.KeyInfo) {
+			for _, ki := range keys {
+				clear(ki.Key)
+			}
+		}, r.view.keys),
+		runtime.AddCleanup(r, func(key []byte) { clear(key) }, r.dkPlaintext),
+	)
 	return r
 }
 
-func (r *Ring) addBytes(data []byte) ID {
-	r.maxID++
-	r.view.keys[r.maxID] = packet.KeyInfo{
-		ID:  int(r.maxID),
-		Key: data,
+// suite returns the cipher suite recorded in the header of r.
+func (r *Ring) suite() cipher.Suite { return packet.Header{Reserved: r.reserved}.Suite() }
+
+// compressed reports whether r compresses its bundle contents in storage.
+func (r *Ring) compressed() bool { return packet.Header{Reserved: r.reserved}.Compressed() }
+
+// contentIDs reports whether r assigns key IDs from key contents.
+func (r *Ring) contentIDs() bool { return packet.Header{Reserved: r.reserved}.ContentIDs() }
+
+// contentID returns the ID for key in a ring with [Config.DeterministicIDs]:
+// the first 31 bits of the SHA-256 digest of key, or 1 if those are all zero.
+func contentID(key []byte) ID {
+	h := sha256.Sum256(key)
+	return max(ID(binary.BigEndian.Uint32(h[:4])>>1), 1)
+}
+
+// checkOpen panics if r has been closed, or is awaiting ReadFrom.
+func (r *Ring) checkOpen() {
+	if r.closed {
+		panic("keyring: keyring is closed")
+	} else if r.pending != nil {
+		panic("keyring: keyring has not been read")
+	}
+}
+
+// openView returns the view of r. It panics if r has been closed.
+func (r *Ring) openView() *View { r.checkOpen(); return &r.view }
+
+// wipe zeroes all the unencrypted key material held by r, and removes all the
+// keys from r.
+func (r *Ring) wipe() {
+	for _, ki := range r.view.keys {
+		clear(ki.Key)
+	}
+	clear(r.view.keys)
+	clear(r.dkPlaintext)
+}
+
+// checkRoom reports an error wrapping [ErrTooManyKeys] if r holds its maximum
+// number of keys. The caller must hold r.mu.
+func (r *Ring) checkRoom() error {
+	if r.maxKeys > 0 && len(r.view.keys) >= r.maxKeys {
+		return fmt.Errorf("%w: ring has the maximum of %d keys", ErrTooManyKeys, r.maxKeys)
+	}
+	return nil
+}
+
+// addBytes adds data to r as a new key, and returns its ID and true. The
+// caller must hold r.mu exclusively, and must not retain data.
+//
+// If r assigns IDs from key contents and already holds a key with the same
+// contents, addBytes zeroes data and returns the ID of that key and false.
+// If the ID is taken by a different key, it reports an error wrapping
+// [ErrIDCollision]. If r assigns IDs in sequence and has used all of them,
+// addBytes zeroes data and reports an error wrapping [ErrTooManyKeys].
+func (r *Ring) addBytes(data []byte) (ID, bool, error) {
+	r.checkOpen()
+	if !r.contentIDs() && int64(r.maxID) >= 1<<31-1 { // see packet.KeyInfo
+		clear(data)
+		return 0, false, fmt.Errorf("%w: no key IDs remain after %v", ErrTooManyKeys, r.maxID)
+	}
+	id := r.maxID + 1
+	if r.contentIDs() {
+		id = contentID(data)
+		if ki, ok := r.view.keys[id]; ok {
+			old := r.view.appendKey(nil, ki)
+			same := subtle.ConstantTimeCompare(old, data) == 1
+			clear(old)
+			clear(data)
+			if same {
+				return id, false, nil
+			}
+			return 0, false, fmt.Errorf("%w: key %v", ErrIDCollision, id)
+		}
+	}
+	if r.view.sealed {
+		data = sealKey(data)
 	}
-	return r.maxID
+	r.maxID = max(r.maxID, id)
+	r.view.keys[id] = packet.KeyInfo{
+		ID:      id,
+		Key:     data,
+		Created: now(),
+	}
+	return id, true, nil
 }
 
+// readAllContext reads all the contents of r, as [io.ReadAll] does, but
+// returns ctx.Err() without waiting if ctx ends before the read is complete.
+// If maxSize ≥ 0 and r has more than maxSize bytes, it reports [ErrTooLarge].
+func readAllContext(ctx context.Context, r io.Reader, maxSize int) ([]byte, error) {
+	if maxSize >= 0 {
+		r = io.LimitReader(r, int64(maxSize)+1)
+	}
+	readAll := func() ([]byte, error) {
+		data, err := io.ReadAll(r)
+		if err == nil && maxSize >= 0 && len(data) > maxSize {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, maxSize)
+		}
+		return data, err
+	}
+	if ctx.Done() == nil {
+		return readAll() // ctx cannot end; don't bother with a goroutine
+	} else if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		data []byte
+		err  error
+	}
+	ch := make(chan result, 1) // buffered so the reader does not leak if abandoned
+	go func() {
+		data, err := readAll()
+		ch <- result{data, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		return res.data, res.err
+	}
+}
+
+// now returns the current time, truncated to the precision of storage.
+func now() time.Time { return time.Now().Truncate(time.Second) }
+
 // AccessKeyLen is the length in bytes of an access key.
 const AccessKeyLen = cipher.KeyLen // 32 bytes
 
@@ -39,6 +171,17 @@ const AccessKeyLen = cipher.KeyLen // 32 bytes
 // key material returned is ignored.
 type AccessKeyFunc func(salt []byte) ([]byte, error)
 
+// AccessKey calls f with salt, so that an AccessKeyFunc is an
+// [AccessKeySource].
+func (f AccessKeyFunc) AccessKey(salt []byte) ([]byte, error) { return f(salt) }
+
+// An AccessKeySource supplies the access key to open a stored keyring. Its
+// AccessKey method behaves as an [AccessKeyFunc] does. Use [FirstOf] to
+// combine several sources.
+type AccessKeySource interface {
+	AccessKey(salt []byte) ([]byte, error)
+}
+
 // StaticKey returns an access key generation function that ignores the key
 // generation salt and returns the provided key without error.
 func StaticKey(key []byte) AccessKeyFunc { return func([]byte) ([]byte, error) { return key, nil } }
@@ -52,12 +195,289 @@ func PassphraseKey(passphrase string) AccessKeyFunc {
 	}
 }
 
+// EnvKey returns an access key generation function that ignores the salt and
+// returns the access key stored in the named environment variable, encoded
+// in base64 (RFC 4648, standard alphabet with padding). The variable is read
+// each time the function is called. The function reports an error if the
+// variable is unset or empty, or if its value is not a valid encoding of a key
+// of exactly [AccessKeyLen] bytes.
+func EnvKey(varName string) AccessKeyFunc {
+	return func([]byte) ([]byte, error) {
+		val, err := lookupEnv(varName)
+		if err != nil {
+			return nil, err
+		}
+		key, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return nil, fmt.Errorf("environment variable %s: invalid base64: %w", varName, err)
+		} else if len(key) != AccessKeyLen {
+			clear(key)
+			return nil, fmt.Errorf("environment variable %s: key is %d bytes, want %d", varName, len(key), AccessKeyLen)
+		}
+		return key, nil
+	}
+}
+
+// EnvPassphraseKey returns an access key generation function that reads a
+// passphrase from the named environment variable, and derives the access key
+// from it and the salt as [PassphraseKey] does. The variable is read each time
+// the function is called. The function reports an error if the variable is
+// unset or empty.
+func EnvPassphraseKey(varName string) AccessKeyFunc {
+	return func(salt []byte) ([]byte, error) {
+		val, err := lookupEnv(varName)
+		if err != nil {
+			return nil, err
+		}
+		return PassphraseKey(val)(salt)
+	}
+}
+
+// FileKey returns an access key generation function that reads a passphrase
+// from the file at path, and derives the access key from it and the salt as
+// [PassphraseKey] does. The contents of the file are treated as a passphrase,
+// not a raw key, with a single trailing newline (if any) removed. This suits
+// secrets mounted as files, as in Kubernetes. The file is read each time the
+// function is called. The function reports an error if the file cannot be
+// read, or if the passphrase is empty.
+func FileKey(path string) AccessKeyFunc {
+	return func(salt []byte) ([]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(data)
+		pp, ok := bytes.CutSuffix(data, []byte("\n"))
+		if ok {
+			pp = bytes.TrimSuffix(pp, []byte("\r"))
+		}
+		if len(pp) == 0 {
+			return nil, fmt.Errorf("passphrase file %q is empty", path)
+		}
+		return PassphraseKey(string(pp))(salt)
+	}
+}
+
+// FirstOf returns an access key source that tries each of sources in order.
+// When reading a keyring, a source is skipped if it reports an error, if its
+// key is not exactly [AccessKeyLen] bytes long, or if its key does not unlock
+// the keyring. If no source succeeds, reading reports an error combining the
+// errors from all of them. For example, to use an environment variable if it
+// is set, and otherwise a mounted secret file:
+//
+//	keys := keyring.FirstOf(
+//	   keyring.EnvPassphraseKey("KEYRING_PASSPHRASE"),
+//	   keyring.FileKey("/run/secrets/keyring"),
+//	)
+//
+// Calling the AccessKey method of the result directly returns the first key
+// of the right length, since it cannot tell whether that key is correct.
+func FirstOf(sources ...AccessKeySource) AccessKeySource {
+	return keySources(sources)
+}
+
+// keySources is the [AccessKeySource] returned by [FirstOf]. Its sources are
+// tried in turn by [unlockSlots].
+type keySources []AccessKeySource
+
+// AccessKey implements [AccessKeySource].
+func (ks keySources) AccessKey(salt []byte) ([]byte, error) {
+	errs := make([]error, len(ks))
+	for i, src := range ks {
+		key, err := src.AccessKey(salt)
+		if err == nil && len(key) != AccessKeyLen {
+			err = fmt.Errorf("access key is %d bytes, want %d", len(key), AccessKeyLen)
+		}
+		if err == nil {
+			return key, nil
+		}
+		errs[i] = fmt.Errorf("source %d: %w", i+1, err)
+	}
+	return nil, ks.noSources(errs)
+}
+
+// noSources returns an error combining errs, one for each source in ks, or
+// an error reporting that ks is empty.
+func (ks keySources) noSources(errs []error) error {
+	if len(ks) == 0 {
+		return errors.New("no access key sources")
+	}
+	return errors.Join(errs...)
+}
+
+// flatten returns the sources to try for src, in order, expanding the
+// sources combined by [FirstOf].
+func flatten(src AccessKeySource) []AccessKeySource {
+	ks, ok := src.(keySources)
+	if !ok {
+		return []AccessKeySource{src}
+	}
+	var out []AccessKeySource
+	for _, s := range ks {
+		out = append(out, flatten(s)...)
+	}
+	return out
+}
+
+// lookupEnv returns the value of the named environment variable, or an error
+// if it is unset or empty.
+func lookupEnv(varName string) (string, error) {
+	val, ok := os.LookupEnv(varName)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", varName)
+	} else if val == "" {
+		return "", fmt.Errorf("environment variable %s is empty", varName)
+	}
+	return val, nil
+}
+
+// Argon2Params are the tuning parameters for deriving an access key from a
+// passphrase with Argon2id. See [Argon2idKey].
+type Argon2Params struct {
+	Time    uint32 // number of passes over the memory; must be positive
+	Memory  uint32 // memory size in KiB; must be at least 8 * Threads
+	Threads uint8  // degree of parallelism; must be positive
+}
+
+// DefaultArgon2Params are reasonable default parameters for [Argon2idKey]:
+// 3 passes over 64 MiB of memory with 4 threads.
+var DefaultArgon2Params = Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// check reports an error if p does not satisfy the requirements of Argon2id.
+func (p Argon2Params) check() error {
+	if p.Time == 0 || p.Threads == 0 || p.Memory < 8*uint32(p.Threads) {
+		return fmt.Errorf("keyring: invalid argon2id parameters %+v", p)
+	}
+	return nil
+}
+
+// Argon2idKey returns an access key generation function that generates an
+// access key using Argon2id with the given parameters on the provided
+// passphrase and the stored salt. The function reports an error if the
+// parameters are invalid or the salt is empty.
+//
+// To allow a reader to derive the same key, record the parameters with the
+// keyring by setting [Config.Argon2Params] or by using [Ring.RekeyArgon2id].
+// [ReadWithPassphrase] uses the stored parameters to read the keyring.
+func Argon2idKey(passphrase string, params Argon2Params) AccessKeyFunc {
+	return func(salt []byte) ([]byte, error) {
+		if err := params.check(); err != nil {
+			return nil, err
+		} else if len(salt) == 0 {
+			return nil, errors.New("keyring: argon2id requires a salt")
+		}
+		return cipher.KeyFromArgon2id(passphrase, AccessKeyLen, salt, params.Time, params.Memory, params.Threads), nil
+	}
+}
+
+// ScryptParams are the cost parameters for deriving an access key from a
+// passphrase with scrypt. See [ScryptKey].
+type ScryptParams struct {
+	N int // CPU/memory cost; must be a power of two from 2 to 2^31
+	R int // block size; must be positive
+	P int // parallelization; must be positive, with R * P < 2^30
+}
+
+// check reports an error if p is outside the legal range for scrypt.
+func (p ScryptParams) check() error {
+	if p.N <= 1 || int64(p.N) > 1<<31 || p.N&(p.N-1) != 0 {
+		return fmt.Errorf("keyring: scrypt N = %d is not a power of two between 2 and 2^31", p.N)
+	} else if p.R <= 0 || p.P <= 0 {
+		return fmt.Errorf("keyring: scrypt r = %d and p = %d must be positive", p.R, p.P)
+	} else if uint64(p.R)*uint64(p.P) >= 1<<30 {
+		return fmt.Errorf("keyring: scrypt r * p = %d is too large", uint64(p.R)*uint64(p.P))
+	}
+	return nil
+}
+
+// ScryptKey returns an access key generation function that generates an
+// access key using scrypt with cost parameters n, r, and p on the provided
+// passphrase and the stored salt. The function reports an error if the
+// parameters are invalid or the salt is empty.
+//
+// To allow a reader to derive the same key, record the parameters with the
+// keyring by setting [Config.ScryptParams] or by using [Ring.RekeyScrypt].
+// [ReadWithPassphrase] uses the stored parameters to read the keyring.
+func ScryptKey(passphrase string, n, r, p int) AccessKeyFunc {
+	params := ScryptParams{N: n, R: r, P: p}
+	return func(salt []byte) ([]byte, error) {
+		if err := params.check(); err != nil {
+			return nil, err
+		} else if len(salt) == 0 {
+			return nil, errors.New("keyring: scrypt requires a salt")
+		}
+		return cipher.KeyFromScrypt(passphrase, AccessKeyLen, salt, n, r, p)
+	}
+}
+
+// parseScryptParams parses and checks stored scrypt parameters.
+func parseScryptParams(data []byte) (*ScryptParams, error) {
+	n, r, p, err := packet.ParseScryptParams(data)
+	if err != nil {
+		return nil, fmt.Errorf("scrypt parameters: %w", err)
+	}
+	sp := &ScryptParams{N: int(n), R: int(r), P: int(p)}
+	if err := sp.check(); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// parseArgon2Params parses and checks stored Argon2id parameters.
+func parseArgon2Params(data []byte) (*Argon2Params, error) {
+	time, memory, threads, err := packet.ParseArgon2Params(data)
+	if err != nil {
+		return nil, fmt.Errorf("argon2id parameters: %w", err)
+	}
+	p := &Argon2Params{Time: time, Memory: memory, Threads: threads}
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// PassphraseKeyN returns an access key generation function that generates an
+// access key using Argon2id with iters passes on the provided passphrase and
+// the stored salt. With iters == 3 it produces the same keys as
+// [PassphraseKey]. It is equivalent to [Argon2idKey] with the parameters
+// returned by [PassphraseArgon2Params].
+//
+// To allow a reader to derive the same key, record the parameters with the
+// keyring by setting [Config.Argon2Params] to PassphraseArgon2Params(iters).
+// [ReadWithPassphrase] uses the stored parameters to read the keyring.
+func PassphraseKeyN(passphrase string, iters int) AccessKeyFunc {
+	return Argon2idKey(passphrase, PassphraseArgon2Params(iters))
+}
+
+// PassphraseArgon2Params returns the Argon2id parameters used by
+// [PassphraseKeyN] for the given number of passes. The parameters are not
+// valid if iters ≤ 0.
+func PassphraseArgon2Params(iters int) Argon2Params {
+	return Argon2Params{
+		Time:    uint32(min(max(int64(iters), 0), math.MaxUint32)),
+		Memory:  cipher.PassphraseMemory,
+		Threads: cipher.PassphraseThreads,
+	}
+}
+
 // AccessKeyFromPassphrase generates a key from the specified passphrase using
 // argon2id and a random salt. It returns the key and the salt.
 func AccessKeyFromPassphrase(passphrase string) (key, salt []byte) {
 	return cipher.KeyFromPassphrase(passphrase, AccessKeyLen, nil)
 }
 
+// GenerateSalt returns a randomly-generated access key generation salt of n
+// bytes, for use with a custom [AccessKeyFunc]. It will panic if n ≤ 0.
+//
+// Callers deriving an access key from a passphrase should generally prefer
+// [AccessKeyFromPassphrase], which generates its own salt.
+func GenerateSalt(n int) []byte {
+	if n <= 0 {
+		panic("keyring: salt length must be positive")
+	}
+	return cipher.GenerateKey(n)
+}
+
 // RandomKey returns a randomly-generated key of the specified length.
 // It will panic if n ≤ 0.
 func RandomKey(n int) []byte {
@@ -66,3 +486,54 @@ func RandomKey(n int) []byte {
 	}
 	return cipher.GenerateKey(n)
 }
+
+// RandomKeyReader returns a reader that yields an endless stream of
+// cryptographically random bytes, the same source used by [RandomKey]. Use
+// it to copy large keys directly to their destination with [io.CopyN], or
+// with [Ring.AddRandomFrom].
+func RandomKeyReader() io.Reader { return crand.Reader }
+
+// Preset alphabets for [RandomKeyString].
+const (
+	// AlphabetBase62 contains the ASCII digits and letters.
+	AlphabetBase62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// AlphabetHex contains the lower-case hexadecimal digits.
+	AlphabetHex = "0123456789abcdef"
+
+	// AlphabetURLSafe contains the characters of the URL-safe base64
+	// encoding (RFC 4648), which need no escaping in URLs or file names.
+	AlphabetURLSafe = AlphabetBase62 + "-_"
+)
+
+// RandomKeyString returns a randomly-generated key of n characters, each
+// chosen uniformly and independently from the bytes of alphabet. It is useful
+// for keys that must be printable, such as API tokens. See [AlphabetBase62],
+// [AlphabetHex], and [AlphabetURLSafe] for some common choices.
+// It will panic if n ≤ 0, or if alphabet is empty or longer than 256 bytes.
+func RandomKeyString(n int, alphabet string) []byte {
+	if n <= 0 {
+		panic("keyring: key length must be positive")
+	} else if len(alphabet) == 0 || len(alphabet) > 256 {
+		panic(fmt.Sprintf("keyring: alphabet has %d bytes, want 1 to 256", len(alphabet)))
+	}
+
+	// To avoid bias, reject random bytes that fall in the incomplete cycle
+	// of the alphabet at the top of the range.
+	limit := 256 - 256%len(alphabet)
+	key := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(key) < n {
+		crand.Read(buf) // panics on failure
+		for _, b := range buf {
+			if int(b) < limit {
+				key = append(key, alphabet[int(b)%len(alphabet)])
+				if len(key) == n {
+					break
+				}
+			}
+		}
+	}
+	clear(buf)
+	return key
+}
@@ -4,9 +4,16 @@ package keyring
 
 import (
 	"bytes"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"time"
 
 	"github.com/creachadair/keyring/internal/packet"
+	"github.com/creachadair/mds/slice"
 )
 
 // A View is a read-only view of a [Ring]. A View contains no cryptographic
@@ -15,6 +22,7 @@ import (
 type View struct {
 	keys      map[ID]packet.KeyInfo
 	activeKey ID
+	sealed    bool // keys are encrypted in memory (see memseal.go)
 }
 
 func (v *View) clone() *View {
@@ -22,19 +30,55 @@ func (v *View) clone() *View {
 	for i, ki := range v.keys {
 		cp[i] = ki.Clone()
 	}
-	return &View{keys: cp, activeKey: v.activeKey}
+	return &View{keys: cp, activeKey: v.activeKey, sealed: v.sealed}
 }
 
 // View returns a read-only view of r. Subsequent changes to r do not affect
 // the view after it has been initialized.
-func (r *Ring) View() *View { return r.view.clone() }
+func (r *Ring) View() *View {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.openView().clone()
+}
+
+// ActiveView returns a read-only view of r that contains only the active key,
+// with the same ID it has in r. Subsequent changes to r do not affect the view.
+// It panics if r has no active key.
+func (r *Ring) ActiveView() *View {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	ki := r.view.activeInfo()
+	return &View{
+		keys:      map[ID]packet.KeyInfo{ki.ID: ki.Clone()},
+		activeKey: ki.ID,
+		sealed:    r.view.sealed,
+	}
+}
 
 // Len reports the number of keys in v.
 func (v *View) Len() int { return len(v.keys) }
 
-// Active reports the current active key ID in v.
+// TotalKeyBytes reports the total length in bytes of all the keys in v.
+func (v *View) TotalKeyBytes() int {
+	var n int
+	for _, ki := range v.keys {
+		n += v.keyLen(ki)
+	}
+	return n
+}
+
+// Active reports the current active key ID in v, or 0 if v has no active key.
 func (v *View) Active() ID { return v.activeKey }
 
+// activeInfo returns the active key of v. It panics if v has no active key.
+func (v *View) activeInfo() packet.KeyInfo {
+	if v.activeKey == 0 {
+		panic("keyring: keyring has no active key")
+	}
+	return v.keys[v.activeKey]
+}
+
 // Has reports whether v contains a key with the given ID.
 func (v *View) Has(id ID) bool { _, ok := v.keys[id]; return ok }
 
@@ -45,14 +89,205 @@ func (v *View) Get(id ID, buf []byte) []byte {
 	if !ok {
 		panic(fmt.Sprintf("keyring: no such key: %v", id))
 	}
-	return append(buf, ki.Key...)
+	return v.appendKey(buf, ki)
+}
+
+// TryGet appends the contents of the specified key to buf, and returns the
+// resulting slice. Unlike [View.Get], it reports an error wrapping
+// [ErrUnknownKey] if id does not exist in v, rather than panicking.
+func (v *View) TryGet(id ID, buf []byte) ([]byte, error) {
+	ki, ok := v.keys[id]
+	if !ok {
+		return buf, fmt.Errorf("%w: %v", ErrUnknownKey, id)
+	}
+	return v.appendKey(buf, ki), nil
+}
+
+// ConstantTimeGet appends the contents of the specified key to buf, and
+// returns the resulting slice and true. If id does not exist in v, it returns
+// buf unmodified and false.
+//
+// Unlike [View.Get], ConstantTimeGet does not branch or index memory based on
+// the value of id: It visits every key in v, always in the same order, and
+// selects the matching key using constant-time operations. This is intended
+// for callers who must treat the choice of key as secret from an observer who
+// can measure timing or memory access patterns on the same host. It does not
+// conceal the number of keys in v, their lengths, or the length of the key
+// that was selected (which is visible in the result). It always takes time
+// proportional to the total size of the keys in v, so prefer [View.Get] when
+// the ID is not secret.
+func (v *View) ConstantTimeGet(id ID, buf []byte) ([]byte, bool) {
+	ids := slice.MapKeys(v.keys)
+	slices.Sort(ids)
+	var maxLen int
+	for _, kid := range ids {
+		maxLen = max(maxLen, v.keyLen(v.keys[kid]))
+	}
+	out := make([]byte, maxLen)
+	tmp := make([]byte, 0, maxLen)
+	defer clear(out)
+	defer clear(tmp[:maxLen])
+
+	var n, found int
+	for _, kid := range ids {
+		ki := v.keys[kid]
+		key := v.appendKey(tmp[:0], ki)
+		eq := constantTimeEqID(ki.ID, id)
+		subtle.ConstantTimeCopy(eq, out[:len(key)], key)
+		n = subtle.ConstantTimeSelect(eq, len(key), n)
+		found |= eq
+	}
+	return append(buf, out[:n]...), found == 1
+}
+
+// Find reports the ID of the key in v whose contents equal key, and whether
+// one was found. If several keys have the same contents, Find returns the
+// lowest of their IDs. The contents of every key are compared with key in
+// constant time, without stopping early, so that the timing of Find does not
+// reveal which key (if any) matched.
+func (v *View) Find(key []byte) (ID, bool) {
+	var found int
+	var match ID
+	// Visit IDs in decreasing order, so the lowest matching ID wins.
+	for _, id := range slices.Backward(slices.Collect(v.IDs())) {
+		k := v.appendKey(nil, v.keys[id])
+		eq := subtle.ConstantTimeCompare(k, key)
+		clear(k)
+		match = ID(subtle.ConstantTimeSelect(eq, int(id), int(match)))
+		found |= eq
+	}
+	return match, found == 1
+}
+
+// Equal reports whether the key with the specified ID has the same contents
+// as candidate. The contents are compared in constant time, so the timing of
+// Equal does not reveal how much of candidate matches. It returns false if id
+// does not exist in v. Equal does not copy the key out of v, except
+// temporarily to unseal it when [Config.EncryptInMemory] is set.
+func (v *View) Equal(id ID, candidate []byte) bool {
+	ki, ok := v.keys[id]
+	if !ok {
+		return false
+	} else if !v.sealed {
+		return subtle.ConstantTimeCompare(ki.Key, candidate) == 1
+	}
+	k := v.appendKey(nil, ki)
+	defer clear(k)
+	return subtle.ConstantTimeCompare(k, candidate) == 1
+}
+
+// constantTimeEqID returns 1 if a == b and 0 otherwise, in constant time.
+func constantTimeEqID(a, b ID) int {
+	ua, ub := uint64(a), uint64(b)
+	return subtle.ConstantTimeEq(int32(ua), int32(ub)) & subtle.ConstantTimeEq(int32(ua>>32), int32(ub>>32))
+}
+
+// CreatedAt reports the creation time of the specified key, or the zero time
+// if it is not known. It panics if id does not exist in v.
+func (v *View) CreatedAt(id ID) time.Time {
+	ki, ok := v.keys[id]
+	if !ok {
+		panic(fmt.Sprintf("keyring: no such key: %v", id))
+	}
+	return ki.Created
+}
+
+// Label reports the label of the specified key, or "" if it has none.
+// It panics if id does not exist in v.
+func (v *View) Label(id ID) string {
+	ki, ok := v.keys[id]
+	if !ok {
+		panic(fmt.Sprintf("keyring: no such key: %v", id))
+	}
+	return ki.Label
+}
+
+// NotBefore reports the time before which the specified key is not valid, or
+// the zero time if the key is valid immediately. It panics if id does not
+// exist in v.
+func (v *View) NotBefore(id ID) time.Time {
+	ki, ok := v.keys[id]
+	if !ok {
+		panic(fmt.Sprintf("keyring: no such key: %v", id))
+	}
+	return ki.NotBefore
 }
 
 // GetActive appends the contents of the active key to buf, and returns active
-// ID and the updated slice.
+// ID and the updated slice. It panics if v has no active key.
 func (v *View) GetActive(buf []byte) (ID, []byte) {
+	ki := v.activeInfo()
+	return ki.ID, v.appendKey(buf, ki)
+}
+
+// GetActiveInfo appends the contents of the active key to buf, and returns the
+// active ID, the creation time of the active key, and the updated slice.
+// The creation time is zero if it is not known. It panics if v has no active
+// key.
+func (v *View) GetActiveInfo(buf []byte) (ID, time.Time, []byte) {
+	ki := v.activeInfo()
+	return ki.ID, ki.Created, v.appendKey(buf, ki)
+}
+
+// CopyActive copies the contents of the active key into dst, and returns the
+// active ID and the number of bytes copied. Unlike [View.GetActive], it never
+// allocates: If dst is shorter than the key, CopyActive copies nothing and
+// reports an error wrapping [io.ErrShortBuffer], so that the caller can keep
+// key material in buffers it manages and zeroes itself. It reports an error if
+// v has no active key.
+func (v *View) CopyActive(dst []byte) (ID, int, error) {
+	if v.activeKey == 0 {
+		return 0, 0, errors.New("keyring: keyring has no active key")
+	}
 	ki := v.keys[v.activeKey]
-	return ki.ID, append(buf, ki.Key...)
+	if n := v.keyLen(ki); len(dst) < n {
+		return 0, 0, fmt.Errorf("keyring: buffer has %d bytes, key has %d: %w", len(dst), n, io.ErrShortBuffer)
+	}
+	return ki.ID, len(v.appendKey(dst[:0], ki)), nil
+}
+
+// EligibleIDs returns an iterator over the IDs of the keys in v that are
+// eligible for use with new data, in increasing order. A key is eligible
+// unless it has a not-before time later than the current time.
+func (v *View) EligibleIDs() iter.Seq[ID] {
+	return func(yield func(ID) bool) {
+		now := time.Now()
+		for id := range v.IDs() {
+			if nb := v.keys[id].NotBefore; !nb.IsZero() && now.Before(nb) {
+				continue
+			}
+			if !yield(id) {
+				return
+			}
+		}
+	}
+}
+
+// IDs returns an iterator over the IDs of all the keys in v, in increasing
+// order. The IDs need not be contiguous, since keys may have been removed.
+func (v *View) IDs() iter.Seq[ID] {
+	return func(yield func(ID) bool) {
+		ids := slice.MapKeys(v.keys)
+		slices.Sort(ids)
+		for _, id := range ids {
+			if !yield(id) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the IDs and contents of all the keys in v, in
+// increasing order of ID. Each key is a fresh copy, which the caller may
+// modify without affecting v.
+func (v *View) Keys() iter.Seq2[ID, []byte] {
+	return func(yield func(ID, []byte) bool) {
+		for id := range v.IDs() {
+			if !yield(id, v.appendKey(nil, v.keys[id])) {
+				return
+			}
+		}
+	}
 }
 
 // SingleKeyView constructs a [View] that exports the single provided key as
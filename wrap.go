@@ -0,0 +1,149 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/creachadair/keyring/internal/cipher"
+	"github.com/creachadair/keyring/internal/packet"
+)
+
+// A KeyWrapper wraps and unwraps the data storage key of a keyring with a key
+// kept outside the keyring, such as a key in a hardware security module (HSM)
+// accessed via PKCS#11. This package does not provide an implementation; the
+// caller supplies one for their HSM or key management service.
+//
+// An implementation should use an authenticated wrapping mechanism (such as
+// AES key wrap or AES-GCM), so that unwrapping with the wrong key reports an
+// error rather than returning the wrong data key.
+type KeyWrapper interface {
+	// Label reports a name for the wrapping key, such as an HSM key label.
+	// It must be 1 to 255 bytes of valid UTF-8. The label is stored in
+	// plaintext with the wrapped key, and identifies it when reading.
+	Label() string
+
+	// WrapKey returns dataKey encrypted with the wrapping key.
+	WrapKey(dataKey []byte) ([]byte, error)
+
+	// UnwrapKey returns the plaintext of a data key wrapped with the key
+	// identified by label.
+	UnwrapKey(label string, wrapped []byte) ([]byte, error)
+}
+
+// A wrappedSlot is a copy of the data storage key wrapped by a [KeyWrapper].
+type wrappedSlot struct {
+	label   string
+	wrapped []byte
+}
+
+// checkWrapLabel reports an error if label is not a valid wrapping key label.
+func checkWrapLabel(label string) error {
+	if len(label) == 0 || len(label) > packet.MaxLabelLen {
+		return fmt.Errorf("keyring: wrapping key label is %d bytes, want 1 to %d", len(label), packet.MaxLabelLen)
+	} else if !utf8.ValidString(label) {
+		return errors.New("keyring: wrapping key label is not valid UTF-8")
+	}
+	return nil
+}
+
+// AddWrappedKey adds a copy of the data storage key of r wrapped by w, so that
+// [ReadWrapped] can read r with w, in addition to the access keys of r. It
+// reports an error if the label of w is invalid or already used by r, or if
+// w fails to wrap the key.
+//
+// Like the additional access keys of [Ring.AddAccessKey], wrapped keys are
+// removed by [Ring.Rekey], since they do not unlock the new data key.
+func (r *Ring) AddWrappedKey(w KeyWrapper) error {
+	label := w.Label()
+	if err := checkWrapLabel(label); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkOpen()
+	for _, s := range r.wrapped {
+		if s.label == label {
+			return fmt.Errorf("keyring: wrapping key %q is already in use", label)
+		}
+	}
+	wrapped, err := w.WrapKey(bytes.Clone(r.dkPlaintext))
+	if err != nil {
+		return fmt.Errorf("keyring: wrap data key: %w", err)
+	} else if len(wrapped) == 0 {
+		return errors.New("keyring: wrap data key: empty result")
+	}
+	r.wrapped = append(r.wrapped, wrappedSlot{label: label, wrapped: wrapped})
+	return nil
+}
+
+// WrappedKeyLabels reports the labels of the wrapping keys that unlock r, in
+// the order they were added. See [Ring.AddWrappedKey].
+func (r *Ring) WrappedKeyLabels() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkOpen()
+	var out []string
+	for _, s := range r.wrapped {
+		out = append(out, s.label)
+	}
+	return out
+}
+
+// NewWrapped constructs a new [Ring] from c, as [New] does, whose data
+// storage key is wrapped by w rather than encrypted with an access key. Use
+// [ReadWrapped] to read it.
+//
+// The ring is given a random access key that is not retained, so that only w
+// (or another key added later with [Ring.AddAccessKey] or
+// [Ring.AddWrappedKey]) can unlock it. It reports an error if c sets
+// AccessKey, Argon2Params, or ScryptParams.
+func NewWrapped(c Config, w KeyWrapper) (*Ring, error) {
+	if len(c.AccessKey) != 0 {
+		return nil, errors.New("keyring: access key is set for a wrapped keyring")
+	} else if c.Argon2Params != nil || c.ScryptParams != nil {
+		return nil, errors.New("keyring: key derivation parameters are set for a wrapped keyring")
+	}
+	akey := cipher.GenerateKey(AccessKeyLen)
+	defer clear(akey)
+	c.AccessKey = akey
+	r, err := New(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.AddWrappedKey(w); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadWrapped reads a [Ring] from r as [Read] does, but unwraps the data
+// storage key with w instead of an access key. It uses the wrapped key whose
+// label matches the label of w, and reports an error wrapping
+// [ErrBadAccessKey] if there is none. An error from w is reported as-is.
+func ReadWrapped(r io.Reader, w KeyWrapper) (*Ring, error) {
+	data, err := readAllContext(context.Background(), r, DefaultMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	label := w.Label()
+	return readRing(data, nil, func(_ cipher.Suite, _ []accessSlot, wrapped []wrappedSlot) ([]byte, error) {
+		for _, s := range wrapped {
+			if s.label != label {
+				continue
+			}
+			dk, err := w.UnwrapKey(s.label, bytes.Clone(s.wrapped))
+			if err != nil {
+				return nil, fmt.Errorf("unwrap data key: %w", err)
+			}
+			return dk, nil
+		}
+		return nil, fmt.Errorf("%w: no data key wrapped by %q", ErrBadAccessKey, label)
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2025 Michael J. Fromberger. All Rights Reserved.
+
+package keyring
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// yubiKeyTool is the name of the program used to issue challenges to a YubiKey.
+// It is provided by the yubikey-personalization package.
+const yubiKeyTool = "ykchalresp"
+
+// YubiKeyHMACKey returns an access key generation function that derives an
+// access key from the HMAC-SHA1 challenge-response of a YubiKey configured in
+// the specified slot (1 or 2). It reports an error if the slot is invalid, or
+// if the ykchalresp tool is not installed.
+//
+// The access key generation salt is sent to the YubiKey as the challenge, and
+// the access key is derived from the 20-byte response using HKDF-SHA256 with
+// the salt and the info string "keyring yubikey access key". The salt must be
+// between 1 and 64 bytes; use [GenerateSalt] to generate one when creating a
+// keyring:
+//
+//	keyFunc, err := keyring.YubiKeyHMACKey(2)
+//	// ...
+//	salt := keyring.GenerateSalt(16)
+//	accessKey, err := keyFunc(salt)
+func YubiKeyHMACKey(slot int) (AccessKeyFunc, error) {
+	if slot != 1 && slot != 2 {
+		return nil, fmt.Errorf("keyring: invalid YubiKey slot %d", slot)
+	}
+	tool, err := exec.LookPath(yubiKeyTool)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: YubiKey support unavailable: %w", err)
+	}
+	return func(salt []byte) ([]byte, error) {
+		if len(salt) == 0 || len(salt) > 64 {
+			return nil, fmt.Errorf("salt is %d bytes, want 1..64", len(salt))
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(tool, "-"+strconv.Itoa(slot), "-H", "-x", hex.EncodeToString(salt))
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) != 0 {
+				return nil, fmt.Errorf("challenge YubiKey: %w: %s", err, msg)
+			}
+			return nil, fmt.Errorf("challenge YubiKey: %w", err)
+		}
+		rsp, err := hex.DecodeString(string(bytes.TrimSpace(out)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid YubiKey response: %w", err)
+		} else if len(rsp) == 0 {
+			return nil, errors.New("empty YubiKey response")
+		}
+		defer clear(rsp)
+		return hkdf.Key(sha256.New, rsp, salt, "keyring yubikey access key", AccessKeyLen)
+	}, nil
+}